@@ -7,3 +7,14 @@ toolchain go1.23.10
 require github.com/mattn/go-sqlite3 v1.14.17
 
 require github.com/a-h/templ v0.3.920
+
+require (
+	github.com/microcosm-cc/bluemonday v1.0.27
+	github.com/yuin/goldmark v1.7.8
+)
+
+require (
+	github.com/aymerick/douceur v0.2.0 // indirect
+	github.com/gorilla/css v1.0.1 // indirect
+	golang.org/x/net v0.39.0 // indirect
+)
@@ -0,0 +1,246 @@
+// Package attachments stores the files attached to journal entries. Files
+// are content-addressed: each one is stored once under the SHA-256 of its
+// content, whatever the number of entries it is attached to.
+package attachments
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"time"
+
+	// Decoders of the image formats that get a thumbnail
+	_ "image/gif"
+	_ "image/png"
+)
+
+const (
+	// MaxSize is the maximum size of an attachment, in bytes
+	MaxSize = 10 << 20
+
+	// ThumbnailSize is the maximum width and height of a thumbnail, in pixels
+	ThumbnailSize = 320
+
+	// maxPixels bounds the size of the images decoded to make thumbnails
+	maxPixels = 40_000_000
+)
+
+// AllowedTypes are the MIME types attachments may have
+var AllowedTypes = []string{"image/jpeg", "image/png", "image/gif", "application/pdf"}
+
+var (
+	// ErrTooLarge is returned when a file is larger than MaxSize
+	ErrTooLarge = fmt.Errorf("file is larger than %d MB", MaxSize>>20)
+
+	// ErrUnsupportedType is returned when the type of a file is not in AllowedTypes
+	ErrUnsupportedType = errors.New("only JPEG, PNG and GIF images and PDF documents can be attached")
+)
+
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Dir is the directory where files are stored
+var Dir string
+
+// Initialize sets up the storage directory
+func Initialize(dir string) error {
+	for _, sub := range []string{"objects", "thumbnails"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return fmt.Errorf("failed to create attachments directory: %w", err)
+		}
+	}
+	Dir = dir
+	return nil
+}
+
+// Blob describes a stored file
+type Blob struct {
+	Hash     string
+	MimeType string
+	Size     int64
+}
+
+// isImage reports whether a MIME type is the one of an image
+func isImage(mimeType string) bool {
+	return mimeType == "image/jpeg" || mimeType == "image/png" || mimeType == "image/gif"
+}
+
+// Save stores a file and, for images, its thumbnail. The MIME type is
+// detected from the content rather than trusted from the client.
+func Save(r io.Reader) (Blob, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxSize+1))
+	if err != nil {
+		return Blob{}, err
+	}
+	if len(data) > MaxSize {
+		return Blob{}, ErrTooLarge
+	}
+
+	mimeType := http.DetectContentType(data)
+	if !slices.Contains(AllowedTypes, mimeType) {
+		return Blob{}, ErrUnsupportedType
+	}
+
+	sum := sha256.Sum256(data)
+	blob := Blob{Hash: hex.EncodeToString(sum[:]), MimeType: mimeType, Size: int64(len(data))}
+
+	// The file may already be stored for another entry. Touch it so that
+	// garbage collection does not remove it before it is referenced again.
+	now := time.Now()
+	if err := os.Chtimes(Path(blob.Hash), now, now); err == nil {
+		return blob, nil
+	}
+	if err := writeFile(Path(blob.Hash), data); err != nil {
+		return Blob{}, err
+	}
+
+	if isImage(mimeType) {
+		// A missing thumbnail is not fatal: the image itself is shown instead
+		if err := writeThumbnail(blob.Hash, data); err != nil {
+			slog.Warn("Failed to create thumbnail", "hash", blob.Hash, "err", err)
+		}
+	}
+
+	return blob, nil
+}
+
+// Path returns the path of a stored file
+func Path(hash string) string {
+	return filepath.Join(Dir, "objects", hash[:2], hash)
+}
+
+// ThumbnailPath returns the path of the thumbnail of a stored image
+func ThumbnailPath(hash string) string {
+	return filepath.Join(Dir, "thumbnails", hash[:2], hash+".jpg")
+}
+
+// writeFile writes a file atomically, so that a crash never leaves a
+// truncated file under a valid hash
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeThumbnail scales an image down to fit in ThumbnailSize and stores it as JPEG
+func writeThumbnail(hash string, data []byte) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if config.Width*config.Height > maxPixels {
+		return fmt.Errorf("image is too large to make a thumbnail: %dx%d", config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaleDown(img, ThumbnailSize), &jpeg.Options{Quality: 80}); err != nil {
+		return err
+	}
+	return writeFile(ThumbnailPath(hash), buf.Bytes())
+}
+
+// scaleDown resizes an image to fit in a size x size square, averaging the
+// source pixels covered by each pixel of the result
+func scaleDown(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+
+	dw, dh := size, h*size/w
+	if h > w {
+		dw, dh = w*size/h, size
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := bounds.Min.Y+y*h/dh, bounds.Min.Y+max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := bounds.Min.X+x*w/dw, bounds.Min.X+max((x+1)*w/dw, x*w/dw+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(b / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
+
+// CollectGarbage removes the stored files whose hash is not referenced any
+// more, with their thumbnails. Files modified recently are kept, as they may
+// belong to an upload whose metadata is not saved yet.
+func CollectGarbage(referenced map[string]bool) (int, error) {
+	removed := 0
+	err := filepath.WalkDir(filepath.Join(Dir, "objects"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		hash := d.Name()
+		if !hashPattern.MatchString(hash) || referenced[hash] {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if time.Since(info.ModTime()) < time.Hour {
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		if err := os.Remove(ThumbnailPath(hash)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
@@ -1,12 +1,12 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 var DB *sql.DB
@@ -22,7 +22,7 @@ func Initialize(dbPath string) error {
 	}
 
 	// Open the database connection
-	DB, err = sql.Open("sqlite3", dbPath)
+	DB, err = sql.Open(driverName, dbPath)
 	if err != nil {
 		return fmt.Errorf("failed to open database connection: %w", err)
 	}
@@ -50,25 +50,94 @@ func Close() error {
 	return nil
 }
 
-// runMigrations executes all SQL migration files in order
-func runMigrations() error {
-	migrationsDir := "internal/database/migrations"
+// Backup writes a consistent copy of the database to path, which must not exist
+func Backup(path string) error {
+	if _, err := DB.Exec("VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	return nil
+}
+
+// migrationsDir holds the SQL migration files, run in the order of their names
+const migrationsDir = "internal/database/migrations"
+
+// Ping checks that the database can be reached
+func Ping(ctx context.Context) error {
+	if DB == nil {
+		return errors.New("database is not initialized")
+	}
+	return DB.PingContext(ctx)
+}
 
-	// Read migration files
+// PendingMigrations returns the names of the migration files not applied yet
+func PendingMigrations(ctx context.Context) ([]string, error) {
+	migrations, err := migrationFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []string
+	for _, migrationPath := range migrations {
+		name := filepath.Base(migrationPath)
+		var applied int
+		err := DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE name = ?", name).Scan(&applied)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check migration %s: %w", migrationPath, err)
+		}
+		if applied == 0 {
+			pending = append(pending, name)
+		}
+	}
+	return pending, nil
+}
+
+// migrationFiles lists the paths of the migration files, sorted by name
+func migrationFiles() ([]string, error) {
 	entries, err := os.ReadDir(migrationsDir)
 	if err != nil {
-		return fmt.Errorf("failed to read migrations directory: %w", err)
+		return nil, fmt.Errorf("failed to read migrations directory: %w", err)
 	}
 
-	// Sort and execute migrations
 	migrations := make([]string, 0, len(entries))
 	for _, entry := range entries {
 		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".sql" {
 			migrations = append(migrations, filepath.Join(migrationsDir, entry.Name()))
 		}
 	}
+	return migrations, nil
+}
+
+// runMigrations executes all SQL migration files in order, skipping the ones
+// already recorded in the schema_migrations table
+func runMigrations() error {
+	// Keep track of applied migrations so that non idempotent statements
+	// (such as ALTER TABLE) only run once
+	_, err := DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		name TEXT PRIMARY KEY,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	// Execute the migrations in order
+	migrations, err := migrationFiles()
+	if err != nil {
+		return err
+	}
 
 	for _, migrationPath := range migrations {
+		name := filepath.Base(migrationPath)
+
+		var applied int
+		err := DB.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE name = ?", name).Scan(&applied)
+		if err != nil {
+			return fmt.Errorf("failed to check migration %s: %w", migrationPath, err)
+		}
+		if applied > 0 {
+			continue
+		}
+
 		fmt.Printf("Running migration: %s\n", migrationPath)
 
 		// Read migration file
@@ -83,6 +152,11 @@ func runMigrations() error {
 			return fmt.Errorf("failed to execute migration %s: %w", migrationPath, err)
 		}
 
+		_, err = DB.Exec("INSERT INTO schema_migrations (name) VALUES (?)", name)
+		if err != nil {
+			return fmt.Errorf("failed to record migration %s: %w", migrationPath, err)
+		}
+
 		fmt.Printf("Successfully applied migration: %s\n", migrationPath)
 	}
 
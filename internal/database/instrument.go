@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"pds/internal/metrics"
+)
+
+// driverName is the name of the SQLite driver timing the queries
+const driverName = "sqlite3-instrumented"
+
+var queryDuration = metrics.NewHistogram("pds_db_query_duration_seconds",
+	"Time taken by database queries, until their rows are closed, by operation.", metrics.DefaultBuckets, "operation")
+
+func init() {
+	sql.Register(driverName, &instrumentedDriver{})
+
+	// Statistics of the connection pool
+	metrics.NewGaugeFunc("pds_db_connections_open", "Number of open database connections.",
+		poolStat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	metrics.NewGaugeFunc("pds_db_connections_in_use", "Number of database connections in use.",
+		poolStat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	metrics.NewGaugeFunc("pds_db_connections_idle", "Number of idle database connections.",
+		poolStat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	metrics.NewCounterFunc("pds_db_connection_waits_total", "Number of waits for a database connection.",
+		poolStat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	metrics.NewCounterFunc("pds_db_connection_wait_seconds_total", "Time spent waiting for database connections.",
+		poolStat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+}
+
+// poolStat returns a function computing a statistic of the connection pool
+func poolStat(stat func(sql.DBStats) float64) func() (float64, error) {
+	return func() (float64, error) {
+		if DB == nil {
+			return 0, errors.New("database is not initialized")
+		}
+		return stat(DB.Stats()), nil
+	}
+}
+
+// instrumentedDriver opens SQLite connections timing their queries
+type instrumentedDriver struct {
+	sqlite3.SQLiteDriver
+}
+
+func (d *instrumentedDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+// instrumentedConn is a SQLite connection timing the queries run directly
+// on it, which are all the queries of the app as it prepares no statements
+type instrumentedConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := c.SQLiteConn.ExecContext(ctx, query, args)
+	queryDuration.ObserveDuration(start, queryOperation(query))
+	return result, err
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.SQLiteConn.QueryContext(ctx, query, args)
+	if err != nil {
+		queryDuration.ObserveDuration(start, queryOperation(query))
+		return nil, err
+	}
+	// SQLite runs queries as their rows are read
+	return &instrumentedRows{SQLiteRows: rows.(*sqlite3.SQLiteRows), start: start, operation: queryOperation(query)}, nil
+}
+
+// instrumentedRows are the rows of a query, timed when closed
+type instrumentedRows struct {
+	*sqlite3.SQLiteRows
+	start     time.Time
+	operation string
+}
+
+func (r *instrumentedRows) Close() error {
+	err := r.SQLiteRows.Close()
+	queryDuration.ObserveDuration(r.start, r.operation)
+	return err
+}
+
+// queryOperation returns the kind of a query from its first keyword, e.g.
+// "select"
+func queryOperation(query string) string {
+	for _, line := range strings.Split(query, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "--") {
+			continue
+		}
+		switch keyword := strings.ToLower(fields[0]); keyword {
+		case "select", "insert", "update", "delete", "with":
+			return keyword
+		}
+		return "other"
+	}
+	return "other"
+}
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS behaviour_occurrences (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    behaviour_id INTEGER NOT NULL,
+    note TEXT,
+    occurred_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (behaviour_id) REFERENCES behaviours (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_behaviour_occurrences_occurred_at ON behaviour_occurrences(occurred_at);
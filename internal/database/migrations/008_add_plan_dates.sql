@@ -0,0 +1,8 @@
+-- Track the lifecycle of a plan so that reports can tell what was started,
+-- finished or let slip during a period.
+ALTER TABLE plans ADD COLUMN created_at DATETIME;
+ALTER TABLE plans ADD COLUMN started_at DATETIME;
+ALTER TABLE plans ADD COLUMN due_date DATE;
+ALTER TABLE plans ADD COLUMN completed_at DATETIME;
+
+UPDATE plans SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
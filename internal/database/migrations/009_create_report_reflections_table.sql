@@ -0,0 +1,8 @@
+-- A reflection written by the user about a weekly or monthly report.
+CREATE TABLE IF NOT EXISTS report_reflections (
+    period TEXT NOT NULL,
+    start_date DATE NOT NULL,
+    content TEXT NOT NULL,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (period, start_date)
+);
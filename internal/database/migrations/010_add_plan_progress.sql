@@ -0,0 +1,2 @@
+-- Progress of a plan, in percent
+ALTER TABLE plans ADD COLUMN progress INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+-- The widgets shown on the dashboard, in the order chosen by the user
+CREATE TABLE IF NOT EXISTS dashboard_widgets (
+    name TEXT PRIMARY KEY,
+    position INTEGER NOT NULL,
+    enabled INTEGER NOT NULL DEFAULT 1
+);
@@ -0,0 +1,16 @@
+-- Spaced repetition scheduling of statements (SM-2)
+ALTER TABLE statements ADD COLUMN ease REAL NOT NULL DEFAULT 2.5;
+ALTER TABLE statements ADD COLUMN interval_days INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE statements ADD COLUMN repetitions INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE statements ADD COLUMN due_at DATETIME;
+
+-- Every rehearsal of a statement, with how strongly it resonated (0 to 5)
+CREATE TABLE IF NOT EXISTS statement_rehearsals (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    statement_id INTEGER NOT NULL,
+    resonance INTEGER NOT NULL CHECK (resonance BETWEEN 0 AND 5),
+    rehearsed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (statement_id) REFERENCES statements (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_statement_rehearsals_statement_id ON statement_rehearsals(statement_id);
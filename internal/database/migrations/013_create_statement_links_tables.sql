@@ -0,0 +1,17 @@
+-- Aims supported by a statement
+CREATE TABLE IF NOT EXISTS statement_aims (
+    statement_id INTEGER NOT NULL,
+    aim_id INTEGER NOT NULL,
+    PRIMARY KEY (statement_id, aim_id),
+    FOREIGN KEY (statement_id) REFERENCES statements (id) ON DELETE CASCADE,
+    FOREIGN KEY (aim_id) REFERENCES aims (id) ON DELETE CASCADE
+);
+
+-- Behaviours countered by a statement
+CREATE TABLE IF NOT EXISTS statement_behaviours (
+    statement_id INTEGER NOT NULL,
+    behaviour_id INTEGER NOT NULL,
+    PRIMARY KEY (statement_id, behaviour_id),
+    FOREIGN KEY (statement_id) REFERENCES statements (id) ON DELETE CASCADE,
+    FOREIGN KEY (behaviour_id) REFERENCES behaviours (id) ON DELETE CASCADE
+);
@@ -0,0 +1,15 @@
+-- Aims served by a plan, with the weight of the plan's contribution to each
+-- of them. plans.value_id is kept as the primary aim of the plan.
+CREATE TABLE IF NOT EXISTS plan_aims (
+    plan_id INTEGER NOT NULL,
+    aim_id INTEGER NOT NULL,
+    weight REAL NOT NULL DEFAULT 1.0 CHECK (weight > 0),
+    PRIMARY KEY (plan_id, aim_id),
+    FOREIGN KEY (plan_id) REFERENCES plans (id) ON DELETE CASCADE,
+    FOREIGN KEY (aim_id) REFERENCES aims (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_plan_aims_aim_id ON plan_aims(aim_id);
+
+INSERT OR IGNORE INTO plan_aims (plan_id, aim_id, weight)
+SELECT id, value_id, 1.0 FROM plans;
@@ -0,0 +1,36 @@
+-- Free-form tags of a journal entry, stored lowercase
+CREATE TABLE IF NOT EXISTS journal_tags (
+    journal_id INTEGER NOT NULL,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (journal_id, tag),
+    FOREIGN KEY (journal_id) REFERENCES journals (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_journal_tags_tag ON journal_tags(tag);
+
+-- Aims a journal entry relates to
+CREATE TABLE IF NOT EXISTS journal_aims (
+    journal_id INTEGER NOT NULL,
+    aim_id INTEGER NOT NULL,
+    PRIMARY KEY (journal_id, aim_id),
+    FOREIGN KEY (journal_id) REFERENCES journals (id) ON DELETE CASCADE,
+    FOREIGN KEY (aim_id) REFERENCES aims (id) ON DELETE CASCADE
+);
+
+-- Plans a journal entry relates to
+CREATE TABLE IF NOT EXISTS journal_plans (
+    journal_id INTEGER NOT NULL,
+    plan_id INTEGER NOT NULL,
+    PRIMARY KEY (journal_id, plan_id),
+    FOREIGN KEY (journal_id) REFERENCES journals (id) ON DELETE CASCADE,
+    FOREIGN KEY (plan_id) REFERENCES plans (id) ON DELETE CASCADE
+);
+
+-- Behaviours a journal entry is about
+CREATE TABLE IF NOT EXISTS journal_behaviours (
+    journal_id INTEGER NOT NULL,
+    behaviour_id INTEGER NOT NULL,
+    PRIMARY KEY (journal_id, behaviour_id),
+    FOREIGN KEY (journal_id) REFERENCES journals (id) ON DELETE CASCADE,
+    FOREIGN KEY (behaviour_id) REFERENCES behaviours (id) ON DELETE CASCADE
+);
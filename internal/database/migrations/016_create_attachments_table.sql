@@ -0,0 +1,15 @@
+-- Files attached to journal entries. The content is stored under its
+-- SHA-256 hash in the attachments directory, so several rows may share it.
+CREATE TABLE IF NOT EXISTS attachments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    journal_id INTEGER NOT NULL,
+    hash TEXT NOT NULL,
+    filename TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (journal_id) REFERENCES journals (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_journal_id ON attachments(journal_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_hash ON attachments(hash);
@@ -0,0 +1,25 @@
+-- Positive habits serving an aim. The schedule is one of:
+--   daily     every day
+--   weekly    times_per_week days of each week, any of them
+--   weekdays  the days set in the weekdays bitmask (bit 0 is Sunday)
+CREATE TABLE IF NOT EXISTS habits (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    description TEXT,
+    aim_id INTEGER NOT NULL,
+    schedule TEXT NOT NULL DEFAULT 'daily',
+    times_per_week INTEGER NOT NULL DEFAULT 0,
+    weekdays INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (aim_id) REFERENCES aims (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_habits_aim_id ON habits(aim_id);
+
+-- Days on which a habit was done
+CREATE TABLE IF NOT EXISTS habit_checkins (
+    habit_id INTEGER NOT NULL,
+    day DATE NOT NULL,
+    PRIMARY KEY (habit_id, day),
+    FOREIGN KEY (habit_id) REFERENCES habits (id) ON DELETE CASCADE
+);
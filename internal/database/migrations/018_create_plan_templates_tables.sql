@@ -0,0 +1,33 @@
+-- Templates of plans that repeat. A new plan is instantiated from the
+-- template at every occurrence of its recurrence rule (an RFC 5545 RRULE,
+-- e.g. FREQ=WEEKLY;BYDAY=SU), starting at starts_at.
+CREATE TABLE IF NOT EXISTS plan_templates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    resources_required TEXT NOT NULL DEFAULT '',
+    recurrence TEXT NOT NULL,
+    starts_at DATETIME NOT NULL,
+    duration_days INTEGER NOT NULL DEFAULT 0,
+    next_run_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_plan_templates_next_run_at ON plan_templates(next_run_at);
+
+-- Aims served by the plans instantiated from a template
+CREATE TABLE IF NOT EXISTS plan_template_aims (
+    template_id INTEGER NOT NULL,
+    aim_id INTEGER NOT NULL,
+    weight REAL NOT NULL DEFAULT 1.0 CHECK (weight > 0),
+    PRIMARY KEY (template_id, aim_id),
+    FOREIGN KEY (template_id) REFERENCES plan_templates (id) ON DELETE CASCADE,
+    FOREIGN KEY (aim_id) REFERENCES aims (id) ON DELETE CASCADE
+);
+
+-- Plans instantiated from a template keep a link to it and to the occurrence
+-- they were created for, which is created only once
+ALTER TABLE plans ADD COLUMN template_id INTEGER REFERENCES plan_templates (id);
+ALTER TABLE plans ADD COLUMN template_occurrence DATETIME;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_plans_template_occurrence ON plans(template_id, template_occurrence);
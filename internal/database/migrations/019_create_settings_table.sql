@@ -0,0 +1,5 @@
+-- Application settings, such as the secret token of the calendar feed
+CREATE TABLE IF NOT EXISTS settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
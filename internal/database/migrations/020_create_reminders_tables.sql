@@ -0,0 +1,39 @@
+-- Reminders sent every day at a local time of day (HH:MM) through a
+-- notification channel (email, push or webhook). last_fired_on is the last
+-- day the reminder was sent, so that it is sent once a day.
+CREATE TABLE IF NOT EXISTS reminders (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,
+    time_of_day TEXT NOT NULL,
+    channel TEXT NOT NULL,
+    last_fired_on DATE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Notifications to deliver, with the attempts made. Failed attempts are
+-- retried at next_attempt_at until the delivery succeeds or gives up.
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    reminder_id INTEGER REFERENCES reminders (id) ON DELETE SET NULL,
+    channel TEXT NOT NULL,
+    title TEXT NOT NULL,
+    body TEXT NOT NULL DEFAULT '',
+    url TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    sent_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_pending ON notification_deliveries(status, next_attempt_at);
+
+-- Browsers subscribed to Web Push notifications
+CREATE TABLE IF NOT EXISTS push_subscriptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    endpoint TEXT NOT NULL UNIQUE,
+    p256dh TEXT NOT NULL,
+    auth TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
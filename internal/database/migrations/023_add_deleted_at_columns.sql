@@ -0,0 +1,11 @@
+-- Deleted journal entries, plans, values and statements are moved to the
+-- trash, where they can be restored until they are purged
+ALTER TABLE journals ADD COLUMN deleted_at DATETIME;
+ALTER TABLE plans ADD COLUMN deleted_at DATETIME;
+ALTER TABLE aims ADD COLUMN deleted_at DATETIME;
+ALTER TABLE statements ADD COLUMN deleted_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_journals_deleted_at ON journals(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_plans_deleted_at ON plans(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_aims_deleted_at ON aims(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_statements_deleted_at ON statements(deleted_at);
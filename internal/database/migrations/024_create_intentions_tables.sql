@@ -0,0 +1,32 @@
+-- Implementation intentions: if-then plans responding to a behaviour, e.g.
+-- "when I feel bored at my desk, I will take a walk", optionally following a
+-- plan or a statement
+CREATE TABLE IF NOT EXISTS intentions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    behaviour_id INTEGER NOT NULL,
+    cue TEXT NOT NULL,
+    response TEXT NOT NULL,
+    plan_id INTEGER,
+    statement_id INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (behaviour_id) REFERENCES behaviours (id) ON DELETE CASCADE,
+    FOREIGN KEY (plan_id) REFERENCES plans (id),
+    FOREIGN KEY (statement_id) REFERENCES statements (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_intentions_behaviour_id ON intentions(behaviour_id);
+
+-- Whether an intention was applied when the behaviour occurred, and whether
+-- it worked. worked is NULL when the intention was not applied.
+CREATE TABLE IF NOT EXISTS intention_outcomes (
+    occurrence_id INTEGER NOT NULL,
+    intention_id INTEGER NOT NULL,
+    applied BOOLEAN NOT NULL,
+    worked BOOLEAN,
+    recorded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (occurrence_id, intention_id),
+    FOREIGN KEY (occurrence_id) REFERENCES behaviour_occurrences (id) ON DELETE CASCADE,
+    FOREIGN KEY (intention_id) REFERENCES intentions (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_intention_outcomes_intention_id ON intention_outcomes(intention_id);
@@ -0,0 +1,15 @@
+-- Marks given to behaviours over time, so that their improvement shows. The
+-- marks are rated on the scale stored in the settings.
+CREATE TABLE IF NOT EXISTS behaviour_mark_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    behaviour_id INTEGER NOT NULL,
+    mark TEXT NOT NULL,
+    changed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (behaviour_id) REFERENCES behaviours (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_behaviour_mark_history_behaviour_id ON behaviour_mark_history(behaviour_id);
+
+-- The current marks start the history
+INSERT INTO behaviour_mark_history (behaviour_id, mark)
+SELECT id, mark FROM behaviours WHERE mark IS NOT NULL AND mark <> '';
@@ -0,0 +1,13 @@
+-- Daily health scores of aims, so that their trend shows. The scores of the
+-- factors are NULL when the factor did not apply to the aim that day.
+CREATE TABLE IF NOT EXISTS aim_health_history (
+    aim_id INTEGER NOT NULL,
+    day DATE NOT NULL,
+    score REAL NOT NULL,
+    plans REAL,
+    habits REAL,
+    behaviours REAL,
+    journals REAL,
+    PRIMARY KEY (aim_id, day),
+    FOREIGN KEY (aim_id) REFERENCES aims (id) ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+-- Milestones of a plan: intermediate steps due on a date before the plan is
+-- done. completed_at is NULL until the milestone is reached.
+CREATE TABLE IF NOT EXISTS plan_milestones (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    plan_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    due_date DATE NOT NULL,
+    completed_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (plan_id) REFERENCES plans (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_plan_milestones_plan_id ON plan_milestones(plan_id);
@@ -0,0 +1,17 @@
+-- Deleted behaviours, intentions, habits, plan templates, milestones,
+-- reminders and webhooks are moved to the trash too
+ALTER TABLE behaviours ADD COLUMN deleted_at DATETIME;
+ALTER TABLE intentions ADD COLUMN deleted_at DATETIME;
+ALTER TABLE habits ADD COLUMN deleted_at DATETIME;
+ALTER TABLE plan_templates ADD COLUMN deleted_at DATETIME;
+ALTER TABLE plan_milestones ADD COLUMN deleted_at DATETIME;
+ALTER TABLE reminders ADD COLUMN deleted_at DATETIME;
+ALTER TABLE webhooks ADD COLUMN deleted_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_behaviours_deleted_at ON behaviours(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_intentions_deleted_at ON intentions(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_habits_deleted_at ON habits(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_plan_templates_deleted_at ON plan_templates(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_plan_milestones_deleted_at ON plan_milestones(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_reminders_deleted_at ON reminders(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_webhooks_deleted_at ON webhooks(deleted_at);
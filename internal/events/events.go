@@ -0,0 +1,154 @@
+// Package events publishes the domain events emitted by the mutations of
+// the models, e.g. "journal.created", to the subscribers inside the server
+// process such as outgoing webhooks.
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	JournalCreated  = "journal.created"
+	JournalUpdated  = "journal.updated"
+	JournalDeleted  = "journal.deleted"
+	JournalRestored = "journal.restored"
+	JournalPurged   = "journal.purged"
+
+	AttachmentCreated = "attachment.created"
+
+	AimCreated  = "aim.created"
+	AimUpdated  = "aim.updated"
+	AimDeleted  = "aim.deleted"
+	AimRestored = "aim.restored"
+	AimPurged   = "aim.purged"
+
+	PlanCreated   = "plan.created"
+	PlanUpdated   = "plan.updated"
+	PlanStarted   = "plan.started"
+	PlanProgress  = "plan.progress"
+	PlanCompleted = "plan.completed"
+	PlanDeleted   = "plan.deleted"
+	PlanRestored  = "plan.restored"
+	PlanPurged    = "plan.purged"
+
+	PlanTemplateCreated  = "plan_template.created"
+	PlanTemplateDeleted  = "plan_template.deleted"
+	PlanTemplateRestored = "plan_template.restored"
+	PlanTemplatePurged   = "plan_template.purged"
+
+	MilestoneCreated   = "milestone.created"
+	MilestoneCompleted = "milestone.completed"
+	MilestoneDeleted   = "milestone.deleted"
+	MilestoneRestored  = "milestone.restored"
+	MilestonePurged    = "milestone.purged"
+
+	StatementCreated   = "statement.created"
+	StatementUpdated   = "statement.updated"
+	StatementRehearsed = "statement.rehearsed"
+	StatementDeleted   = "statement.deleted"
+	StatementRestored  = "statement.restored"
+	StatementPurged    = "statement.purged"
+
+	BehaviourCreated  = "behaviour.created"
+	BehaviourUpdated  = "behaviour.updated"
+	BehaviourLogged   = "behaviour.logged"
+	BehaviourDeleted  = "behaviour.deleted"
+	BehaviourRestored = "behaviour.restored"
+	BehaviourPurged   = "behaviour.purged"
+
+	IntentionCreated         = "intention.created"
+	IntentionOutcomeRecorded = "intention.outcome_recorded"
+	IntentionDeleted         = "intention.deleted"
+	IntentionRestored        = "intention.restored"
+	IntentionPurged          = "intention.purged"
+
+	HabitCreated   = "habit.created"
+	HabitCheckedIn = "habit.checked_in"
+	HabitDeleted   = "habit.deleted"
+	HabitRestored  = "habit.restored"
+	HabitPurged    = "habit.purged"
+
+	MoodCreated = "mood.created"
+
+	ReflectionSaved = "reflection.saved"
+)
+
+// Types lists all the event types, by entity
+var Types = []string{
+	JournalCreated, JournalUpdated, JournalDeleted, JournalRestored, JournalPurged,
+	AttachmentCreated,
+	AimCreated, AimUpdated, AimDeleted, AimRestored, AimPurged,
+	PlanCreated, PlanUpdated, PlanStarted, PlanProgress, PlanCompleted, PlanDeleted, PlanRestored, PlanPurged,
+	PlanTemplateCreated, PlanTemplateDeleted, PlanTemplateRestored, PlanTemplatePurged,
+	MilestoneCreated, MilestoneCompleted, MilestoneDeleted, MilestoneRestored, MilestonePurged,
+	StatementCreated, StatementUpdated, StatementRehearsed, StatementDeleted, StatementRestored, StatementPurged,
+	BehaviourCreated, BehaviourUpdated, BehaviourLogged, BehaviourDeleted, BehaviourRestored, BehaviourPurged,
+	IntentionCreated, IntentionOutcomeRecorded, IntentionDeleted, IntentionRestored, IntentionPurged,
+	HabitCreated, HabitCheckedIn, HabitDeleted, HabitRestored, HabitPurged,
+	MoodCreated,
+	ReflectionSaved,
+}
+
+// Event is something that happened to the data of the user
+type Event struct {
+	ID         string         `json:"id"`
+	Type       string         `json:"type"`
+	OccurredAt time.Time      `json:"occurred_at"`
+	Data       map[string]any `json:"data"` // The ID of the entity and its main fields
+}
+
+// Handler receives the published events. Handlers are called synchronously
+// by the code mutating the data, so they must be quick, e.g. queue work.
+type Handler func(Event)
+
+var (
+	mu       sync.RWMutex
+	handlers = make(map[int]Handler)
+	nextID   int
+)
+
+// Subscribe registers a handler receiving every event, and returns the
+// function unregistering it
+func Subscribe(h Handler) func() {
+	mu.Lock()
+	defer mu.Unlock()
+	id := nextID
+	nextID++
+	handlers[id] = h
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(handlers, id)
+	}
+}
+
+// Publish sends an event to the subscribers. It is called once a mutation
+// has been stored.
+func Publish(eventType string, data map[string]any) {
+	event := Event{ID: newID(), Type: eventType, OccurredAt: time.Now().UTC(), Data: data}
+
+	mu.RLock()
+	subscribers := make([]Handler, 0, len(handlers))
+	for _, h := range handlers {
+		subscribers = append(subscribers, h)
+	}
+	mu.RUnlock()
+
+	for _, h := range subscribers {
+		h(event)
+	}
+}
+
+// newID returns a random event ID
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		slog.Error("Error generating event ID", "err", err)
+	}
+	return "evt_" + hex.EncodeToString(b)
+}
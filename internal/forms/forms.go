@@ -0,0 +1,147 @@
+package forms
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Form holds the values submitted through an HTML form and the field-level
+// errors found while validating them, so that the form can be rendered
+// again with error messages next to the faulty fields
+type Form struct {
+	Values url.Values
+	Errors map[string]string
+}
+
+// New creates a form from submitted values. A nil url.Values gives an empty
+// form, for the first rendering.
+func New(values url.Values) *Form {
+	if values == nil {
+		values = url.Values{}
+	}
+	return &Form{Values: values, Errors: map[string]string{}}
+}
+
+// Get returns the trimmed value of a field
+func (f *Form) Get(field string) string {
+	return strings.TrimSpace(f.Values.Get(field))
+}
+
+// Has reports whether value is among the values of a multi-valued field,
+// e.g. a checked checkbox or a selected option
+func (f *Form) Has(field, value string) bool {
+	return slices.Contains(f.Values[field], value)
+}
+
+// AddError records an error for a field, keeping the first one
+func (f *Form) AddError(field, message string) {
+	if _, ok := f.Errors[field]; !ok {
+		f.Errors[field] = message
+	}
+}
+
+// Error returns the error of a field, empty if the field is valid
+func (f *Form) Error(field string) string {
+	return f.Errors[field]
+}
+
+// Valid reports whether no error was found
+func (f *Form) Valid() bool {
+	return len(f.Errors) == 0
+}
+
+// Required checks that the fields are not blank
+func (f *Form) Required(fields ...string) {
+	for _, field := range fields {
+		if f.Get(field) == "" {
+			f.AddError(field, "This field is required")
+		}
+	}
+}
+
+// MaxLength checks that a field has at most n characters
+func (f *Form) MaxLength(field string, n int) {
+	if utf8.RuneCountInString(f.Get(field)) > n {
+		f.AddError(field, fmt.Sprintf("This field must have at most %d characters", n))
+	}
+}
+
+// OneOf checks that a field, when filled, has one of the allowed values
+func (f *Form) OneOf(field string, allowed ...string) {
+	value := f.Get(field)
+	if value != "" && !slices.Contains(allowed, value) {
+		f.AddError(field, "This value is not allowed")
+	}
+}
+
+// Int parses a field as an integer in [min, max]. A blank field gives def.
+func (f *Form) Int(field string, min, max, def int) int {
+	value := f.Get(field)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		f.AddError(field, fmt.Sprintf("This field must be a whole number between %d and %d", min, max))
+		return def
+	}
+	return n
+}
+
+// PositiveFloat parses a field as a strictly positive number. A blank field gives def.
+func (f *Form) PositiveFloat(field string, def float64) float64 {
+	value := f.Get(field)
+	if value == "" {
+		return def
+	}
+	x, err := strconv.ParseFloat(value, 64)
+	if err != nil || x <= 0 {
+		f.AddError(field, "This field must be a positive number")
+		return def
+	}
+	return x
+}
+
+// ID parses a field holding the ID of an entity
+func (f *Form) ID(field string) int64 {
+	id, err := strconv.ParseInt(f.Get(field), 10, 64)
+	if err != nil || id <= 0 {
+		f.AddError(field, "Please select a valid option")
+		return 0
+	}
+	return id
+}
+
+// IDs parses a multi-valued field holding IDs of entities
+func (f *Form) IDs(field string) []int64 {
+	ids := make([]int64, 0, len(f.Values[field]))
+	for _, value := range f.Values[field] {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id <= 0 {
+			f.AddError(field, "Please select valid options")
+			return nil
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Date parses an optional date field formatted as YYYY-MM-DD. A blank
+// field gives the zero time.
+func (f *Form) Date(field string) time.Time {
+	value := f.Get(field)
+	if value == "" {
+		return time.Time{}
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		f.AddError(field, "This field must be a date")
+		return time.Time{}
+	}
+	return date
+}
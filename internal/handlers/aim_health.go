@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"pds/internal/forms"
+	"pds/internal/models"
+	"pds/internal/templates"
+	"strconv"
+	"time"
+)
+
+// AimHealthHandler handles the page configuring the weights of the factors of
+// the health score of aims on GET /values/health, and saves them on POST
+func AimHealthHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "AimHealthHandler called", "path", r.URL.Path, "method", r.Method)
+
+	switch r.Method {
+	case http.MethodGet:
+		weights, err := models.GetHealthWeights()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error retrieving health weights", "err", err)
+			http.Error(w, "Error retrieving health weights", http.StatusInternalServerError)
+			return
+		}
+		values := url.Values{}
+		for _, factor := range models.HealthFactors {
+			values.Set(factor, strconv.Itoa(weights.Weight(factor)))
+		}
+		renderAimHealthPage(w, r, forms.New(values))
+	case http.MethodPost:
+		handleSaveHealthWeights(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSaveHealthWeights stores the weights of the factors from the form
+func handleSaveHealthWeights(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required(models.HealthFactors...)
+	weights := models.HealthWeights{
+		Plans:      form.Int(models.HealthPlans, 0, models.MaxHealthWeight, 0),
+		Habits:     form.Int(models.HealthHabits, 0, models.MaxHealthWeight, 0),
+		Behaviours: form.Int(models.HealthBehaviours, 0, models.MaxHealthWeight, 0),
+		Journals:   form.Int(models.HealthJournals, 0, models.MaxHealthWeight, 0),
+	}
+	if form.Valid() {
+		if err := weights.Validate(); err != nil {
+			form.AddError(models.HealthPlans, fmt.Sprintf("Invalid weights: %v", err))
+		}
+	}
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for health weights", "errors", form.Errors)
+		renderAimHealthPage(w, r, form)
+		return
+	}
+
+	if err := models.SaveHealthWeights(weights); err != nil {
+		slog.ErrorContext(r.Context(), "Error saving health weights", "err", err)
+		http.Error(w, "Error saving health weights", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully saved health weights", "weights", weights)
+	http.Redirect(w, r, "/values/health", http.StatusSeeOther)
+}
+
+// renderAimHealthPage renders the health scores of the aims with the form of
+// the weights
+func renderAimHealthPage(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	healths, err := models.GetAimHealth(time.Now())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error computing aim health", "err", err)
+		http.Error(w, "Error computing aim health", http.StatusInternalServerError)
+		return
+	}
+	models.SortAimHealthByScore(healths)
+
+	component := templates.AimHealthPage(healths, form)
+	if !form.Valid() {
+		renderInvalidForm(w, r, "", component)
+		return
+	}
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering Aim Health page", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	slog.DebugContext(r.Context(), "Successfully rendered Aim Health page", "count", len(healths))
+}
+
+// RunAimHealthRecording stores the health scores of the aims of the day, which
+// their trends compare with later. It is run periodically in the background.
+func RunAimHealthRecording() error {
+	if err := models.RecordAimHealth(time.Now()); err != nil {
+		return fmt.Errorf("recording aim health: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"pds/internal/models"
+	"strconv"
+	"time"
+)
+
+// writeJSON writes value as a JSON response
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Error("Error encoding JSON response", "err", err)
+	}
+}
+
+// apiStatement is the JSON representation of a statement
+type apiStatement struct {
+	ID       int64  `json:"id"`
+	Content  string `json:"content"`
+	Priority int    `json:"priority"`
+}
+
+// StatementOfTheDayAPIHandler returns the statement of the day as JSON
+func StatementOfTheDayAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	statement, err := models.GetStatementOfTheDay(time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no statement"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving statement of the day", "err", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "error retrieving statement of the day"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apiStatement{
+		ID:       statement.ID,
+		Content:  statement.Content,
+		Priority: statement.Priority,
+	})
+}
+
+// maxAPIJournals bounds the number of journal entries returned at once
+const maxAPIJournals = 100
+
+// apiJournal is the JSON representation of a journal entry
+type apiJournal struct {
+	ID        int64     `json:"id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Type      string    `json:"type"`
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// apiJournalPage is a page of journal entries. Next is the cursor to pass as
+// ?after= to get the following page, empty on the last page.
+type apiJournalPage struct {
+	Journals []apiJournal `json:"journals"`
+	Next     string       `json:"next,omitempty"`
+}
+
+// JournalsAPIHandler returns journal entries as JSON, newest first, on
+// GET /api/journals. They can be filtered with ?type= and ?tag=, and are
+// paginated with ?limit= and ?after=.
+func JournalsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	after, err := models.ParseJournalCursor(query.Get("after"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid cursor"})
+		return
+	}
+
+	limit := journalPageSize
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+			return
+		}
+		limit = min(limit, maxAPIJournals)
+	}
+
+	filter := models.JournalFilter{Type: query.Get("type"), Tag: query.Get("tag")}
+	journals, next, err := models.ListJournals(filter, after, limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving journals", "err", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "error retrieving journals"})
+		return
+	}
+
+	page := apiJournalPage{Journals: []apiJournal{}}
+	if !next.IsZero() {
+		page.Next = next.String()
+	}
+	for _, journal := range journals {
+		tags := journal.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		page.Journals = append(page.Journals, apiJournal{
+			ID:        journal.ID,
+			Title:     journal.Title,
+			Content:   journal.Content,
+			Type:      journal.JournalType,
+			Tags:      tags,
+			CreatedAt: journal.CreatedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, page)
+}
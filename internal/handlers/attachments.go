@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"pds/internal/attachments"
+	"pds/internal/forms"
+	"pds/internal/models"
+)
+
+// maxAttachments is the number of files that can be uploaded at once
+const maxAttachments = 5
+
+// maxUploadSize bounds the size of a request uploading attachments
+const maxUploadSize = maxAttachments*attachments.MaxSize + 1<<20
+
+// upload is a file stored in the attachments directory, not yet attached to
+// a journal entry
+type upload struct {
+	blob     attachments.Blob
+	filename string
+}
+
+// parseUploadForm parses a form that may upload attachments. It writes the
+// error response and returns false if the form cannot be parsed.
+func parseUploadForm(w http.ResponseWriter, r *http.Request) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	err := r.ParseMultipartForm(attachments.MaxSize)
+	if errors.Is(err, http.ErrNotMultipart) {
+		err = r.ParseForm()
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		slog.WarnContext(r.Context(), "Upload too large", "err", err)
+		http.Error(w, "The uploaded files are too large", http.StatusRequestEntityTooLarge)
+		return false
+	}
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// saveUploads stores the files uploaded in the "attachments" field of a
+// form. Files that are too large or of a type that is not allowed give an
+// error on the field.
+func saveUploads(r *http.Request, form *forms.Form) []upload {
+	if r.MultipartForm == nil {
+		return nil
+	}
+	headers := r.MultipartForm.File["attachments"]
+	if len(headers) > maxAttachments {
+		form.AddError("attachments", fmt.Sprintf("At most %d files can be attached at once", maxAttachments))
+		return nil
+	}
+
+	var uploads []upload
+	for _, header := range headers {
+		blob, err := saveUpload(header)
+		if errors.Is(err, attachments.ErrTooLarge) || errors.Is(err, attachments.ErrUnsupportedType) {
+			form.AddError("attachments", header.Filename+": "+err.Error())
+			continue
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error saving attachment", "err", err)
+			form.AddError("attachments", header.Filename+" could not be saved")
+			continue
+		}
+		uploads = append(uploads, upload{blob: blob, filename: filepath.Base(header.Filename)})
+	}
+	return uploads
+}
+
+func saveUpload(header *multipart.FileHeader) (attachments.Blob, error) {
+	if header.Size > attachments.MaxSize {
+		return attachments.Blob{}, attachments.ErrTooLarge
+	}
+	file, err := header.Open()
+	if err != nil {
+		return attachments.Blob{}, err
+	}
+	defer file.Close()
+	return attachments.Save(file)
+}
+
+// attachUploads records stored files as attached to a journal entry
+func attachUploads(journalID int64, uploads []upload) error {
+	return models.AttachFiles(journalID, newAttachments(uploads))
+}
+
+// newAttachments returns the stored files to attach to a journal entry
+func newAttachments(uploads []upload) []models.NewAttachment {
+	files := make([]models.NewAttachment, len(uploads))
+	for i, u := range uploads {
+		files[i] = models.NewAttachment{Hash: u.blob.Hash, Filename: u.filename, MimeType: u.blob.MimeType, Size: u.blob.Size}
+	}
+	return files
+}
+
+// CollectAttachmentGarbage removes the stored files no journal entry is
+// attached to any more, e.g. after an entry is deleted or an upload failed
+func CollectAttachmentGarbage() {
+	referenced, err := models.GetAttachmentHashes()
+	if err != nil {
+		slog.Error("Error retrieving attachment hashes", "err", err)
+		return
+	}
+	removed, err := attachments.CollectGarbage(referenced)
+	if err != nil {
+		slog.Error("Error collecting attachment garbage", "err", err)
+		return
+	}
+	if removed > 0 {
+		slog.Info("Removed unreferenced attachment files", "count", removed)
+	}
+}
+
+// AttachmentHandler serves an attached file on GET /attachments/{id}, and
+// the thumbnail of an image on GET /attachments/{id}/thumbnail
+func AttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	attachmentID, action, err := parseDetailPath(r.URL.Path, "/attachments/")
+	if err != nil || (action != "" && action != "thumbnail") {
+		http.NotFound(w, r)
+		return
+	}
+
+	attachment, err := models.GetAttachment(attachmentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving attachment", "err", err)
+		http.Error(w, "Error retrieving attachment", http.StatusInternalServerError)
+		return
+	}
+
+	path := attachments.Path(attachment.Hash)
+	contentType := attachment.MimeType
+	if action == "thumbnail" && attachment.IsImage() {
+		// Images without a thumbnail, e.g. too large to decode, are served as is
+		if _, err := os.Stat(attachments.ThumbnailPath(attachment.Hash)); err == nil {
+			path = attachments.ThumbnailPath(attachment.Hash)
+			contentType = "image/jpeg"
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error opening attachment", "attachment_id", attachment.ID, "err", err)
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	http.ServeContent(w, r, attachment.Filename, attachment.CreatedAt, file)
+}
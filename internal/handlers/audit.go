@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"pds/internal/events"
+	"pds/internal/models"
+	"pds/internal/templates"
+)
+
+// auditPageSize is the number of entries listed on the audit log page
+const auditPageSize = 200
+
+// RecordAudit appends the changes to the data to the audit log. It
+// subscribes to the domain events.
+func RecordAudit(event events.Event) {
+	err := models.AppendAuditEntry(event.ID, event.Type, eventEntityID(event, "id"), event.OccurredAt)
+	if err != nil {
+		slog.Error("Error appending to the audit log", "event_type", event.Type, "event_id", event.ID, "err", err)
+	}
+}
+
+// AuditHandler handles the audit log page on GET /admin/audit, optionally
+// filtered by type of entity with ?entity=
+func AuditHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "AuditHandler called", "path", r.URL.Path, "method", r.Method)
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entityType := r.URL.Query().Get("entity")
+	entries, err := models.GetAuditEntries(entityType, auditPageSize)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving audit log", "err", err)
+		http.Error(w, "Error retrieving audit log", http.StatusInternalServerError)
+		return
+	}
+	entityTypes, err := models.GetAuditEntityTypes()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving audited entity types", "err", err)
+		http.Error(w, "Error retrieving audit log", http.StatusInternalServerError)
+		return
+	}
+
+	if err := templates.AuditPage(entries, entityTypes, entityType).Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering Audit page", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	slog.DebugContext(r.Context(), "Successfully rendered Audit page")
+}
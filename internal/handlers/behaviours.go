@@ -1,8 +1,12 @@
 package handlers
 
 import (
-	"log"
+	"database/sql"
+	"errors"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"pds/internal/forms"
 	"pds/internal/models"
 	"pds/internal/templates"
 	"strconv"
@@ -10,14 +14,14 @@ import (
 
 // BehavioursHandler handles the Behaviours page
 func BehavioursHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("BehavioursHandler called with path: %s, method: %s", r.URL.Path, r.Method)
+	slog.DebugContext(r.Context(), "BehavioursHandler called", "path", r.URL.Path, "method", r.Method)
 
 	// Handle GET requests
 	if r.Method == http.MethodGet {
-		log.Printf("Handling GET request for Behaviours page")
+		slog.DebugContext(r.Context(), "Handling GET request for Behaviours page")
 		handleGetBehaviours(w, r)
 	} else {
-		log.Printf("Method %s not allowed for Behaviours page", r.Method)
+		slog.WarnContext(r.Context(), "Method not allowed for Behaviours page", "method", r.Method)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
@@ -31,48 +35,65 @@ func CreateBehaviourHandler(w http.ResponseWriter, r *http.Request) {
 
 	err := r.ParseForm()
 	if err != nil {
-		log.Printf("Error parsing form: %v", err)
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
 		http.Error(w, "Error parsing form", http.StatusBadRequest)
 		return
 	}
 
-	name := r.PostForm.Get("name")
-	description := r.PostForm.Get("description")
-	mark := r.PostForm.Get("mark")
-	conflictingAimIDStr := r.PostForm.Get("conflictingAimID")
-
-	conflictingAimID, err := strconv.ParseInt(conflictingAimIDStr, 10, 64)
+	scale, err := models.GetMarkScale()
 	if err != nil {
-		log.Printf("Invalid conflicting aim ID: %v", err)
-		http.Error(w, "Invalid conflicting aim ID", http.StatusBadRequest)
+		slog.ErrorContext(r.Context(), "Error retrieving mark scale", "err", err)
+		http.Error(w, "Error retrieving mark scale", http.StatusInternalServerError)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	name := form.Get("name")
+	description := form.Get("description")
+	form.Required("name", "description")
+	form.MaxLength("name", 200)
+	mark := validMark(form, scale, "")
+	conflictingAimID := form.ID("conflictingAimID")
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for new behaviour", "errors", form.Errors)
+		if r.Header.Get("HX-Request") == "true" {
+			aims, err := models.GetAllValues()
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Error retrieving aims", "err", err)
+				http.Error(w, "Error retrieving aims", http.StatusInternalServerError)
+				return
+			}
+			renderInvalidForm(w, r, "#behaviour-form", templates.BehaviourForm(aims, scale, form))
+			return
+		}
+		renderBehavioursPage(w, r, form)
 		return
 	}
 
-	log.Printf("Creating new behaviour - Name: %s, Description: %s, Mark: %s, Conflicting Aim ID: %d",
-		name, description, mark, conflictingAimID)
+	slog.DebugContext(r.Context(), "Creating new behaviour", "conflicting_aim_id", conflictingAimID)
 
 	id, err := models.CreateBehaviour(name, description, mark, conflictingAimID)
 	if err != nil {
-		log.Printf("Error creating behaviour: %v", err)
+		slog.ErrorContext(r.Context(), "Error creating behaviour", "err", err)
 		http.Error(w, "Error creating behaviour", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully created behaviour with ID: %d", id)
+	slog.InfoContext(r.Context(), "Successfully created behaviour", "id", id)
 
 	// Check if this is an HTMX request
 	if r.Header.Get("HX-Request") == "true" {
 		// Return just the updated behaviours list for HTMX
 		behaviours, err := models.GetAllBehaviours()
 		if err != nil {
-			log.Printf("Error retrieving behaviours: %v", err)
+			slog.ErrorContext(r.Context(), "Error retrieving behaviours", "err", err)
 			http.Error(w, "Error retrieving behaviours", http.StatusInternalServerError)
 			return
 		}
 
-		component := templates.BehavioursList(behaviours)
+		component := templates.BehavioursList(behaviours, scale)
 		if err := component.Render(r.Context(), w); err != nil {
-			log.Printf("Error rendering behaviours list: %v", err)
+			slog.ErrorContext(r.Context(), "Error rendering behaviours list", "err", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		}
 	} else {
@@ -94,81 +115,428 @@ func DeleteBehaviourHandler(w http.ResponseWriter, r *http.Request) {
 	// Parse the appropriate data based on the request method
 	if r.Method == http.MethodPost {
 		if err := r.ParseForm(); err != nil {
-			log.Printf("Error parsing form: %v", err)
+			slog.WarnContext(r.Context(), "Error parsing form", "err", err)
 			http.Error(w, "Error parsing form", http.StatusBadRequest)
 			return
 		}
 		behaviourIDStr = r.PostForm.Get("behaviourID")
-		log.Printf("POST Delete - Form data: %+v", r.PostForm)
 	} else { // DELETE method
 		if err := r.ParseForm(); err != nil {
-			log.Printf("Error parsing form: %v", err)
+			slog.WarnContext(r.Context(), "Error parsing form", "err", err)
 			http.Error(w, "Error parsing form", http.StatusBadRequest)
 			return
 		}
 		behaviourIDStr = r.Form.Get("behaviourID")
-		log.Printf("DELETE request - Form data: %+v", r.Form)
 	}
 
-	log.Printf("Deleting behaviour with ID: %s", behaviourIDStr)
+	slog.DebugContext(r.Context(), "Deleting behaviour", "id", behaviourIDStr)
 
 	// Parse the behaviour ID
 	behaviourID, err := strconv.ParseInt(behaviourIDStr, 10, 64)
 	if err != nil {
-		log.Printf("Invalid behaviour ID: %v", err)
+		slog.WarnContext(r.Context(), "Invalid behaviour ID", "err", err)
 		http.Error(w, "Invalid behaviour ID", http.StatusBadRequest)
 		return
 	}
 
 	if behaviourID <= 0 {
-		log.Printf("Missing behaviour ID")
+		slog.WarnContext(r.Context(), "Missing behaviour ID")
 		http.Error(w, "behaviourID is required", http.StatusBadRequest)
 		return
 	}
 
-	// Delete the behaviour
+	// Move the behaviour to the trash
 	err = models.DeleteBehaviour(behaviourID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Behaviour not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		log.Printf("Error deleting behaviour: %v", err)
+		slog.ErrorContext(r.Context(), "Error deleting behaviour", "err", err)
 		http.Error(w, "Error deleting behaviour", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully deleted behaviour with ID: %d", behaviourID)
+	slog.InfoContext(r.Context(), "Successfully deleted behaviour", "id", behaviourID)
+	respondTrashed(w, r, models.TrashBehaviour, behaviourID, "/behaviours")
+}
+
+// LogOccurrenceHandler records an occurrence of a behaviour
+func LogOccurrenceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	behaviourID, err := strconv.ParseInt(r.PostForm.Get("behaviourID"), 10, 64)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Invalid behaviour ID", "err", err)
+		http.Error(w, "Invalid behaviour ID", http.StatusBadRequest)
+		return
+	}
+
+	occurrence, err := models.LogBehaviourOccurrence(behaviourID, r.PostForm.Get("note"))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Behaviour not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error logging behaviour occurrence", "err", err)
+		http.Error(w, "Error logging behaviour occurrence", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully logged occurrence", "occurrence_id", occurrence.ID, "behaviour_id", behaviourID)
 
-	// Handle HTMX request differently
 	if r.Header.Get("HX-Request") == "true" {
-		// For HTMX DELETE requests, we can just return an empty response with 200 status
-		// This will remove the row from the table due to hx-swap="outerHTML"
-		w.WriteHeader(http.StatusOK)
+		// Surface the statements meant to counter this behaviour, and the
+		// intentions whose outcome can be recorded
+		statements, err := models.GetStatementsForBehaviour(behaviourID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error retrieving counter statements", "err", err)
+			http.Error(w, "Error retrieving counter statements", http.StatusInternalServerError)
+			return
+		}
+		intentions, err := models.GetIntentionsForBehaviour(behaviourID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error retrieving behaviour intentions", "err", err)
+			http.Error(w, "Error retrieving behaviour intentions", http.StatusInternalServerError)
+			return
+		}
+
+		component := templates.OccurrenceLogged(occurrence, statements, intentions)
+		if err := component.Render(r.Context(), w); err != nil {
+			slog.ErrorContext(r.Context(), "Error rendering logged occurrence", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
 	} else {
-		// Regular form submit - redirect to behaviours page
 		http.Redirect(w, r, "/behaviours", http.StatusSeeOther)
 	}
 }
 
+// BehaviourDetailHandler shows a behaviour, its counter statements and its
+// implementation intentions on GET /behaviours/{id}, updates these statements
+// on POST /behaviours/{id}/statements, adds an intention on POST
+// /behaviours/{id}/intentions, and edits the behaviour on /behaviours/{id}/edit
+func BehaviourDetailHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "BehaviourDetailHandler called", "path", r.URL.Path, "method", r.Method)
+
+	behaviourID, action, err := parseDetailPath(r.URL.Path, "/behaviours/")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		renderBehaviourPage(w, r, behaviourID, forms.New(nil))
+	case action == "intentions" && r.Method == http.MethodPost:
+		handleCreateIntention(w, r, behaviourID)
+	case action == "edit" && r.Method == http.MethodGet:
+		behaviour, err := models.GetBehaviour(behaviourID)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error retrieving behaviour", "err", err)
+			http.Error(w, "Error retrieving behaviour", http.StatusInternalServerError)
+			return
+		}
+		renderBehaviourEditPage(w, r, behaviourID, forms.New(url.Values{
+			"name":             {behaviour.Name},
+			"description":      {behaviour.Description},
+			"mark":             {behaviour.Mark},
+			"conflictingAimID": {strconv.FormatInt(behaviour.ConflictingAimID, 10)},
+		}))
+	case action == "edit" && r.Method == http.MethodPost:
+		handleUpdateBehaviour(w, r, behaviourID)
+	case action == "statements" && r.Method == http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+			http.Error(w, "Error parsing form", http.StatusBadRequest)
+			return
+		}
+		statementIDs, err := parseIDs(r.PostForm["statements"])
+		if err != nil {
+			http.Error(w, "Invalid statement ID", http.StatusBadRequest)
+			return
+		}
+		if err := models.SetBehaviourStatements(behaviourID, statementIDs); err != nil {
+			slog.ErrorContext(r.Context(), "Error linking behaviour statements", "err", err)
+			http.Error(w, "Error linking behaviour statements", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Successfully updated statements of behaviour", "id", behaviourID)
+		http.Redirect(w, r, "/behaviours/"+strconv.FormatInt(behaviourID, 10), http.StatusSeeOther)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleCreateIntention adds the implementation intention from the form to
+// a behaviour
+func handleCreateIntention(w http.ResponseWriter, r *http.Request, behaviourID int64) {
+	_, err := models.GetBehaviour(behaviourID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving behaviour", "err", err)
+		http.Error(w, "Error retrieving behaviour", http.StatusInternalServerError)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("cue", "response")
+	form.MaxLength("cue", 500)
+	form.MaxLength("response", 500)
+	var planID, statementID int64
+	if form.Get("planID") != "" {
+		planID = form.ID("planID")
+	}
+	if form.Get("statementID") != "" {
+		statementID = form.ID("statementID")
+	}
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for intention", "errors", form.Errors)
+		renderBehaviourPage(w, r, behaviourID, form)
+		return
+	}
+
+	id, err := models.CreateIntention(behaviourID, form.Get("cue"), form.Get("response"), planID, statementID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating intention", "err", err)
+		http.Error(w, "Error creating intention", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully created intention", "id", id, "behaviour_id", behaviourID)
+	http.Redirect(w, r, "/behaviours/"+strconv.FormatInt(behaviourID, 10), http.StatusSeeOther)
+}
+
+// renderBehaviourPage displays a behaviour, its counter statements and its
+// intentions with the given intention form
+func renderBehaviourPage(w http.ResponseWriter, r *http.Request, behaviourID int64, form *forms.Form) {
+	behaviour, err := models.GetBehaviour(behaviourID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving behaviour", "err", err)
+		http.Error(w, "Error retrieving behaviour", http.StatusInternalServerError)
+		return
+	}
+
+	linked, err := models.GetStatementsForBehaviour(behaviourID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving behaviour statements", "err", err)
+		http.Error(w, "Error retrieving behaviour statements", http.StatusInternalServerError)
+		return
+	}
+
+	statements, err := models.GetAllStatements()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving statements", "err", err)
+		http.Error(w, "Error retrieving statements", http.StatusInternalServerError)
+		return
+	}
+
+	journals, err := models.GetJournalsForBehaviour(behaviourID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving behaviour journals", "err", err)
+		http.Error(w, "Error retrieving behaviour journals", http.StatusInternalServerError)
+		return
+	}
+
+	intentions, err := models.GetIntentionEffectiveness(behaviourID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving behaviour intentions", "err", err)
+		http.Error(w, "Error retrieving behaviour intentions", http.StatusInternalServerError)
+		return
+	}
+
+	plans, err := models.GetAllPlans()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving plans", "err", err)
+		http.Error(w, "Error retrieving plans", http.StatusInternalServerError)
+		return
+	}
+
+	scale, err := models.GetMarkScale()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving mark scale", "err", err)
+		http.Error(w, "Error retrieving mark scale", http.StatusInternalServerError)
+		return
+	}
+
+	history, err := models.GetMarkHistory(behaviourID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving mark history", "err", err)
+		http.Error(w, "Error retrieving mark history", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.BehaviourPage(behaviour, scale, history, linked, statements, journals, intentions, plans, form)
+	if !form.Valid() {
+		renderInvalidForm(w, r, "", component)
+		return
+	}
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering Behaviour page", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
 // handleGetBehaviours retrieves and displays all behaviours
 func handleGetBehaviours(w http.ResponseWriter, r *http.Request) {
+	renderBehavioursPage(w, r, forms.New(nil))
+}
+
+// renderBehavioursPage renders the Behaviours page with the given creation form
+func renderBehavioursPage(w http.ResponseWriter, r *http.Request, form *forms.Form) {
 	behaviours, err := models.GetAllBehaviours()
 	if err != nil {
-		log.Printf("Error retrieving behaviours: %v", err)
+		slog.ErrorContext(r.Context(), "Error retrieving behaviours", "err", err)
 		http.Error(w, "Error retrieving behaviours", http.StatusInternalServerError)
 		return
 	}
 
 	aims, err := models.GetAllValues()
 	if err != nil {
-		log.Printf("Error retrieving aims: %v", err)
+		slog.ErrorContext(r.Context(), "Error retrieving aims", "err", err)
 		http.Error(w, "Error retrieving aims", http.StatusInternalServerError)
 		return
 	}
 
-	component := templates.BehavioursPage(behaviours, aims)
+	scale, err := models.GetMarkScale()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving mark scale", "err", err)
+		http.Error(w, "Error retrieving mark scale", http.StatusInternalServerError)
+		return
+	}
+
+	// The list can be filtered by mark with ?mark=, models.UnmarkedFilter
+	// selecting the unmarked behaviours, and sorted by decreasing mark with ?sort=mark
+	query := r.URL.Query()
+	markFilter, sortBy := query.Get("mark"), query.Get("sort")
+	if markFilter != "" {
+		behaviours = filterBehavioursByMark(behaviours, markFilter)
+	}
+	if sortBy == "mark" {
+		scale.SortBehavioursByMark(behaviours)
+	}
+
+	component := templates.BehavioursPage(behaviours, aims, scale, markFilter, sortBy, form)
+	if !form.Valid() {
+		renderInvalidForm(w, r, "", component)
+		return
+	}
 	if err := component.Render(r.Context(), w); err != nil {
-		log.Printf("Error rendering Behaviours page: %v", err)
+		slog.ErrorContext(r.Context(), "Error rendering Behaviours page", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully rendered Behaviours page with %d behaviours", len(behaviours))
+	slog.DebugContext(r.Context(), "Successfully rendered Behaviours page", "count", len(behaviours))
+}
+
+// handleUpdateBehaviour saves the behaviour edited in the form
+func handleUpdateBehaviour(w http.ResponseWriter, r *http.Request, behaviourID int64) {
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	stored, err := models.GetBehaviour(behaviourID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving behaviour", "err", err)
+		http.Error(w, "Error retrieving behaviour", http.StatusInternalServerError)
+		return
+	}
+
+	scale, err := models.GetMarkScale()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving mark scale", "err", err)
+		http.Error(w, "Error retrieving mark scale", http.StatusInternalServerError)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "description")
+	form.MaxLength("name", 200)
+	behaviour := models.Behaviour{
+		ID:               behaviourID,
+		Name:             form.Get("name"),
+		Description:      form.Get("description"),
+		Mark:             validMark(form, scale, stored.Mark),
+		ConflictingAimID: form.ID("conflictingAimID"),
+	}
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for behaviour", "errors", form.Errors)
+		renderBehaviourEditPage(w, r, behaviourID, form)
+		return
+	}
+
+	err = models.UpdateBehaviour(behaviour)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error updating behaviour", "err", err)
+		http.Error(w, "Error updating behaviour", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully updated behaviour", "id", behaviourID)
+	http.Redirect(w, r, "/behaviours/"+strconv.FormatInt(behaviourID, 10), http.StatusSeeOther)
+}
+
+// renderBehaviourEditPage renders the page editing a behaviour with its form
+func renderBehaviourEditPage(w http.ResponseWriter, r *http.Request, behaviourID int64, form *forms.Form) {
+	aims, err := models.GetAllValues()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving aims", "err", err)
+		http.Error(w, "Error retrieving aims", http.StatusInternalServerError)
+		return
+	}
+
+	scale, err := models.GetMarkScale()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving mark scale", "err", err)
+		http.Error(w, "Error retrieving mark scale", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.BehaviourEditPage(behaviourID, aims, scale, form)
+	if !form.Valid() {
+		renderInvalidForm(w, r, "", component)
+		return
+	}
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering Behaviour Edit page", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	slog.DebugContext(r.Context(), "Successfully rendered Behaviour Edit page", "id", behaviourID)
 }
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"pds/internal/models"
+	"pds/internal/templates"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CalendarHandler handles /calendar/month/{2006-01}, /calendar/year/{2006}
+// and /calendar/day/{2006-01-02}. The day view is the side panel listing the
+// entries of the day, loaded via HTMX when a day is clicked.
+func CalendarHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "CalendarHandler called", "path", r.URL.Path, "method", r.Method)
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 1 {
+		// Default to the current month
+		http.Redirect(w, r, "/calendar/month/"+time.Now().Format("2006-01"), http.StatusSeeOther)
+		return
+	}
+	if len(parts) != 3 {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch parts[1] {
+	case "month":
+		month, err := time.ParseInLocation("2006-01", parts[2], time.Local)
+		if err != nil {
+			http.Error(w, "Invalid month", http.StatusBadRequest)
+			return
+		}
+		renderCalendarMonth(w, r, month, time.Time{})
+	case "year":
+		year, err := strconv.Atoi(parts[2])
+		if err != nil || year < 1 || year > 9999 {
+			http.Error(w, "Invalid year", http.StatusBadRequest)
+			return
+		}
+		handleGetCalendarYear(w, r, year)
+	case "day":
+		day, err := time.ParseInLocation("2006-01-02", parts[2], time.Local)
+		if err != nil {
+			http.Error(w, "Invalid day", http.StatusBadRequest)
+			return
+		}
+		handleGetCalendarDay(w, r, day)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// renderCalendarMonth renders the month view, with the side panel of the
+// selected day open unless it is zero
+func renderCalendarMonth(w http.ResponseWriter, r *http.Request, month, selected time.Time) {
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.Local)
+	days, err := models.GetCalendarDays(start, start.AddDate(0, 1, 0))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving calendar", "err", err)
+		http.Error(w, "Error retrieving calendar", http.StatusInternalServerError)
+		return
+	}
+
+	var entries []models.Journal
+	if !selected.IsZero() {
+		if entries, err = models.GetJournalsForDay(selected); err != nil {
+			slog.ErrorContext(r.Context(), "Error retrieving journals of day", "day", selected.Format("2006-01-02"), "err", err)
+			http.Error(w, "Error retrieving journals", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	feedURL, err := calendarFeedURL(r)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving calendar feed token", "err", err)
+		http.Error(w, "Error retrieving calendar feed", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.CalendarMonthPage(start, days, selected, entries, feedURL)
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering calendar", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// handleGetCalendarYear renders the heatmap of a year
+func handleGetCalendarYear(w http.ResponseWriter, r *http.Request, year int) {
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.Local)
+	days, err := models.GetCalendarDays(start, start.AddDate(1, 0, 0))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving calendar", "err", err)
+		http.Error(w, "Error retrieving calendar", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.CalendarYearPage(year, days)
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering calendar", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// handleGetCalendarDay renders the entries of a day: the side panel alone
+// for HTMX requests, otherwise the month view with the panel open
+func handleGetCalendarDay(w http.ResponseWriter, r *http.Request, day time.Time) {
+	if r.Header.Get("HX-Request") != "true" {
+		renderCalendarMonth(w, r, day, day)
+		return
+	}
+
+	entries, err := models.GetJournalsForDay(day)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving journals of day", "day", day.Format("2006-01-02"), "err", err)
+		http.Error(w, "Error retrieving journals", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.CalendarDayPanel(day, entries)
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering calendar day", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"pds/internal/models"
+	"pds/internal/templates"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/a-h/templ"
+)
+
+// Number of items shown by the list widgets of the dashboard
+const (
+	dashboardStatementCount = 3
+	dashboardJournalCount   = 5
+	dashboardMoodDays       = 30
+	dashboardAttentionDays  = 14
+)
+
+// DashboardWidgetHandler renders a single dashboard widget, so that each of
+// them can be loaded and refreshed independently
+func DashboardWidgetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/dashboard/widgets/")
+	renderDashboardWidget(w, r, name)
+}
+
+// renderDashboardWidget loads the data of a widget and renders it
+func renderDashboardWidget(w http.ResponseWriter, r *http.Request, name string) {
+	widgets, err := models.GetDashboardWidgets()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving dashboard widgets", "err", err)
+		http.Error(w, "Error retrieving dashboard widgets", http.StatusInternalServerError)
+		return
+	}
+
+	var widget models.DashboardWidget
+	for _, it := range widgets {
+		if it.Name == name {
+			widget = it
+		}
+	}
+	if widget.Name == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	component, err := loadDashboardWidget(widget)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error loading dashboard widget", "widget", name, "err", err)
+		http.Error(w, "Error loading dashboard widget", http.StatusInternalServerError)
+		return
+	}
+
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering dashboard widget", "widget", name, "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// loadDashboardWidget retrieves what a widget displays and returns its component
+func loadDashboardWidget(widget models.DashboardWidget) (templ.Component, error) {
+	now := time.Now()
+	switch widget.Name {
+	case "statements":
+		today, err := models.GetStatementOfTheDay(now)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		statements, err := models.GetTopStatements(dashboardStatementCount)
+		return templates.DashboardStatements(widget, today, statements), err
+	case "plans":
+		plans, err := models.GetActivePlans()
+		return templates.DashboardPlans(widget, plans), err
+	case "behaviours":
+		streaks, err := models.GetBehaviourStreaks()
+		return templates.DashboardBehaviours(widget, streaks, now), err
+	case "habits":
+		habits, err := models.GetAllHabits()
+		return templates.DashboardHabits(widget, habits, now), err
+	case "journals":
+		journals, err := models.GetRecentJournals(dashboardJournalCount)
+		return templates.DashboardJournals(widget, journals), err
+	case "mood":
+		start := now.AddDate(0, 0, -dashboardMoodDays)
+		moods, err := models.GetDailyMoods(start, now)
+		return templates.DashboardMood(widget, moods, start, dashboardMoodDays), err
+	case "attention":
+		aims, err := models.GetAimsNeedingAttention(now.AddDate(0, 0, -dashboardAttentionDays))
+		return templates.DashboardAttention(widget, aims), err
+	case "health":
+		healths, err := models.GetAimHealth(now)
+		models.SortAimHealthByScore(healths)
+		return templates.DashboardHealth(widget, healths), err
+	default:
+		return nil, nil
+	}
+}
+
+// DashboardSettingsHandler saves which widgets are shown and in which order
+func DashboardSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	widgets, err := models.GetDashboardWidgets()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving dashboard widgets", "err", err)
+		http.Error(w, "Error retrieving dashboard widgets", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range widgets {
+		position, err := strconv.Atoi(r.PostForm.Get("position-" + widgets[i].Name))
+		if err != nil {
+			http.Error(w, "Invalid position for widget "+widgets[i].Name, http.StatusBadRequest)
+			return
+		}
+		widgets[i].Position = position
+		widgets[i].Enabled = r.PostForm.Get("enabled-"+widgets[i].Name) == "on"
+	}
+
+	if err := models.SaveDashboardWidgets(widgets); err != nil {
+		slog.ErrorContext(r.Context(), "Error saving dashboard widgets", "err", err)
+		http.Error(w, "Error saving dashboard widgets", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully saved dashboard widgets")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"pds/internal/attachments"
+	"pds/internal/forms"
+	"pds/internal/inbox"
+	"pds/internal/models"
+	"pds/internal/templates"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// journalTypes are the types of journal entries
+var journalTypes = []string{"gratitude", "frustrations"}
+
+// maxTitleLength is the maximum length of the title of a journal entry
+const maxTitleLength = 200
+
+// EmailSettingsHandler handles the page configuring the journal entries
+// created from emails on GET /journals/email, and saves it on POST
+func EmailSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "EmailSettingsHandler called", "path", r.URL.Path, "method", r.Method)
+
+	switch r.Method {
+	case http.MethodGet:
+		settings, err := models.GetEmailSettings()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error retrieving email settings", "err", err)
+			http.Error(w, "Error retrieving email settings", http.StatusInternalServerError)
+			return
+		}
+		renderEmailSettingsPage(w, r, forms.New(url.Values{
+			"maildir":        {settings.Maildir},
+			"allowedSenders": {settings.AllowedSenders},
+			"defaultType":    {settings.DefaultType},
+		}))
+	case http.MethodPost:
+		handleSaveEmailSettings(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSaveEmailSettings stores the email settings from the form
+func handleSaveEmailSettings(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.OneOf("defaultType", journalTypes...)
+	if maildir := form.Get("maildir"); maildir != "" {
+		for _, sub := range []string{"new", "cur"} {
+			if info, err := os.Stat(filepath.Join(maildir, sub)); err != nil || !info.IsDir() {
+				form.AddError("maildir", "This is not a Maildir: it should contain new and cur directories")
+				break
+			}
+		}
+		if len(allowedSenders(form.Get("allowedSenders"))) == 0 {
+			form.AddError("allowedSenders", "Please enter the addresses you send emails from")
+		}
+	}
+	for _, sender := range allowedSenders(form.Get("allowedSenders")) {
+		if _, err := mail.ParseAddress(sender); err != nil {
+			form.AddError("allowedSenders", sender+" is not an email address")
+			break
+		}
+	}
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for email settings", "errors", form.Errors)
+		renderEmailSettingsPage(w, r, form)
+		return
+	}
+
+	settings := models.EmailSettings{
+		Maildir:        form.Get("maildir"),
+		AllowedSenders: strings.Join(allowedSenders(form.Get("allowedSenders")), ", "),
+		DefaultType:    form.Get("defaultType"),
+	}
+	if err := models.SaveEmailSettings(settings); err != nil {
+		slog.ErrorContext(r.Context(), "Error saving email settings", "err", err)
+		http.Error(w, "Error saving email settings", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully saved email settings")
+	http.Redirect(w, r, "/journals/email", http.StatusSeeOther)
+}
+
+// renderEmailSettingsPage renders the email settings page with its form
+func renderEmailSettingsPage(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	component := templates.EmailSettingsPage(journalTypes, form)
+	if !form.Valid() {
+		renderInvalidForm(w, r, "", component)
+		return
+	}
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering Email Settings page", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	slog.DebugContext(r.Context(), "Successfully rendered Email Settings page")
+}
+
+// allowedSenders parses a list of addresses separated by commas or spaces
+func allowedSenders(list string) []string {
+	senders := strings.FieldsFunc(strings.ToLower(list), func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	slices.Sort(senders)
+	return slices.Compact(senders)
+}
+
+// RunEmailIngestion turns the emails delivered to the Maildir into journal
+// entries. Emails from senders that are not allowed or not authenticated by
+// the mail server, or that cannot be parsed, are skipped. It is run periodically in the background.
+func RunEmailIngestion() error {
+	settings, err := models.GetEmailSettings()
+	if err != nil {
+		return fmt.Errorf("retrieving email settings: %w", err)
+	}
+	if settings.Maildir == "" {
+		return nil
+	}
+
+	maildir := inbox.Maildir(settings.Maildir)
+	names, err := maildir.New()
+	if err != nil {
+		return fmt.Errorf("listing emails: %w", err)
+	}
+
+	senders := allowedSenders(settings.AllowedSenders)
+	for _, name := range names {
+		msg, err := maildir.Read(name)
+		switch {
+		case err != nil:
+			slog.Warn("Skipping email that cannot be read", "email", name, "err", err)
+		case !slices.Contains(senders, msg.From):
+			slog.Warn("Skipping email from a sender that is not allowed", "email", name, "sender", msg.From)
+		case !msg.Verified:
+			// Anyone can write an allowed address in the From header
+			slog.Warn("Skipping email whose sender the mail server did not authenticate", "email", name, "sender", msg.From)
+		default:
+			id, err := createEmailJournal(msg, settings.DefaultType)
+			if err != nil {
+				// The email is kept to be tried again
+				slog.Error("Error creating journal from email", "email", name, "err", err)
+				continue
+			}
+			slog.Info("Created journal from email", "id", id, "email", name)
+		}
+		if err := maildir.MarkRead(name); err != nil {
+			slog.Error("Error marking email as read", "email", name, "err", err)
+		}
+	}
+	return nil
+}
+
+// createEmailJournal creates a journal entry from an email: the subject is
+// its title, the text its content, and the files become its attachments.
+// The entry is stored with its links and attachments, or not at all.
+func createEmailJournal(msg inbox.Message, defaultType string) (int64, error) {
+	title := msg.Subject
+	if title == "" {
+		title = "Email of " + time.Now().Format("Jan 02, 2006")
+	}
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		title = string([]rune(title)[:maxTitleLength])
+	}
+
+	// Store the files first, as some may be rejected
+	var uploads []upload
+	for _, file := range msg.Attachments {
+		blob, err := attachments.Save(bytes.NewReader(file.Data))
+		if errors.Is(err, attachments.ErrTooLarge) || errors.Is(err, attachments.ErrUnsupportedType) {
+			slog.Warn("Skipping attachment", "err", err)
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		uploads = append(uploads, upload{blob: blob, filename: file.Filename})
+	}
+
+	// The #tags and @aims written in the email are linked like in the form
+	journalType := emailJournalType(msg.Recipients, defaultType)
+	return models.CreateJournal(title, msg.Text, journalType, models.JournalLinks{}, newAttachments(uploads))
+}
+
+// emailJournalType returns the journal type selected by the suffix of the
+// address an email was sent to, e.g. journal+frustrations@example.com, or
+// the default type
+func emailJournalType(recipients []string, defaultType string) string {
+	for _, recipient := range recipients {
+		local, _, _ := strings.Cut(recipient, "@")
+		if _, suffix, ok := strings.Cut(local, "+"); ok && slices.Contains(journalTypes, suffix) {
+			return suffix
+		}
+	}
+	if defaultType == "" {
+		return journalTypes[0]
+	}
+	return defaultType
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"pds/internal/attachments"
+	"pds/internal/database"
+	"time"
+)
+
+// ExportHandler downloads a backup of all the data as a zip archive holding
+// a copy of the database, app.db, and the attachments directory. Extracting
+// it in the data directory restores the backup.
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tmpDir, err := os.MkdirTemp("", "pds-export-")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating export directory", "err", err)
+		http.Error(w, "Error exporting data", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dbPath := filepath.Join(tmpDir, "app.db")
+	if err := database.Backup(dbPath); err != nil {
+		slog.ErrorContext(r.Context(), "Error backing up database", "err", err)
+		http.Error(w, "Error exporting data", http.StatusInternalServerError)
+		return
+	}
+
+	filename := "pds-export-" + time.Now().Format("2006-01-02") + ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	// Errors past this point cannot change the response any more, the
+	// download is then truncated
+	archive := zip.NewWriter(w)
+	if err := addFileToZip(archive, dbPath, "app.db"); err != nil {
+		slog.ErrorContext(r.Context(), "Error exporting database", "err", err)
+		return
+	}
+	err = filepath.WalkDir(attachments.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(attachments.Dir, path)
+		if err != nil {
+			return err
+		}
+		return addFileToZip(archive, path, filepath.ToSlash(filepath.Join("attachments", rel)))
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error exporting attachments", "err", err)
+		return
+	}
+	if err := archive.Close(); err != nil {
+		slog.ErrorContext(r.Context(), "Error finishing export", "err", err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully exported data")
+}
+
+// addFileToZip copies a file into a zip archive under the given name
+func addFileToZip(archive *zip.Writer, path, name string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entry, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, file)
+	return err
+}
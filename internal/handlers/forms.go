@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/a-h/templ"
+)
+
+// renderInvalidForm renders a form again with its validation errors, with
+// the 422 status. For HTMX requests, target is the selector of the form to
+// replace, since the request may have targeted another element on success.
+func renderInvalidForm(w http.ResponseWriter, r *http.Request, target string, component templ.Component) {
+	if r.Header.Get("HX-Request") == "true" && target != "" {
+		w.Header().Set("HX-Retarget", target)
+		w.Header().Set("HX-Reswap", "outerHTML")
+	}
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering invalid form", "err", err)
+	}
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"pds/internal/forms"
+	"pds/internal/models"
+	"pds/internal/templates"
+	"strconv"
+	"time"
+)
+
+// HabitsHandler handles the Habits page
+func HabitsHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "HabitsHandler called", "path", r.URL.Path, "method", r.Method)
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	renderHabitsPage(w, r, forms.New(nil))
+}
+
+// CreateHabitHandler handles creating new habits
+func CreateHabitHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	name := form.Get("name")
+	description := form.Get("description")
+	schedule := form.Get("schedule")
+	form.Required("name", "schedule")
+	form.MaxLength("name", 200)
+	form.OneOf("schedule", models.HabitDaily, models.HabitWeekly, models.HabitWeekdays)
+	aimID := form.ID("aimID")
+
+	var timesPerWeek int
+	var weekdays []time.Weekday
+	switch schedule {
+	case models.HabitWeekly:
+		form.Required("timesPerWeek")
+		timesPerWeek = form.Int("timesPerWeek", 1, 7, 0)
+	case models.HabitWeekdays:
+		weekdays = parseWeekdays(form)
+	}
+
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for new habit", "errors", form.Errors)
+		if r.Header.Get("HX-Request") == "true" {
+			aims, err := models.GetAllValues()
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Error retrieving aims", "err", err)
+				http.Error(w, "Error retrieving aims", http.StatusInternalServerError)
+				return
+			}
+			renderInvalidForm(w, r, "#habit-form", templates.HabitForm(aims, form))
+			return
+		}
+		renderHabitsPage(w, r, form)
+		return
+	}
+
+	id, err := models.CreateHabit(name, description, aimID, schedule, timesPerWeek, weekdays)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating habit", "err", err)
+		http.Error(w, "Error creating habit", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully created habit", "id", id)
+
+	if r.Header.Get("HX-Request") == "true" {
+		habits, err := models.GetAllHabits()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error retrieving habits", "err", err)
+			http.Error(w, "Error retrieving habits", http.StatusInternalServerError)
+			return
+		}
+
+		component := templates.HabitsList(habits, time.Now())
+		if err := component.Render(r.Context(), w); err != nil {
+			slog.ErrorContext(r.Context(), "Error rendering habits list", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+	} else {
+		http.Redirect(w, r, "/habits", http.StatusSeeOther)
+	}
+}
+
+// parseWeekdays reads the days of the week checked in the "weekdays" field
+func parseWeekdays(form *forms.Form) []time.Weekday {
+	var weekdays []time.Weekday
+	for _, value := range form.Values["weekdays"] {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > 6 {
+			form.AddError("weekdays", "Please select valid days")
+			return nil
+		}
+		weekdays = append(weekdays, time.Weekday(n))
+	}
+	if len(weekdays) == 0 {
+		form.AddError("weekdays", "Please select at least one day")
+	}
+	return weekdays
+}
+
+// HabitDetailHandler handles POST /habits/{id}/checkins, which records
+// whether a habit was done on a day, and POST or DELETE /habits/{id}/delete
+func HabitDetailHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "HabitDetailHandler called", "path", r.URL.Path, "method", r.Method)
+
+	habitID, action, err := parseDetailPath(r.URL.Path, "/habits/")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case action == "checkins" && r.Method == http.MethodPost:
+		handleHabitCheckIn(w, r, habitID)
+	case action == "delete" && (r.Method == http.MethodPost || r.Method == http.MethodDelete):
+		err := models.DeleteHabit(habitID)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error deleting habit", "err", err)
+			http.Error(w, "Error deleting habit", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Successfully deleted habit", "id", habitID)
+		respondTrashed(w, r, models.TrashHabit, habitID, "/habits")
+	case action == "checkins" || action == "delete":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleHabitCheckIn records whether a habit was done on the day given in
+// the form, today by default. It answers with the updated row of the
+// habits page, or the habits widget when checked in from the dashboard.
+func handleHabitCheckIn(w http.ResponseWriter, r *http.Request, habitID int64) {
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	day := form.Date("day")
+	now := time.Now()
+	if day.IsZero() {
+		day = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	}
+	if !form.Valid() || day.After(now) {
+		http.Error(w, "Invalid day", http.StatusBadRequest)
+		return
+	}
+	done := form.Get("done") == "true"
+
+	_, err := models.GetHabit(habitID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving habit", "err", err)
+		http.Error(w, "Error retrieving habit", http.StatusInternalServerError)
+		return
+	}
+	if err := models.SetHabitCheckIn(habitID, day, done); err != nil {
+		slog.ErrorContext(r.Context(), "Error checking in habit", "err", err)
+		http.Error(w, "Error checking in habit", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Checked in habit", "habit_id", habitID, "day", day.Format("2006-01-02"), "done", done)
+
+	fromDashboard := form.Get("view") == "dashboard"
+	if r.Header.Get("HX-Request") != "true" {
+		if fromDashboard {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		} else {
+			http.Redirect(w, r, "/habits", http.StatusSeeOther)
+		}
+		return
+	}
+	if fromDashboard {
+		renderDashboardWidget(w, r, "habits")
+		return
+	}
+
+	habit, err := models.GetHabit(habitID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving habit", "err", err)
+		http.Error(w, "Error retrieving habit", http.StatusInternalServerError)
+		return
+	}
+	component := templates.HabitRow(habit, now)
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering habit", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// renderHabitsPage renders the habits page with the habit form
+func renderHabitsPage(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	habits, err := models.GetAllHabits()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving habits", "err", err)
+		http.Error(w, "Error retrieving habits", http.StatusInternalServerError)
+		return
+	}
+
+	aims, err := models.GetAllValues()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving aims", "err", err)
+		http.Error(w, "Error retrieving aims", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.HabitsPage(habits, aims, form, time.Now())
+	if !form.Valid() {
+		renderInvalidForm(w, r, "", component)
+		return
+	}
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering Habits page", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.DebugContext(r.Context(), "Successfully rendered Habits page", "count", len(habits))
+}
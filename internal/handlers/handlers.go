@@ -1,172 +1,309 @@
 package handlers
 
 import (
-	"log"
+	"database/sql"
+	"errors"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
+	"pds/internal/forms"
 	"pds/internal/models"
 	"pds/internal/templates"
 )
 
 // These conversion functions are no longer needed with the simplified model approach
 
+// parseIDs converts the values of a multiple select to IDs
+func parseIDs(values []string) ([]int64, error) {
+	ids := make([]int64, 0, len(values))
+	for _, value := range values {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// parseDetailPath splits paths such as /statements/12/links into the ID of
+// the entity and the optional action that follows it
+func parseDetailPath(path, prefix string) (int64, string, error) {
+	rest := strings.Trim(strings.TrimPrefix(path, prefix), "/")
+	idStr, action, _ := strings.Cut(rest, "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	return id, action, err
+}
+
 // HomeHandler handles the home page
 func HomeHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("HomeHandler called with path: %s", r.URL.Path)
+	slog.DebugContext(r.Context(), "HomeHandler called", "path", r.URL.Path)
 	if r.URL.Path != "/" {
-		log.Printf("Path %s is not '/', returning 404", r.URL.Path)
+		slog.DebugContext(r.Context(), "Path is not '/', returning 404", "path", r.URL.Path)
 		http.NotFound(w, r)
 		return
 	}
 
-	component := templates.Home()
+	widgets, err := models.GetDashboardWidgets()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving dashboard widgets", "err", err)
+		http.Error(w, "Error retrieving dashboard widgets", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.Home(widgets)
 	if err := component.Render(r.Context(), w); err != nil {
-		log.Printf("Error rendering home template: %v", err)
+		slog.ErrorContext(r.Context(), "Error rendering home template", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully rendered home template")
+	slog.DebugContext(r.Context(), "Successfully rendered home template")
 }
 
 // JournalsHandler handles the journals page
 func JournalsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("JournalsHandler called with path: %s, method: %s", r.URL.Path, r.Method)
+	slog.DebugContext(r.Context(), "JournalsHandler called", "path", r.URL.Path, "method", r.Method)
 
 	// Different behavior based on HTTP method
 	switch r.Method {
 	case http.MethodGet:
-		log.Printf("Handling GET request for journals")
+		slog.DebugContext(r.Context(), "Handling GET request for journals")
 		handleGetJournals(w, r)
 	case http.MethodPost:
-		log.Printf("Handling POST request for journals")
+		slog.DebugContext(r.Context(), "Handling POST request for journals")
 		handleCreateJournal(w, r)
 	default:
-		log.Printf("Method %s not allowed for journals", r.Method)
+		slog.WarnContext(r.Context(), "Method not allowed for journals", "method", r.Method)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-// handleGetJournals handles GET requests for journal entries
+// journalPageSize is the number of journal entries loaded at once
+const journalPageSize = 20
+
+// handleGetJournals handles GET requests for journal entries. The entries
+// are loaded one page at a time: the ?after= query parameter holds the
+// cursor of the page, given by the previous one.
 func handleGetJournals(w http.ResponseWriter, r *http.Request) {
-	log.Printf("handleGetJournals with path: %s", r.URL.Path)
-	var journals []models.Journal
-	var err error
-
-	// Check if we're filtering by type
-	if strings.Contains(r.URL.Path, "/type/") {
-		parts := strings.Split(r.URL.Path, "/")
-		if len(parts) >= 4 {
-			journalType := parts[3]
-			log.Printf("Filtering journals by type: %s", journalType)
-			journals, err = models.GetJournalsByType(journalType)
-		}
-	} else {
-		log.Printf("Retrieving all journals")
-		journals, err = models.GetAllJournals()
+	slog.DebugContext(r.Context(), "handleGetJournals called", "path", r.URL.Path)
+
+	after, err := models.ParseJournalCursor(r.URL.Query().Get("after"))
+	if err != nil {
+		slog.WarnContext(r.Context(), "Invalid journal cursor", "err", err)
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
 	}
 
+	filter := journalFilterFromPath(r.URL.Path)
+	slog.DebugContext(r.Context(), "Retrieving journals", "type", filter.Type, "after", after.String())
+	journals, next, err := models.ListJournals(filter, after, journalPageSize)
 	if err != nil {
-		log.Printf("Error retrieving journals: %v", err)
+		slog.ErrorContext(r.Context(), "Error retrieving journals", "err", err)
 		http.Error(w, "Error retrieving journals", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Retrieved %d journals", len(journals))
+	slog.DebugContext(r.Context(), "Retrieved journals", "count", len(journals))
+	nextURL := journalPageURL(r.URL.Path, next)
 
 	// If it's an HTMX request, just return the journal list partial
 	if r.Header.Get("HX-Request") == "true" {
-		log.Printf("HTMX request detected, rendering partial template")
-		component := templates.JournalList(journals)
+		slog.DebugContext(r.Context(), "HTMX request detected, rendering partial template")
+		component := templates.JournalList(journals, nextURL)
 		if err := component.Render(r.Context(), w); err != nil {
-			log.Printf("Error rendering partial template: %v", err)
+			slog.ErrorContext(r.Context(), "Error rendering partial template", "err", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
-		log.Printf("Successfully rendered partial template")
+		slog.DebugContext(r.Context(), "Successfully rendered partial template")
 		return
 	}
 
 	// Otherwise, return the full page
-	log.Printf("Rendering full journals page")
-	component := templates.Journals(journals)
+	slog.DebugContext(r.Context(), "Rendering full journals page")
+	renderJournalsPage(w, r, journals, nextURL, forms.New(nil))
+}
+
+// journalFilterFromPath reads the filter of paths such as
+// /journals/type/gratitude or /journals/tag/work
+func journalFilterFromPath(path string) models.JournalFilter {
+	var filter models.JournalFilter
+	parts := strings.Split(path, "/")
+	if len(parts) >= 4 {
+		switch parts[2] {
+		case "type":
+			filter.Type = parts[3]
+		case "tag":
+			filter.Tag = parts[3]
+		}
+	}
+	return filter
+}
+
+// journalPageURL returns the URL of the page of journal entries starting at
+// a cursor, or an empty string when there is no such page
+func journalPageURL(path string, cursor models.JournalCursor) string {
+	if cursor.IsZero() {
+		return ""
+	}
+	return path + "?after=" + url.QueryEscape(cursor.String())
+}
+
+// renderJournalsPage renders the journals page with the given journal
+// entries and creation form
+func renderJournalsPage(w http.ResponseWriter, r *http.Request, journals []models.Journal, nextURL string, form *forms.Form) {
+	tags, err := models.GetAllTags()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving tags", "err", err)
+		http.Error(w, "Error retrieving tags", http.StatusInternalServerError)
+		return
+	}
+
+	aims, plans, behaviours, err := getJournalLinkChoices()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving link choices", "err", err)
+		http.Error(w, "Error retrieving link choices", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.Journals(journals, nextURL, tags, aims, plans, behaviours, form)
+	if !form.Valid() {
+		renderInvalidForm(w, r, "", component)
+		return
+	}
 	if err := component.Render(r.Context(), w); err != nil {
-		log.Printf("Error rendering journals template: %v", err)
+		slog.ErrorContext(r.Context(), "Error rendering journals template", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-	log.Printf("Successfully rendered journals template")
+	slog.DebugContext(r.Context(), "Successfully rendered journals template")
+}
+
+// getJournalLinkChoices retrieves the aims, plans and behaviours a journal
+// entry can be linked to
+func getJournalLinkChoices() ([]models.Aim, []models.Plan, []models.Behaviour, error) {
+	aims, err := models.GetAllValues()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	plans, err := models.GetAllPlans()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	behaviours, err := models.GetAllBehaviours()
+	return aims, plans, behaviours, err
 }
 
 // handleCreateJournal handles POST requests to create a new journal entry
 func handleCreateJournal(w http.ResponseWriter, r *http.Request) {
-	log.Printf("handleCreateJournal called")
-	err := r.ParseForm()
-	if err != nil {
-		log.Printf("Error parsing form: %v", err)
-		http.Error(w, "Error parsing form", http.StatusBadRequest)
+	slog.DebugContext(r.Context(), "handleCreateJournal called")
+	if !parseUploadForm(w, r) {
 		return
 	}
 
 	// Extract form values
-	title := r.PostForm.Get("title")
-	content := r.PostForm.Get("content")
-	journalType := r.PostForm.Get("journal_type")
-	log.Printf("Creating new journal entry - Title: %s, Type: %s, Content length: %d",
-		title, journalType, len(content))
+	form := forms.New(r.PostForm)
+	title := form.Get("title")
+	content := form.Get("content")
+	journalType := form.Get("journal_type")
+	slog.DebugContext(r.Context(), "Creating new journal entry", "type", journalType, "content_length", len(content))
 
 	// Validate form values
-	if title == "" || journalType == "" {
-		log.Printf("Validation failed: title or journal_type is empty")
-		http.Error(w, "Title and journal type are required", http.StatusBadRequest)
+	form.Required("title", "content", "journal_type")
+	form.MaxLength("title", maxTitleLength)
+	form.OneOf("journal_type", journalTypes...)
+	aimIDs := form.IDs("aims")
+	planIDs := form.IDs("plans")
+	behaviourIDs := form.IDs("behaviours")
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for new journal", "errors", form.Errors)
+		renderInvalidJournalForm(w, r, form)
+		return
+	}
+
+	// Store the attached files first, as they may be rejected
+	uploads := saveUploads(r, form)
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Invalid attachments for new journal", "errors", form.Errors)
+		renderInvalidJournalForm(w, r, form)
 		return
 	}
 
-	// Create journal entry
-	id, err := models.CreateJournal(title, content, journalType)
+	// Create journal entry with its tags, links and attached files
+	links := models.JournalLinks{
+		Tags:         models.ParseTags(form.Get("tags")),
+		AimIDs:       aimIDs,
+		PlanIDs:      planIDs,
+		BehaviourIDs: behaviourIDs,
+	}
+	id, err := models.CreateJournal(title, content, journalType, links, newAttachments(uploads))
 	if err != nil {
-		log.Printf("Error creating journal: %v", err)
+		slog.ErrorContext(r.Context(), "Error creating journal", "err", err)
 		http.Error(w, "Error creating journal", http.StatusInternalServerError)
 		return
 	}
-	log.Printf("Successfully created journal with ID: %d", id)
+	slog.InfoContext(r.Context(), "Successfully created journal", "id", id)
 
 	// Get the newly created journal entry
 	journal, err := models.GetJournal(id)
 	if err != nil {
-		log.Printf("Error retrieving created journal: %v", err)
+		slog.ErrorContext(r.Context(), "Error retrieving created journal", "err", err)
 		http.Error(w, "Error retrieving created journal", http.StatusInternalServerError)
 		return
 	}
-	log.Printf("Retrieved created journal: ID=%d, Title=%s, Type=%s",
-		journal.ID, journal.Title, journal.JournalType)
+	slog.DebugContext(r.Context(), "Retrieved created journal", "id", journal.ID, "type", journal.JournalType)
 
 	// Return just the single journal entry if it's an HTMX request
 	if r.Header.Get("HX-Request") == "true" {
-		log.Printf("Responding to HTMX create request with partial template")
+		slog.DebugContext(r.Context(), "Responding to HTMX create request with partial template")
 		component := templates.JournalEntry(journal)
 		if err := component.Render(r.Context(), w); err != nil {
-			log.Printf("Error rendering partial template after create: %v", err)
+			slog.ErrorContext(r.Context(), "Error rendering partial template after create", "err", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
-		log.Printf("Successfully rendered partial template after create")
+		slog.DebugContext(r.Context(), "Successfully rendered partial template after create")
 		return
 	}
 
 	// Redirect to journals page if it's not an HTMX request
-	log.Printf("Redirecting to journals page after create")
+	slog.DebugContext(r.Context(), "Redirecting to journals page after create")
 	http.Redirect(w, r, "/journals", http.StatusSeeOther)
 }
 
+// renderInvalidJournalForm renders the journal form again with its errors,
+// alone for HTMX requests and within the journals page otherwise
+func renderInvalidJournalForm(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	if r.Header.Get("HX-Request") == "true" {
+		aims, plans, behaviours, err := getJournalLinkChoices()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error retrieving link choices", "err", err)
+			http.Error(w, "Error retrieving link choices", http.StatusInternalServerError)
+			return
+		}
+		renderInvalidForm(w, r, "#journal-form", templates.JournalForm(aims, plans, behaviours, form))
+		return
+	}
+
+	journals, next, err := models.ListJournals(models.JournalFilter{}, models.JournalCursor{}, journalPageSize)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving journals", "err", err)
+		http.Error(w, "Error retrieving journals", http.StatusInternalServerError)
+		return
+	}
+	renderJournalsPage(w, r, journals, journalPageURL("/journals", next), form)
+}
+
 // HandleDeleteJournal handles POST requests to delete a journal entry
 func HandleDeleteJournal(w http.ResponseWriter, r *http.Request) {
-	log.Printf("handleDeleteJournal called")
+	slog.DebugContext(r.Context(), "handleDeleteJournal called")
 	err := r.ParseForm()
 	if err != nil {
-		log.Printf("Error parsing form: %v", err)
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
 		http.Error(w, "Error parsing form", http.StatusBadRequest)
 		return
 	}
@@ -175,61 +312,89 @@ func HandleDeleteJournal(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PostForm.Get("journalID")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		log.Printf("Invalid journal ID: %s - %v", idStr, err)
+		slog.WarnContext(r.Context(), "Invalid journal ID", "id", idStr, "err", err)
 		http.Error(w, "Invalid journal ID", http.StatusBadRequest)
 		return
 	}
 
-	// Delete the journal entry
+	// Move the journal entry to the trash
 	err = models.DeleteJournal(id)
-	if err != nil {
-		log.Printf("Error deleting journal: %v", err)
-		http.Error(w, "Error deleting journal", http.StatusInternalServerError)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Journal entry not found", http.StatusNotFound)
 		return
 	}
-
-	log.Printf("Successfully deleted journal with ID: %d", id)
-
-	// Respond to HTMX request
-	if r.Header.Get("HX-Request") == "true" {
-		log.Printf("Responding to HTMX delete request")
-		w.WriteHeader(http.StatusOK)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting journal", "err", err)
+		http.Error(w, "Error deleting journal", http.StatusInternalServerError)
 		return
 	}
 
-	// Redirect to journals page if not HTMX
-	http.Redirect(w, r, "/journals", http.StatusSeeOther)
+	slog.InfoContext(r.Context(), "Successfully deleted journal", "id", id)
+	respondTrashed(w, r, models.TrashJournal, id, "/journals")
 }
 
-// JournalDetailHandler handles requests for a specific journal entry
+// JournalDetailHandler shows a journal entry on GET /journals/{id}, and
+// attaches files to it on POST /journals/{id}/attachments
 func JournalDetailHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("JournalDetailHandler called with path: %s", r.URL.Path)
+	slog.DebugContext(r.Context(), "JournalDetailHandler called", "path", r.URL.Path)
 
-	// Extract journal ID from URL
-	parts := strings.Split(r.URL.Path, "/")
-	if len(parts) < 3 {
-		log.Printf("Invalid path format for journal detail: %s", r.URL.Path)
+	id, action, err := parseDetailPath(r.URL.Path, "/journals/")
+	if err != nil {
+		slog.WarnContext(r.Context(), "Invalid path format for journal detail", "path", r.URL.Path)
 		http.NotFound(w, r)
 		return
 	}
+	slog.DebugContext(r.Context(), "Requested journal", "id", id)
 
-	id, err := strconv.ParseInt(parts[2], 10, 64)
-	if err != nil {
-		log.Printf("Invalid journal ID: %s - %v", parts[2], err)
+	journal, err := models.GetJournal(id)
+	if errors.Is(err, sql.ErrNoRows) {
 		http.NotFound(w, r)
 		return
 	}
-	log.Printf("Requested journal with ID: %d", id)
-
-	// Just check if the journal exists
-	_, err = models.GetJournal(id)
 	if err != nil {
-		log.Printf("Error retrieving journal: %v", err)
+		slog.ErrorContext(r.Context(), "Error retrieving journal", "err", err)
 		http.Error(w, "Error retrieving journal", http.StatusInternalServerError)
 		return
 	}
 
-	// This handler could be expanded to show a detailed view of a journal entry
-	// For now, we'll just redirect to the journals page
-	http.Redirect(w, r, "/journals", http.StatusSeeOther)
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		renderJournalPage(w, r, journal, forms.New(nil))
+	case action == "attachments" && r.Method == http.MethodPost:
+		if !parseUploadForm(w, r) {
+			return
+		}
+		form := forms.New(r.PostForm)
+		uploads := saveUploads(r, form)
+		if len(uploads) == 0 {
+			form.AddError("attachments", "Please choose a file")
+		}
+		if !form.Valid() {
+			slog.WarnContext(r.Context(), "Invalid attachments for journal", "id", id, "errors", form.Errors)
+			renderJournalPage(w, r, journal, form)
+			return
+		}
+		if err := attachUploads(id, uploads); err != nil {
+			slog.ErrorContext(r.Context(), "Error attaching files to journal", "err", err)
+			http.Error(w, "Error attaching files to journal", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Successfully attached files to journal", "id", id, "count", len(uploads))
+		http.Redirect(w, r, "/journals/"+strconv.FormatInt(id, 10), http.StatusSeeOther)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// renderJournalPage renders a journal entry with the given upload form
+func renderJournalPage(w http.ResponseWriter, r *http.Request, journal models.Journal, form *forms.Form) {
+	component := templates.JournalPage(journal, form)
+	if !form.Valid() {
+		renderInvalidForm(w, r, "", component)
+		return
+	}
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering journal page", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
 }
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"pds/internal/database"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// healthCheckTimeout bounds the time the health checks wait for the database
+const healthCheckTimeout = 2 * time.Second
+
+// draining is set once the server shuts down, so that it is no longer
+// reported ready while the requests in flight finish
+var draining atomic.Bool
+
+// StartDraining makes GET /readyz answer 503 from now on, for the server is
+// shutting down
+func StartDraining() {
+	draining.Store(true)
+}
+
+// healthStatus is the JSON response of the health endpoints
+type healthStatus struct {
+	Status string            `json:"status"` // "ok" or "error"
+	Checks map[string]string `json:"checks"` // Result of each check, "ok" or the error
+}
+
+// HealthzHandler reports on GET /healthz whether the server is alive, i.e.
+// whether it can reach the database
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	serveHealth(w, r, false)
+}
+
+// ReadyzHandler reports on GET /readyz whether the server is ready to serve
+// requests: it is not shutting down, the database can be reached and all the
+// migrations are applied
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	serveHealth(w, r, true)
+}
+
+// serveHealth runs the health checks, including the migrations if asked,
+// and answers 503 if any fails
+func serveHealth(w http.ResponseWriter, r *http.Request, checkMigrations bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	health := healthStatus{Status: "ok", Checks: map[string]string{"database": "ok"}}
+	if err := database.Ping(ctx); err != nil {
+		slog.ErrorContext(r.Context(), "Health check failed: database unreachable", "err", err)
+		health.Status, health.Checks["database"] = "error", err.Error()
+	}
+	if checkMigrations {
+		health.Checks["shutdown"] = "ok"
+		if draining.Load() {
+			health.Status, health.Checks["shutdown"] = "error", "draining"
+		}
+	}
+	if checkMigrations && health.Status != "ok" {
+		health.Checks["migrations"] = "skipped"
+	} else if checkMigrations {
+		health.Checks["migrations"] = "ok"
+		pending, err := database.PendingMigrations(ctx)
+		switch {
+		case err != nil:
+			slog.ErrorContext(r.Context(), "Health check failed: migration status unknown", "err", err)
+			health.Status, health.Checks["migrations"] = "error", err.Error()
+		case len(pending) > 0:
+			slog.WarnContext(r.Context(), "Health check failed: pending migrations", "pending", pending)
+			health.Status, health.Checks["migrations"] = "error", "pending: "+strings.Join(pending, ", ")
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	status := http.StatusOK
+	if health.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, health)
+}
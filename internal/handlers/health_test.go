@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadyzDraining(t *testing.T) {
+	rec := httptest.NewRecorder()
+	ReadyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("readyz answered %d before draining: %s", rec.Code, rec.Body)
+	}
+
+	StartDraining()
+	t.Cleanup(func() { draining.Store(false) })
+	rec = httptest.NewRecorder()
+	ReadyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz answered %d while draining: %s", rec.Code, rec.Body)
+	}
+}
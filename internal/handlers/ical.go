@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"pds/internal/forms"
+	"pds/internal/ical"
+	"pds/internal/models"
+	"pds/internal/recurrence"
+	"strings"
+	"time"
+)
+
+// maxCalendarSize bounds the size of an imported .ics file
+const maxCalendarSize = 1 << 20
+
+// CalendarFeedHandler handles GET /calendar.ics?token={token}, the read-only
+// iCalendar feed of plan due dates, milestones, recurring plans, scheduled
+// habits and review reminders, to subscribe to from a calendar app
+func CalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, err := models.CalendarFeedToken()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving calendar feed token", "err", err)
+		http.Error(w, "Error retrieving calendar feed", http.StatusInternalServerError)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(token)) != 1 {
+		http.Error(w, "Invalid token", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now()
+	entries, err := calendarFeedEntries(baseURL(r), now)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error building calendar feed", "err", err)
+		http.Error(w, "Error retrieving calendar feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="calendar.ics"`)
+	if err := ical.Write(w, "Journal App", entries, now); err != nil {
+		slog.ErrorContext(r.Context(), "Error writing calendar feed", "err", err)
+	}
+}
+
+// CalendarFeedTokenHandler handles POST /calendar/feed-token, which replaces
+// the token of the calendar feed, e.g. after its URL leaked
+func CalendarFeedTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, err := models.RegenerateCalendarFeedToken(); err != nil {
+		slog.ErrorContext(r.Context(), "Error regenerating calendar feed token", "err", err)
+		http.Error(w, "Error regenerating calendar feed token", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Regenerated calendar feed token")
+	http.Redirect(w, r, "/calendar", http.StatusSeeOther)
+}
+
+// baseURL returns the URL of the server the request was sent to, for the
+// links of the calendar feed
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// calendarFeedURL returns the URL of the calendar feed with its token
+func calendarFeedURL(r *http.Request) (string, error) {
+	token, err := models.CalendarFeedToken()
+	if err != nil {
+		return "", err
+	}
+	return baseURL(r) + "/calendar.ics?token=" + token, nil
+}
+
+// calendarFeedEntries lists the entries of the calendar feed: a to-do for
+// each plan with a due date, an event for each milestone of a plan, a
+// recurring event for the plans instantiated from each template and for each
+// habit, and the weekly and monthly review reminders
+func calendarFeedEntries(base string, now time.Time) ([]ical.Entry, error) {
+	var entries []ical.Entry
+
+	plans, err := models.GetAllPlans()
+	if err != nil {
+		return nil, fmt.Errorf("retrieving plans: %w", err)
+	}
+	for _, plan := range plans {
+		if plan.DueDate.IsZero() {
+			continue
+		}
+		entries = append(entries, ical.Entry{
+			Kind:        ical.KindTodo,
+			UID:         fmt.Sprintf("plan-%d@pds", plan.ID),
+			Summary:     plan.Name,
+			Description: plan.Description,
+			URL:         fmt.Sprintf("%s/plans/%d", base, plan.ID),
+			Date:        plan.DueDate,
+			Completed:   plan.CompletedAt,
+		})
+	}
+
+	milestones, err := models.GetAllMilestones()
+	if err != nil {
+		return nil, fmt.Errorf("retrieving milestones: %w", err)
+	}
+	for _, milestone := range milestones {
+		summary := "Milestone: " + milestone.Name
+		if !milestone.CompletedAt.IsZero() {
+			summary += " (reached)"
+		}
+		entries = append(entries, ical.Entry{
+			Kind:        ical.KindEvent,
+			UID:         fmt.Sprintf("milestone-%d@pds", milestone.ID),
+			Summary:     summary,
+			Description: "Milestone of the plan " + milestone.PlanName,
+			URL:         fmt.Sprintf("%s/plans/%d", base, milestone.PlanID),
+			Date:        milestone.DueDate,
+		})
+	}
+
+	planTemplates, err := models.GetAllPlanTemplates()
+	if err != nil {
+		return nil, fmt.Errorf("retrieving plan templates: %w", err)
+	}
+	for _, t := range planTemplates {
+		rule, err := t.Rule()
+		if err != nil {
+			continue
+		}
+		first, ok := rule.Next(t.StartsAt, t.StartsAt.Add(-time.Second))
+		if !ok {
+			continue
+		}
+		entries = append(entries, ical.Entry{
+			Kind:        ical.KindEvent,
+			UID:         fmt.Sprintf("plan-template-%d@pds", t.ID),
+			Summary:     "New plan: " + t.Name,
+			Description: t.Description,
+			URL:         fmt.Sprintf("%s/plans/templates/%d", base, t.ID),
+			Date:        first,
+			RRule:       dateRRule(rule),
+		})
+	}
+
+	habits, err := models.GetAllHabits()
+	if err != nil {
+		return nil, fmt.Errorf("retrieving habits: %w", err)
+	}
+	for _, habit := range habits {
+		entries = append(entries, habitEntry(base, habit))
+	}
+
+	// Reviews are due at the end of each week and month
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	entries = append(entries,
+		ical.Entry{
+			Kind:    ical.KindEvent,
+			UID:     "weekly-review@pds",
+			Summary: "Weekly review",
+			URL:     base + "/reports",
+			Date:    today.AddDate(0, 0, (7-int(today.Weekday()))%7),
+			RRule:   recurrence.Rule{Freq: recurrence.Weekly, ByDay: []time.Weekday{time.Sunday}}.String(),
+		},
+		ical.Entry{
+			Kind:    ical.KindEvent,
+			UID:     "monthly-review@pds",
+			Summary: "Monthly review",
+			URL:     base + "/reports",
+			Date:    time.Date(today.Year(), today.Month()+1, 0, 0, 0, 0, 0, time.Local),
+			RRule:   recurrence.Rule{Freq: recurrence.Monthly, ByMonthDay: []int{-1}}.String(),
+		},
+	)
+	return entries, nil
+}
+
+// habitEntry returns the recurring event of the days a habit is scheduled
+// on. Weekly habits, which may be done on any day, repeat every week from
+// the day they were created.
+func habitEntry(base string, habit models.Habit) ical.Entry {
+	created := habit.CreatedAt.Local()
+	start := time.Date(created.Year(), created.Month(), created.Day(), 0, 0, 0, 0, time.Local)
+
+	var rule recurrence.Rule
+	switch habit.Schedule {
+	case models.HabitWeekly:
+		rule = recurrence.Rule{Freq: recurrence.Weekly}
+	case models.HabitWeekdays:
+		rule = recurrence.Rule{Freq: recurrence.Weekly, ByDay: habit.Weekdays}
+		// The first event must be on one of the days
+		if first, ok := rule.Next(start, start.Add(-time.Second)); ok {
+			start = first
+		}
+	default:
+		rule = recurrence.Rule{Freq: recurrence.Daily}
+	}
+
+	description := habit.Description
+	if habit.AimName != "" {
+		description = strings.TrimSpace(description + "\n\nServes: " + habit.AimName)
+	}
+	return ical.Entry{
+		Kind:        ical.KindEvent,
+		UID:         fmt.Sprintf("habit-%d@pds", habit.ID),
+		Summary:     fmt.Sprintf("%s (%s)", habit.Name, habit.ScheduleText()),
+		Description: description,
+		URL:         base + "/habits",
+		Date:        start,
+		RRule:       rule.String(),
+	}
+}
+
+// dateRRule formats a recurrence rule for an all-day event, whose UNTIL must
+// be a date rather than a date-time
+func dateRRule(rule recurrence.Rule) string {
+	until := rule.Until
+	rule.Until = time.Time{}
+	if until.IsZero() {
+		return rule.String()
+	}
+	return rule.String() + ";UNTIL=" + until.Local().Format("20060102")
+}
+
+// ImportPlansHandler handles POST /plans/import, which creates a plan for
+// each event and to-do of an uploaded .ics file. Plans are due on the due
+// date of to-dos and the start date of events, and serve the selected aim.
+// Completed to-dos are skipped.
+func ImportPlansHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxCalendarSize+1<<16)
+	err := r.ParseMultipartForm(maxCalendarSize)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		slog.WarnContext(r.Context(), "Calendar too large", "err", err)
+		http.Error(w, "The calendar file is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	aimID := form.ID("importAimID")
+	entries := parseCalendarUpload(r, form)
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for plan import", "errors", form.Errors)
+		renderPlansPage(w, r, form)
+		return
+	}
+
+	var plans []models.ImportedPlan
+	for _, entry := range entries {
+		if entry.Summary == "" || !entry.Completed.IsZero() {
+			continue
+		}
+		plans = append(plans, models.ImportedPlan{Name: entry.Summary, Description: entry.Description, DueDate: entry.Date})
+	}
+	ids, err := models.ImportPlans(plans, []models.PlanAim{{AimID: aimID, Weight: 1}})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error importing plans", "err", err)
+		http.Error(w, "Error importing plans", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully imported plans", "count", len(ids))
+	http.Redirect(w, r, "/plans", http.StatusSeeOther)
+}
+
+// parseCalendarUpload reads the events and to-dos of the .ics file uploaded
+// in the "calendar" field of a form
+func parseCalendarUpload(r *http.Request, form *forms.Form) []ical.Entry {
+	file, _, err := r.FormFile("calendar")
+	if err != nil {
+		form.AddError("calendar", "Please select an .ics file")
+		return nil
+	}
+	defer file.Close()
+
+	entries, err := ical.Parse(file)
+	if err != nil {
+		form.AddError("calendar", "This is not a valid calendar: "+err.Error())
+		return nil
+	}
+	return entries
+}
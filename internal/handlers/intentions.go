@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"pds/internal/forms"
+	"pds/internal/models"
+	"pds/internal/templates"
+	"strconv"
+)
+
+// Outcomes of an intention when its behaviour occurred
+const (
+	outcomeWorked  = "worked"  // Applied, and it worked
+	outcomeFailed  = "failed"  // Applied, but it did not work
+	outcomeSkipped = "skipped" // Not applied
+)
+
+// IntentionDetailHandler records the outcome of an intention for an
+// occurrence of its behaviour on POST /intentions/{id}/outcomes, and deletes
+// the intention on POST /intentions/{id}/delete
+func IntentionDetailHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "IntentionDetailHandler called", "path", r.URL.Path, "method", r.Method)
+
+	intentionID, action, err := parseDetailPath(r.URL.Path, "/intentions/")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case action == "outcomes" && r.Method == http.MethodPost:
+		handleRecordIntentionOutcome(w, r, intentionID)
+	case action == "delete" && (r.Method == http.MethodPost || r.Method == http.MethodDelete):
+		handleDeleteIntention(w, r, intentionID)
+	case action == "outcomes" || action == "delete":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleRecordIntentionOutcome records whether an intention was applied when
+// its behaviour occurred, and whether it worked
+func handleRecordIntentionOutcome(w http.ResponseWriter, r *http.Request, intentionID int64) {
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("outcome")
+	form.OneOf("outcome", outcomeWorked, outcomeFailed, outcomeSkipped)
+	occurrenceID := form.ID("occurrenceID")
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for intention outcome", "errors", form.Errors)
+		http.Error(w, "Invalid intention outcome", http.StatusBadRequest)
+		return
+	}
+
+	outcome := form.Get("outcome")
+	applied, worked := outcome != outcomeSkipped, outcome == outcomeWorked
+	err := models.RecordIntentionOutcome(intentionID, occurrenceID, applied, worked)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Intention or occurrence not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error recording intention outcome", "err", err)
+		http.Error(w, "Error recording intention outcome", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully recorded intention outcome", "id", intentionID, "occurrence_id", occurrenceID, "outcome", outcome)
+
+	if r.Header.Get("HX-Request") == "true" {
+		if err := templates.IntentionOutcomeRecorded(applied, worked).Render(r.Context(), w); err != nil {
+			slog.ErrorContext(r.Context(), "Error rendering recorded outcome", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+	http.Redirect(w, r, "/behaviours", http.StatusSeeOther)
+}
+
+// handleDeleteIntention moves an intention to the trash
+func handleDeleteIntention(w http.ResponseWriter, r *http.Request, intentionID int64) {
+	intention, err := models.GetIntention(intentionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving intention", "err", err)
+		http.Error(w, "Error retrieving intention", http.StatusInternalServerError)
+		return
+	}
+
+	if err := models.DeleteIntention(intentionID); err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting intention", "err", err)
+		http.Error(w, "Error deleting intention", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully deleted intention", "id", intentionID)
+	respondTrashed(w, r, models.TrashIntention, intentionID, "/behaviours/"+strconv.FormatInt(intention.BehaviourID, 10))
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"pds/internal/database"
+	"pds/internal/models"
+)
+
+func TestRecordIntentionOutcomeBeforeIntention(t *testing.T) {
+	valueID, err := models.CreateValue("Calm", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	behaviourID, err := models.CreateBehaviour("Snapping at people", "", "", valueID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	earlier, err := models.LogBehaviourOccurrence(behaviourID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.DB.Exec("UPDATE behaviour_occurrences SET occurred_at = datetime('now', '-1 day') WHERE id = ?", earlier.ID); err != nil {
+		t.Fatal(err)
+	}
+	intentionID, err := models.CreateIntention(behaviourID, "I feel rushed", "take a breath", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later, err := models.LogBehaviourOccurrence(behaviourID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := func(occurrenceID int64) int {
+		form := url.Values{"outcome": {outcomeWorked}, "occurrenceID": {strconv.FormatInt(occurrenceID, 10)}}
+		req := httptest.NewRequest(http.MethodPost, "/intentions/"+strconv.FormatInt(intentionID, 10)+"/outcomes", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		IntentionDetailHandler(rec, req)
+		return rec.Code
+	}
+	if code := record(earlier.ID); code != http.StatusNotFound {
+		t.Errorf("recording an occurrence before the intention answered %d, want 404", code)
+	}
+	if code := record(later.ID); code != http.StatusSeeOther {
+		t.Errorf("recording an occurrence after the intention answered %d, want 303", code)
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"pds/internal/events"
+	"pds/internal/models"
+	"pds/internal/sse"
+	"pds/internal/templates"
+	"strconv"
+	"strings"
+
+	"github.com/a-h/templ"
+)
+
+// LiveUpdates streams the changes to the data to the open pages, on GET
+// /events?topic={journals|behaviours}
+var LiveUpdates = sse.NewBroker()
+
+// Topics of the live updates, which are also the names of their events
+const (
+	journalsTopic   = "journals"
+	behavioursTopic = "behaviours"
+)
+
+// BroadcastLiveUpdate sends the journal entries and behaviours that changed
+// to the pages listing them, as out-of-band swaps adding, replacing or
+// removing them. It subscribes to the domain events, which are published once
+// the changes are committed, so it renders them right away.
+func BroadcastLiveUpdate(event events.Event) {
+	if LiveUpdates.Clients() == 0 {
+		return
+	}
+
+	var topic string
+	var render func() (string, error)
+	switch event.Type {
+	case events.JournalCreated, events.JournalUpdated, events.JournalDeleted, events.JournalRestored:
+		// A restored entry is added back like a new one
+		id, created := eventEntityID(event, "id"), event.Type == events.JournalCreated || event.Type == events.JournalRestored
+		topic, render = journalsTopic, func() (string, error) { return journalUpdate(id, created) }
+	case events.AttachmentCreated:
+		id := eventEntityID(event, "journal_id")
+		topic, render = journalsTopic, func() (string, error) { return journalUpdate(id, false) }
+	case events.BehaviourCreated, events.BehaviourUpdated, events.BehaviourDeleted, events.BehaviourRestored:
+		id, created := eventEntityID(event, "id"), event.Type == events.BehaviourCreated || event.Type == events.BehaviourRestored
+		topic, render = behavioursTopic, func() (string, error) { return behaviourUpdate(id, created) }
+	default:
+		return
+	}
+
+	data, err := render()
+	if err != nil {
+		slog.Error("Error rendering live update", "event_type", event.Type, "err", err)
+		return
+	}
+	LiveUpdates.Publish(topic, sse.Message{Event: topic, Data: data})
+}
+
+// eventEntityID returns an ID in the data of an event
+func eventEntityID(event events.Event, key string) int64 {
+	id, _ := event.Data[key].(int64)
+	return id
+}
+
+// journalUpdate renders the swaps showing the current state of a journal
+// entry: a new entry is added at the top of the list, replacing the one the
+// page that created it has already added
+func journalUpdate(id int64, created bool) (string, error) {
+	selector := "#journal-" + strconv.FormatInt(id, 10)
+	deleteSwap := `<div hx-swap-oob="delete:` + selector + `"></div>`
+
+	journal, err := models.GetJournal(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return deleteSwap, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if !created {
+		return renderString(templates.JournalEntrySwap(journal))
+	}
+	entry, err := renderString(templates.JournalEntry(journal))
+	if err != nil {
+		return "", err
+	}
+	return deleteSwap + `<div hx-swap-oob="afterbegin:#journal-list">` + entry + `</div>`, nil
+}
+
+// behaviourUpdate renders the swaps showing the current state of a
+// behaviour: a new behaviour is added at the end of the table, replacing the
+// row the page that created it already has. Table rows are wrapped in tbody
+// elements so that they are parsed as such.
+func behaviourUpdate(id int64, created bool) (string, error) {
+	selector := "#behaviour-" + strconv.FormatInt(id, 10)
+	deleteSwap := `<tbody hx-swap-oob="delete:` + selector + `"></tbody>`
+
+	behaviour, err := models.GetBehaviour(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return deleteSwap, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	scale, err := models.GetMarkScale()
+	if err != nil {
+		return "", err
+	}
+
+	if !created {
+		row, err := renderString(templates.BehaviourRowSwap(behaviour, scale))
+		return "<tbody>" + row + "</tbody>", err
+	}
+	row, err := renderString(templates.BehaviourRow(behaviour, scale))
+	if err != nil {
+		return "", err
+	}
+	return deleteSwap + `<tbody hx-swap-oob="beforeend:#behaviour-rows">` + row + `</tbody>`, nil
+}
+
+// renderString renders a component to a string
+func renderString(component templ.Component) (string, error) {
+	var sb strings.Builder
+	err := component.Render(context.Background(), &sb)
+	return sb.String(), err
+}
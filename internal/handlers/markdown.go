@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"pds/internal/templates"
+)
+
+// MarkdownPreviewHandler renders the Markdown of a form field for the live
+// previews of the forms. The field query parameter names the field, e.g.
+// POST /markdown/preview?field=content
+func MarkdownPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	source := r.PostForm.Get(r.URL.Query().Get("field"))
+	component := templates.MarkdownContent(source)
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering markdown preview", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
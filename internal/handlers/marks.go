@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"pds/internal/forms"
+	"pds/internal/models"
+	"pds/internal/templates"
+	"strconv"
+	"strings"
+)
+
+// MarkScaleHandler handles the page configuring the scale of the marks of
+// behaviours on GET /behaviours/scale, and saves it on POST
+func MarkScaleHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "MarkScaleHandler called", "path", r.URL.Path, "method", r.Method)
+
+	switch r.Method {
+	case http.MethodGet:
+		scale, err := models.GetMarkScale()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error retrieving mark scale", "err", err)
+			http.Error(w, "Error retrieving mark scale", http.StatusInternalServerError)
+			return
+		}
+		renderMarkScalePage(w, r, forms.New(url.Values{
+			"kind":   {scale.Kind},
+			"min":    {strconv.Itoa(scale.Min)},
+			"max":    {strconv.Itoa(scale.Max)},
+			"levels": {models.FormatMarkLevels(scale.Levels)},
+		}))
+	case http.MethodPost:
+		handleSaveMarkScale(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSaveMarkScale stores the mark scale from the form
+func handleSaveMarkScale(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("kind")
+	form.OneOf("kind", models.MarkScaleNumeric, models.MarkScaleLevels)
+	scale := models.MarkScale{Kind: form.Get("kind")}
+	switch scale.Kind {
+	case models.MarkScaleNumeric:
+		form.Required("min", "max")
+		scale.Min = form.Int("min", -1000, 1000, 0)
+		scale.Max = form.Int("max", -1000, 1000, 0)
+	case models.MarkScaleLevels:
+		form.Required("levels")
+		scale.Levels = models.ParseMarkLevels(form.Get("levels"))
+	}
+	if form.Valid() {
+		if err := scale.Validate(); err != nil {
+			field := "levels"
+			if scale.Kind == models.MarkScaleNumeric {
+				field = "max"
+			}
+			form.AddError(field, "Invalid scale: "+err.Error())
+		}
+	}
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for mark scale", "errors", form.Errors)
+		renderMarkScalePage(w, r, form)
+		return
+	}
+
+	if err := models.SaveMarkScale(scale); err != nil {
+		slog.ErrorContext(r.Context(), "Error saving mark scale", "err", err)
+		http.Error(w, "Error saving mark scale", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully saved mark scale", "kind", scale.Kind)
+	http.Redirect(w, r, "/behaviours/scale", http.StatusSeeOther)
+}
+
+// renderMarkScalePage renders the mark scale page with its form
+func renderMarkScalePage(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	component := templates.MarkScalePage(form)
+	if !form.Valid() {
+		renderInvalidForm(w, r, "", component)
+		return
+	}
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering Mark Scale page", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	slog.DebugContext(r.Context(), "Successfully rendered Mark Scale page")
+}
+
+// validMark checks that the mark in the form is on the scale, and returns it
+// as written on the scale. The stored mark of a behaviour is kept even if it
+// is no longer on the scale.
+func validMark(form *forms.Form, scale models.MarkScale, stored string) string {
+	if stored != "" && strings.TrimSpace(form.Get("mark")) == stored {
+		return stored
+	}
+	mark, err := scale.Normalize(form.Get("mark"))
+	if err != nil {
+		form.AddError("mark", "Please choose a mark on the scale")
+	}
+	return mark
+}
+
+// filterBehavioursByMark keeps the behaviours with a mark, or the unmarked
+// ones for models.UnmarkedFilter
+func filterBehavioursByMark(behaviours []models.Behaviour, mark string) []models.Behaviour {
+	if mark == models.UnmarkedFilter {
+		mark = ""
+	}
+	var filtered []models.Behaviour
+	for _, behaviour := range behaviours {
+		if strings.EqualFold(behaviour.Mark, mark) {
+			filtered = append(filtered, behaviour)
+		}
+	}
+	return filtered
+}
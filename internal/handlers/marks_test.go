@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+
+	"pds/internal/forms"
+	"pds/internal/models"
+)
+
+func TestValidMarkKeepsStoredMark(t *testing.T) {
+	scale := models.MarkScale{Kind: models.MarkScaleLevels, Levels: []models.MarkLevel{{Name: "Mild"}, {Name: "Severe"}}}
+
+	form := forms.New(url.Values{"mark": {"Harmful"}})
+	if mark := validMark(form, scale, "Harmful"); mark != "Harmful" || !form.Valid() {
+		t.Errorf("the stored mark was not kept: %q, %v", mark, form.Errors)
+	}
+
+	form = forms.New(url.Values{"mark": {"Harmful"}})
+	if validMark(form, scale, ""); form.Valid() {
+		t.Error("a mark off the scale was accepted")
+	}
+}
+
+func TestFilterBehavioursByMarkLevelNamedNone(t *testing.T) {
+	behaviours := []models.Behaviour{{ID: 1, Mark: "none"}, {ID: 2}}
+
+	if filtered := filterBehavioursByMark(behaviours, "none"); len(filtered) != 1 || filtered[0].ID != 1 {
+		t.Errorf("filtering by the level none kept %+v", filtered)
+	}
+	if filtered := filterBehavioursByMark(behaviours, models.UnmarkedFilter); len(filtered) != 1 || filtered[0].ID != 2 {
+		t.Errorf("filtering the unmarked behaviours kept %+v", filtered)
+	}
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"math"
+	"pds/internal/metrics"
+	"pds/internal/models"
+	"time"
+)
+
+// The gauges of the data of the user, computed when the metrics are scraped
+func init() {
+	metrics.NewGaugeFunc("pds_journals", "Number of journal entries.", func() (float64, error) {
+		count, err := models.CountJournals()
+		return float64(count), err
+	})
+	metrics.NewGaugeFunc("pds_active_plans", "Number of plans started but not finished.", func() (float64, error) {
+		plans, err := models.GetActivePlans()
+		return float64(len(plans)), err
+	})
+	metrics.NewGaugeFunc("pds_days_since_last_journal",
+		"Number of full days since the latest journal entry, NaN if there is none.", func() (float64, error) {
+			last, err := models.GetLastJournalTime()
+			if err != nil || last.IsZero() {
+				return math.NaN(), err
+			}
+			return math.Floor(time.Since(last).Hours() / 24), nil
+		})
+	metrics.NewGaugeFunc("pds_behaviour_occurrences_today", "Number of behaviour occurrences logged today.", func() (float64, error) {
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+		count, err := models.CountBehaviourOccurrences(today, today.AddDate(0, 0, 1))
+		return float64(count), err
+	})
+}
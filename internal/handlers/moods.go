@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"pds/internal/models"
+	"pds/internal/templates"
+	"strconv"
+)
+
+// CreateMoodHandler records how the user currently feels
+func CreateMoodHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	score, err := strconv.Atoi(r.PostForm.Get("score"))
+	if err != nil || score < 1 || score > 5 {
+		slog.WarnContext(r.Context(), "Invalid mood score", "score", r.PostForm.Get("score"))
+		http.Error(w, "Mood score must be between 1 and 5", http.StatusBadRequest)
+		return
+	}
+
+	id, err := models.CreateMood(score, r.PostForm.Get("note"))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating mood", "err", err)
+		http.Error(w, "Error creating mood", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully recorded mood", "id", id)
+
+	if r.Header.Get("HX-Request") == "true" {
+		mood, err := models.GetLatestMood()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error retrieving mood", "err", err)
+			http.Error(w, "Error retrieving mood", http.StatusInternalServerError)
+			return
+		}
+
+		component := templates.MoodLogged(mood)
+		if err := component.Render(r.Context(), w); err != nil {
+			slog.ErrorContext(r.Context(), "Error rendering logged mood", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/journals", http.StatusSeeOther)
+}
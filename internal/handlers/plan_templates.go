@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"pds/internal/forms"
+	"pds/internal/models"
+	"pds/internal/recurrence"
+	"pds/internal/templates"
+	"strconv"
+	"time"
+)
+
+// PlanTemplatesHandler lists the plan templates on GET /plans/templates and
+// creates one on POST
+func PlanTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "PlanTemplatesHandler called", "path", r.URL.Path, "method", r.Method)
+
+	switch r.Method {
+	case http.MethodGet:
+		renderPlanTemplatesPage(w, r, forms.New(nil))
+	case http.MethodPost:
+		handleCreatePlanTemplate(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleCreatePlanTemplate creates a plan template
+func handleCreatePlanTemplate(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "description", "recurrence")
+	form.MaxLength("name", 200)
+	aims := parsePlanAims(form)
+	durationDays := form.Int("durationDays", 0, 3650, 0)
+	startsAt := form.Date("startsAt")
+	if startsAt.IsZero() {
+		now := time.Now()
+		startsAt = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	}
+	rule, err := recurrence.Parse(form.Get("recurrence"))
+	if err != nil && form.Get("recurrence") != "" {
+		form.AddError("recurrence", "Invalid recurrence rule: "+err.Error())
+	}
+
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for new plan template", "errors", form.Errors)
+		renderPlanTemplatesPage(w, r, form)
+		return
+	}
+
+	id, err := models.CreatePlanTemplate(form.Get("name"), form.Get("description"), form.Get("resources"), rule, startsAt, durationDays, aims)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating plan template", "err", err)
+		http.Error(w, "Error creating plan template", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully created plan template", "id", id)
+	http.Redirect(w, r, "/plans/templates/"+strconv.FormatInt(id, 10), http.StatusSeeOther)
+}
+
+// renderPlanTemplatesPage renders the plan templates with the creation form
+func renderPlanTemplatesPage(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	planTemplates, err := models.GetAllPlanTemplates()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving plan templates", "err", err)
+		http.Error(w, "Error retrieving plan templates", http.StatusInternalServerError)
+		return
+	}
+	values, err := models.GetAllValues()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving values", "err", err)
+		http.Error(w, "Error retrieving values", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.PlanTemplatesPage(planTemplates, values, form)
+	if !form.Valid() {
+		renderInvalidForm(w, r, "", component)
+		return
+	}
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering plan templates page", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// PlanTemplateDetailHandler handles GET /plans/templates/{id}, which shows a
+// template with the plans instantiated from it, POST
+// /plans/templates/{id}/instantiate and POST /plans/templates/{id}/delete
+func PlanTemplateDetailHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "PlanTemplateDetailHandler called", "path", r.URL.Path, "method", r.Method)
+
+	templateID, action, err := parseDetailPath(r.URL.Path, "/plans/templates/")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	planTemplate, err := models.GetPlanTemplate(templateID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving plan template", "err", err)
+		http.Error(w, "Error retrieving plan template", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		plans, err := models.GetTemplatePlans(templateID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error retrieving plans of template", "err", err)
+			http.Error(w, "Error retrieving plans", http.StatusInternalServerError)
+			return
+		}
+		component := templates.PlanTemplatePage(planTemplate, plans)
+		if err := component.Render(r.Context(), w); err != nil {
+			slog.ErrorContext(r.Context(), "Error rendering plan template page", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+	case action == "instantiate" && r.Method == http.MethodPost:
+		planID, err := models.InstantiatePlanTemplate(planTemplate, time.Now().Truncate(time.Second))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error instantiating plan template", "err", err)
+			http.Error(w, "Error creating plan", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Created plan from template", "plan_id", planID, "template_id", templateID)
+		http.Redirect(w, r, "/plans/"+strconv.FormatInt(planID, 10), http.StatusSeeOther)
+	case action == "delete" && r.Method == http.MethodPost:
+		if err := models.DeletePlanTemplate(templateID); err != nil {
+			slog.ErrorContext(r.Context(), "Error deleting plan template", "err", err)
+			http.Error(w, "Error deleting plan template", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Successfully deleted plan template", "id", templateID)
+		respondTrashed(w, r, models.TrashPlanTemplate, templateID, "/plans/templates")
+	case action == "" || action == "instantiate" || action == "delete":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// RunPlanTemplates instantiates the plans of the templates that are due. It
+// is run periodically in the background.
+func RunPlanTemplates() error {
+	created, err := models.InstantiateDuePlanTemplates(time.Now())
+	if created > 0 {
+		slog.Info("Created plans from templates", "count", created)
+	}
+	if err != nil {
+		return fmt.Errorf("instantiating plan templates: %w", err)
+	}
+	return nil
+}
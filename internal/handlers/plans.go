@@ -1,98 +1,148 @@
 package handlers
 
 import (
-	"fmt"
-	"log"
+	"database/sql"
+	"errors"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"pds/internal/forms"
+	"pds/internal/markdown"
 	"pds/internal/models"
 	"pds/internal/templates"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // PlansHandler handles the Plans page
 func PlansHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("PlansHandler called with path: %s, method: %s", r.URL.Path, r.Method)
+	slog.DebugContext(r.Context(), "PlansHandler called", "path", r.URL.Path, "method", r.Method)
 
 	// Handle GET, POST, and DELETE requests
 	switch r.Method {
 	case http.MethodGet:
-		log.Printf("Handling GET request for Plans page")
+		slog.DebugContext(r.Context(), "Handling GET request for Plans page")
 		handleGetPlans(w, r)
 	case http.MethodPost:
-		log.Printf("Handling POST request for Plans page")
+		slog.DebugContext(r.Context(), "Handling POST request for Plans page")
 		HandleCreatePlan(w, r)
 	case http.MethodDelete:
-		log.Printf("Handling DELETE request for Plans page")
+		slog.DebugContext(r.Context(), "Handling DELETE request for Plans page")
 		HandleDeletePlan(w, r)
 	default:
-		log.Printf("Method %s not allowed for Plans page", r.Method)
+		slog.WarnContext(r.Context(), "Method not allowed for Plans page", "method", r.Method)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
 // handleGetPlans retrieves and displays all plans
 func handleGetPlans(w http.ResponseWriter, r *http.Request) {
+	renderPlansPage(w, r, forms.New(nil))
+}
+
+// renderPlansPage renders the Plans page with the given creation form
+func renderPlansPage(w http.ResponseWriter, r *http.Request, form *forms.Form) {
 	plans, err := models.GetAllPlans()
-	values, err := models.GetAllValues()
 	if err != nil {
-		log.Printf("Error retrieving values: %v", err)
-		http.Error(w, "Error retrieving values", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error retrieving plans", "err", err)
+		http.Error(w, "Error retrieving plans", http.StatusInternalServerError)
 		return
 	}
+	values, err := models.GetAllValues()
 	if err != nil {
-		log.Printf("Error retrieving plans: %v", err)
-		http.Error(w, "Error retrieving plans", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error retrieving values", "err", err)
+		http.Error(w, "Error retrieving values", http.StatusInternalServerError)
 		return
 	}
 
-	component := templates.PlansPage(plans, values)
+	component := templates.PlansPage(plans, values, form)
+	if !form.Valid() {
+		renderInvalidForm(w, r, "", component)
+		return
+	}
 	if err := component.Render(r.Context(), w); err != nil {
-		log.Printf("Error rendering Plans page: %v", err)
+		slog.ErrorContext(r.Context(), "Error rendering Plans page", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully rendered Plans page")
+	slog.DebugContext(r.Context(), "Successfully rendered Plans page")
 }
 
 // HandleCreatePlan creates a new plan
 func HandleCreatePlan(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		log.Printf("Error parsing form: %v", err)
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
 		http.Error(w, "Error parsing form", http.StatusBadRequest)
 		return
 	}
 
-	name := r.PostForm.Get("name")
-	description := r.PostForm.Get("description")
-	resourcesRequired := r.PostForm.Get("resources") // From the form field name="resources"
-	valueIDStr := r.PostForm.Get("valueID")
-
-	// Debug logging
-	log.Printf("Form data: name=%s, description=%s, resources=%s, valueID=%s",
-		name, description, resourcesRequired, valueIDStr)
-	valueID, err := strconv.ParseInt(valueIDStr, 10, 64)
-	if err != nil {
-		log.Printf("Invalid value ID: %v", err)
-		http.Error(w, "Invalid value ID", http.StatusBadRequest)
+	form := forms.New(r.PostForm)
+	aims, dueDate := validatePlanForm(form)
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for new plan", "errors", form.Errors)
+		renderPlansPage(w, r, form)
 		return
 	}
 
-	log.Printf("Creating new plan - Name: %s, Description: %s, Resources Required: %s, Value ID: %d", name, description, resourcesRequired, valueID)
-
-	id, err := models.CreatePlan(name, description, resourcesRequired, valueID)
+	id, err := models.CreatePlan(form.Get("name"), form.Get("description"), form.Get("resources"), aims, dueDate)
 	if err != nil {
-		log.Printf("Error creating plan: %v", err)
+		slog.ErrorContext(r.Context(), "Error creating plan", "err", err)
 		http.Error(w, "Error creating plan", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully created plan with ID: %d", id)
+	slog.InfoContext(r.Context(), "Successfully created plan", "id", id)
 	http.Redirect(w, r, "/plans", http.StatusSeeOther)
 }
 
+// validatePlanForm checks a plan creation or edition form and returns the
+// selected aims and the optional due date
+func validatePlanForm(form *forms.Form) ([]models.PlanAim, time.Time) {
+	form.Required("name", "description", "resources")
+	form.MaxLength("name", 200)
+	return parsePlanAims(form), form.Date("dueDate")
+}
+
+// parsePlanAims reads the aims checked in a plan or plan template form. Each
+// selected aim comes with a "weight-{id}" field, defaulting to 1.
+func parsePlanAims(form *forms.Form) []models.PlanAim {
+	var aims []models.PlanAim
+	for _, aimID := range form.IDs("aims") {
+		weight := form.PositiveFloat("weight-"+strconv.FormatInt(aimID, 10), 1)
+		aims = append(aims, models.PlanAim{AimID: aimID, Weight: weight})
+	}
+	for field, message := range form.Errors {
+		if strings.HasPrefix(field, "weight-") {
+			form.AddError("aims", "Weights: "+strings.ToLower(message))
+		}
+	}
+	if len(aims) == 0 {
+		form.AddError("aims", "Select at least one value")
+	}
+	return aims
+}
+
+// planForm fills a plan edition form with the current state of the plan
+func planForm(plan models.Plan) *forms.Form {
+	values := url.Values{
+		"name":        {plan.Name},
+		"description": {plan.Description},
+		"resources":   {plan.ResourcesRequired},
+	}
+	if !plan.DueDate.IsZero() {
+		values.Set("dueDate", plan.DueDate.Format("2006-01-02"))
+	}
+	for _, aim := range plan.Aims {
+		id := strconv.FormatInt(aim.AimID, 10)
+		values.Add("aims", id)
+		values.Set("weight-"+id, strconv.FormatFloat(aim.Weight, 'g', -1, 64))
+	}
+	return forms.New(values)
+}
+
 // HandleDeletePlan deletes a plan by ID
 func HandleDeletePlan(w http.ResponseWriter, r *http.Request) {
 	// Extract plan ID from URL or query
@@ -121,281 +171,428 @@ func HandleDeletePlan(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = models.DeletePlan(planID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Plan not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		log.Printf("Error deleting plan: %v", err)
+		slog.ErrorContext(r.Context(), "Error deleting plan", "err", err)
 		http.Error(w, "Error deleting plan", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully deleted plan with ID: %d", planID)
+	slog.InfoContext(r.Context(), "Successfully deleted plan", "id", planID)
+	respondTrashed(w, r, models.TrashPlan, planID, "/plans")
+}
 
-	// HTMX request handling - just return empty response to remove the row
-	if r.Header.Get("HX-Request") == "true" {
-		w.WriteHeader(http.StatusOK)
+// StartPlanHandler marks a plan as started
+func StartPlanHandler(w http.ResponseWriter, r *http.Request) {
+	changePlanStatus(w, r, models.StartPlan)
+}
+
+// CompletePlanHandler marks a plan as finished
+func CompletePlanHandler(w http.ResponseWriter, r *http.Request) {
+	changePlanStatus(w, r, models.CompletePlan)
+}
+
+// UpdatePlanProgressHandler updates the progress of a plan from the dashboard
+func UpdatePlanProgressHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Traditional form handling
-	http.Redirect(w, r, "/plans", http.StatusSeeOther)
+	parts := strings.Split(r.URL.Path, "/")
+	planID, err := strconv.ParseInt(parts[len(parts)-1], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid plan ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	progress, err := strconv.Atoi(r.PostForm.Get("progress"))
+	if err != nil {
+		http.Error(w, "Invalid progress", http.StatusBadRequest)
+		return
+	}
+
+	if err := models.SetPlanProgress(planID, progress); err != nil {
+		slog.ErrorContext(r.Context(), "Error updating progress of plan", "plan_id", planID, "err", err)
+		http.Error(w, "Error updating plan", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully updated progress of plan", "id", planID)
+
+	if r.Header.Get("HX-Request") == "true" {
+		renderDashboardWidget(w, r, "plans")
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-// EditPlanHandler handles rendering the edit form for a plan
-func EditPlanHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract plan ID from URL path
-	parts := strings.Split(r.URL.Path, "/")
-	if len(parts) < 3 {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
+// changePlanStatus applies a status change to the plan whose ID ends the URL path
+func changePlanStatus(w http.ResponseWriter, r *http.Request, change func(int64) error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	planIDStr := parts[len(parts)-1]
-	planID, err := strconv.ParseInt(planIDStr, 10, 64)
+	parts := strings.Split(r.URL.Path, "/")
+	planID, err := strconv.ParseInt(parts[len(parts)-1], 10, 64)
 	if err != nil {
 		http.Error(w, "Invalid plan ID", http.StatusBadRequest)
 		return
 	}
 
-	// Get the plan
-	plan, err := models.GetPlan(planID)
-	if err != nil {
-		log.Printf("Error retrieving plan: %v", err)
-		http.Error(w, "Error retrieving plan", http.StatusInternalServerError)
+	if err := change(planID); err != nil {
+		slog.ErrorContext(r.Context(), "Error changing status of plan", "plan_id", planID, "err", err)
+		http.Error(w, "Error updating plan", http.StatusInternalServerError)
 		return
 	}
 
-	// Get all values for the dropdown
+	slog.InfoContext(r.Context(), "Successfully changed status of plan", "id", planID)
+	http.Redirect(w, r, "/plans", http.StatusSeeOther)
+}
+
+// EditPlanHandler handles rendering the edit form for a plan
+func EditPlanHandler(w http.ResponseWriter, r *http.Request) {
+	plan, ok := getPlanFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// Get all values for the aims
 	values, err := models.GetAllValues()
 	if err != nil {
-		log.Printf("Error retrieving values: %v", err)
+		slog.ErrorContext(r.Context(), "Error retrieving values", "err", err)
 		http.Error(w, "Error retrieving values", http.StatusInternalServerError)
 		return
 	}
 
-	// Generate options HTML for dropdown
-	valueOptions := ""
-	for _, value := range values {
-		selected := ""
-		if value.ID == plan.ValueID {
-			selected = " selected"
-		}
-		valueOptions += fmt.Sprintf("<option value=\"%d\"%s>%s</option>", value.ID, selected, value.Name)
-	}
-
-	// Render the edit form
-	html := fmt.Sprintf(`
-		<tr id="plan-row-%d" class="editing">
-			<td>%d</td>
-			<td>
-				<input type="text" name="name" value="%s" required style="width: 100%%; box-sizing: border-box; padding: 4px;"/>
-			</td>
-			<td>
-				<textarea name="description" required style="width: 100%%; box-sizing: border-box; padding: 4px; min-height: 60px;">%s</textarea>
-			</td>
-			<td>
-				<input type="text" name="resources_required" value="%s" required style="width: 100%%; box-sizing: border-box; padding: 4px;"/>
-			</td>
-			<td>
-				<select name="value_id" required style="width: 100%%; box-sizing: border-box; padding: 4px;">
-					%s
-				</select>
-			</td>
-			<td>
-				<div style="display: flex; gap: 5px;">
-					<button
-						hx-put="/plans/update/%d"
-						hx-include="closest tr"
-						hx-target="#plan-row-%d"
-						hx-swap="outerHTML"
-						style="background-color: #4CAF50; color: white; border: none; padding: 5px 10px; cursor: pointer; border-radius: 3px;">
-						Save
-					</button>
-					<button
-						hx-get="/plans/cancel-edit/%d"
-						hx-target="#plan-row-%d"
-						hx-swap="outerHTML"
-						style="background-color: #f44336; color: white; border: none; padding: 5px 10px; cursor: pointer; border-radius: 3px;">
-						Cancel
-					</button>
-				</div>
-			</td>
-		</tr>
-	`, plan.ID, plan.ID, plan.Name, plan.Description, plan.ResourcesRequired, valueOptions, plan.ID, plan.ID, plan.ID, plan.ID)
-
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(html))
+	component := templates.EditPlanForm(plan, values, planForm(plan))
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering plan edit form", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
 }
 
 // CancelEditHandler handles cancelling an edit operation
 func CancelEditHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract plan ID from URL path
-	parts := strings.Split(r.URL.Path, "/")
-	if len(parts) < 3 {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
+	plan, ok := getPlanFromPath(w, r)
+	if !ok {
 		return
 	}
 
-	planIDStr := parts[len(parts)-1]
-	planID, err := strconv.ParseInt(planIDStr, 10, 64)
+	component := templates.PlanRow(plan)
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering plan row", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// UpdatePlanHandler handles updating a plan
+func UpdatePlanHandler(w http.ResponseWriter, r *http.Request) {
+	plan, ok := getPlanFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse form
+	err := r.ParseForm()
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	aims, dueDate := validatePlanForm(form)
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for plan", "plan_id", plan.ID, "errors", form.Errors)
+		values, err := models.GetAllValues()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error retrieving values", "err", err)
+			http.Error(w, "Error retrieving values", http.StatusInternalServerError)
+			return
+		}
+		renderInvalidForm(w, r, "", templates.EditPlanForm(plan, values, form))
+		return
+	}
+
+	// Update the plan
+	err = models.UpdatePlan(plan.ID, form.Get("name"), form.Get("description"), form.Get("resources"), aims, dueDate)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error updating plan", "err", err)
+		http.Error(w, "Error updating plan", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Successfully updated plan", "id", plan.ID)
+
+	// Get the updated plan
+	plan, err = models.GetPlan(plan.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving updated plan", "err", err)
+		http.Error(w, "Error retrieving updated plan", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.PlanRow(plan)
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering plan row", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// getPlanFromPath retrieves the plan whose ID ends the URL path. It writes
+// the error response and returns false if there is no such plan.
+func getPlanFromPath(w http.ResponseWriter, r *http.Request) (models.Plan, bool) {
+	parts := strings.Split(r.URL.Path, "/")
+	planID, err := strconv.ParseInt(parts[len(parts)-1], 10, 64)
 	if err != nil {
 		http.Error(w, "Invalid plan ID", http.StatusBadRequest)
+		return models.Plan{}, false
+	}
+
+	plan, err := models.GetPlan(planID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return plan, false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving plan", "err", err)
+		http.Error(w, "Error retrieving plan", http.StatusInternalServerError)
+		return plan, false
+	}
+	return plan, true
+}
+
+// PlanDetailHandler shows a plan with its milestones and the journal entries
+// about it on GET /plans/{id}, saves the ticked checklist items of its
+// description on POST /plans/{id}/tasks, and adds a milestone on POST
+// /plans/{id}/milestones
+func PlanDetailHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "PlanDetailHandler called", "path", r.URL.Path, "method", r.Method)
+
+	planID, action, err := parseDetailPath(r.URL.Path, "/plans/")
+	if err != nil {
+		http.NotFound(w, r)
 		return
 	}
 
-	// Get the plan
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		renderPlanPage(w, r, planID, forms.New(nil))
+	case action == "tasks" && r.Method == http.MethodPost:
+		handleTickPlanTasks(w, r, planID)
+	case action == "milestones" && r.Method == http.MethodPost:
+		handleCreateMilestone(w, r, planID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// renderPlanPage displays a plan, its milestones and the journal entries
+// about it with the given milestone form
+func renderPlanPage(w http.ResponseWriter, r *http.Request, planID int64, form *forms.Form) {
 	plan, err := models.GetPlan(planID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
 	if err != nil {
-		log.Printf("Error retrieving plan: %v", err)
+		slog.ErrorContext(r.Context(), "Error retrieving plan", "err", err)
 		http.Error(w, "Error retrieving plan", http.StatusInternalServerError)
 		return
 	}
 
-	// Get all values for display
-	values, err := models.GetAllValues()
+	milestones, err := models.GetMilestonesForPlan(planID)
 	if err != nil {
-		log.Printf("Error retrieving values: %v", err)
-		http.Error(w, "Error retrieving values", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error retrieving plan milestones", "err", err)
+		http.Error(w, "Error retrieving plan milestones", http.StatusInternalServerError)
 		return
 	}
 
-	// Find the value name
-	valueName := "Unknown"
-	for _, value := range values {
-		if value.ID == plan.ValueID {
-			valueName = value.Name
-			break
-		}
+	journals, err := models.GetJournalsForPlan(planID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving plan journals", "err", err)
+		http.Error(w, "Error retrieving plan journals", http.StatusInternalServerError)
+		return
 	}
 
-	// Render the normal row
-	html := fmt.Sprintf(`
-		<tr id="plan-row-%d">
-			<td>%d</td>
-			<td>%s</td>
-			<td>%s</td>
-			<td>%s</td>
-			<td>%s</td>
-			<td>
-				<button
-					hx-get="/plans/edit/%d"
-					hx-target="#plan-row-%d"
-					hx-swap="outerHTML">
-					Edit
-				</button>
-				<button
-					hx-delete="/plans/delete/%d"
-					hx-confirm="Are you sure you want to delete this plan?"
-					hx-target="#plan-row-%d"
-					hx-swap="outerHTML">
-					Delete
-				</button>
-			</td>
-		</tr>
-	`, plan.ID, plan.ID, plan.Name, plan.Description, plan.ResourcesRequired, valueName, plan.ID, plan.ID, plan.ID, plan.ID)
-
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(html))
+	component := templates.PlanPage(plan, milestones, journals, form)
+	if !form.Valid() {
+		renderInvalidForm(w, r, "", component)
+		return
+	}
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering Plan page", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
 }
 
-// UpdatePlanHandler handles updating a plan
-func UpdatePlanHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract plan ID from URL path
-	parts := strings.Split(r.URL.Path, "/")
-	if len(parts) < 3 {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
+// handleCreateMilestone adds the milestone from the form to a plan
+func handleCreateMilestone(w http.ResponseWriter, r *http.Request, planID int64) {
+	_, err := models.GetPlan(planID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving plan", "err", err)
+		http.Error(w, "Error retrieving plan", http.StatusInternalServerError)
 		return
 	}
 
-	planIDStr := parts[len(parts)-1]
-	planID, err := strconv.ParseInt(planIDStr, 10, 64)
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("milestoneName", "milestoneDueDate")
+	form.MaxLength("milestoneName", 200)
+	dueDate := form.Date("milestoneDueDate")
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for milestone", "errors", form.Errors)
+		renderPlanPage(w, r, planID, form)
+		return
+	}
+
+	id, err := models.CreateMilestone(planID, form.Get("milestoneName"), dueDate)
 	if err != nil {
-		http.Error(w, "Invalid plan ID", http.StatusBadRequest)
+		slog.ErrorContext(r.Context(), "Error creating milestone", "err", err)
+		http.Error(w, "Error creating milestone", http.StatusInternalServerError)
 		return
 	}
 
-	// Parse form
-	err = r.ParseForm()
+	slog.InfoContext(r.Context(), "Successfully created milestone", "id", id, "plan_id", planID)
+	http.Redirect(w, r, "/plans/"+strconv.FormatInt(planID, 10), http.StatusSeeOther)
+}
+
+// MilestoneDetailHandler marks a milestone as reached on POST
+// /milestones/{id}/complete, and moves it to the trash on POST
+// /milestones/{id}/delete
+func MilestoneDetailHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "MilestoneDetailHandler called", "path", r.URL.Path, "method", r.Method)
+
+	milestoneID, action, err := parseDetailPath(r.URL.Path, "/milestones/")
 	if err != nil {
-		log.Printf("Error parsing form: %v", err)
-		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		http.NotFound(w, r)
+		return
+	}
+
+	var change func(int64) error
+	switch {
+	case action == "complete" && r.Method == http.MethodPost:
+		change = models.CompleteMilestone
+	case action == "delete" && (r.Method == http.MethodPost || r.Method == http.MethodDelete):
+		change = models.DeleteMilestone
+	case action == "complete" || action == "delete":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	default:
+		http.NotFound(w, r)
 		return
 	}
 
-	// Get form values
-	name := r.PostForm.Get("name")
-	description := r.PostForm.Get("description")
-	resourcesRequired := r.PostForm.Get("resources_required")
-	valueIDStr := r.PostForm.Get("value_id")
+	milestone, err := models.GetMilestone(milestoneID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving milestone", "err", err)
+		http.Error(w, "Error retrieving milestone", http.StatusInternalServerError)
+		return
+	}
 
-	valueID, err := strconv.ParseInt(valueIDStr, 10, 64)
+	err = change(milestoneID)
+	if errors.Is(err, sql.ErrNoRows) && action == "complete" {
+		http.Error(w, "Milestone already reached", http.StatusConflict)
+		return
+	}
 	if err != nil {
-		log.Printf("Invalid value ID: %v", err)
-		http.Error(w, "Invalid value ID", http.StatusBadRequest)
+		slog.ErrorContext(r.Context(), "Error updating milestone", "err", err, "action", action)
+		http.Error(w, "Error updating milestone", http.StatusInternalServerError)
 		return
 	}
 
-	// Log the form values for debugging
-	log.Printf("Updating plan - ID: %d, Name: %s, Description: %s, Resources Required: %s, Value ID: %d",
-		planID, name, description, resourcesRequired, valueID)
+	slog.InfoContext(r.Context(), "Successfully updated milestone", "id", milestoneID, "action", action)
 
-	// Update the plan
-	err = models.UpdatePlan(planID, name, description, resourcesRequired, valueID)
+	planURL := "/plans/" + strconv.FormatInt(milestone.PlanID, 10)
+	if action == "delete" {
+		respondTrashed(w, r, models.TrashMilestone, milestoneID, planURL)
+		return
+	}
+	if r.Header.Get("HX-Request") != "true" {
+		http.Redirect(w, r, planURL, http.StatusSeeOther)
+		return
+	}
+	milestone, err = models.GetMilestone(milestoneID)
 	if err != nil {
-		log.Printf("Error updating plan: %v", err)
-		http.Error(w, "Error updating plan", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error retrieving milestone", "err", err)
+		http.Error(w, "Error retrieving milestone", http.StatusInternalServerError)
 		return
 	}
+	if err := templates.MilestoneItem(milestone).Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering milestone", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
 
-	// Get the updated plan
+// handleTickPlanTasks saves the checklist items of a plan description that
+// are ticked in the submitted form, and renders the description again
+func handleTickPlanTasks(w http.ResponseWriter, r *http.Request, planID int64) {
 	plan, err := models.GetPlan(planID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
 	if err != nil {
-		log.Printf("Error retrieving updated plan: %v", err)
-		http.Error(w, "Error retrieving updated plan", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error retrieving plan", "err", err)
+		http.Error(w, "Error retrieving plan", http.StatusInternalServerError)
 		return
 	}
 
-	// Get all values for display
-	values, err := models.GetAllValues()
-	if err != nil {
-		log.Printf("Error retrieving values: %v", err)
-		http.Error(w, "Error retrieving values", http.StatusInternalServerError)
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
 		return
 	}
 
-	// Find the value name
-	valueName := "Unknown"
-	for _, value := range values {
-		if value.ID == plan.ValueID {
-			valueName = value.Name
-			break
+	var ticked []int
+	for _, value := range r.PostForm["task"] {
+		index, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid task", http.StatusBadRequest)
+			return
 		}
+		ticked = append(ticked, index)
+	}
+
+	plan.Description = markdown.SetTasks(plan.Description, ticked)
+	if err := models.SetPlanDescription(planID, plan.Description); err != nil {
+		slog.ErrorContext(r.Context(), "Error updating plan description", "err", err)
+		http.Error(w, "Error updating plan description", http.StatusInternalServerError)
+		return
 	}
+	slog.InfoContext(r.Context(), "Successfully updated tasks of plan", "id", planID)
 
-	// Render the updated row
-	html := fmt.Sprintf(`
-		<tr id="plan-row-%d">
-			<td>%d</td>
-			<td>%s</td>
-			<td>%s</td>
-			<td>%s</td>
-			<td>%s</td>
-			<td>
-				<button
-					hx-get="/plans/edit/%d"
-					hx-target="#plan-row-%d"
-					hx-swap="outerHTML">
-					Edit
-				</button>
-				<button
-					hx-delete="/plans/delete/%d"
-					hx-confirm="Are you sure you want to delete this plan?"
-					hx-target="#plan-row-%d"
-					hx-swap="outerHTML">
-					Delete
-				</button>
-			</td>
-		</tr>
-	`, plan.ID, plan.ID, plan.Name, plan.Description, plan.ResourcesRequired, valueName, plan.ID, plan.ID, plan.ID, plan.ID)
-
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(html))
+	if r.Header.Get("HX-Request") != "true" {
+		http.Redirect(w, r, "/plans/"+strconv.FormatInt(planID, 10), http.StatusSeeOther)
+		return
+	}
+
+	component := templates.PlanDescription(plan)
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering plan description", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
 }
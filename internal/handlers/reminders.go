@@ -0,0 +1,535 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"pds/internal/forms"
+	"pds/internal/models"
+	"pds/internal/notify"
+	"pds/internal/templates"
+	"strings"
+	"time"
+)
+
+// defaultAppURL is the base URL of the links of notifications until the
+// URL of the app is configured
+const defaultAppURL = "http://localhost:8888"
+
+// vapidKeySetting is the setting holding the VAPID key of Web Push
+const vapidKeySetting = "vapid_private_key"
+
+// recentDeliveries is the number of deliveries listed on the reminders page
+const recentDeliveries = 20
+
+// deliveryTimeout bounds the time spent sending a notification
+const deliveryTimeout = time.Minute
+
+// RemindersHandler handles the Reminders page, and creates reminders on POST
+func RemindersHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "RemindersHandler called", "path", r.URL.Path, "method", r.Method)
+
+	switch r.Method {
+	case http.MethodGet:
+		renderRemindersPage(w, r, forms.New(nil), nil)
+	case http.MethodPost:
+		handleCreateReminder(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleCreateReminder creates a reminder from the form
+func handleCreateReminder(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("kind", "timeOfDay", "channel")
+	kinds := make([]string, len(models.ReminderKinds))
+	for i, kind := range models.ReminderKinds {
+		kinds[i] = kind.Kind
+	}
+	form.OneOf("kind", kinds...)
+	form.OneOf("channel", models.ChannelEmail, models.ChannelPush, models.ChannelWebhook)
+	timeOfDay, err := time.Parse("15:04", form.Get("timeOfDay"))
+	if err != nil {
+		form.AddError("timeOfDay", "Please enter a time such as 20:30")
+	}
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for new reminder", "errors", form.Errors)
+		renderRemindersPage(w, r, form, nil)
+		return
+	}
+
+	id, err := models.CreateReminder(form.Get("kind"), timeOfDay.Format("15:04"), form.Get("channel"), time.Now())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating reminder", "err", err)
+		http.Error(w, "Error creating reminder", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully created reminder", "id", id)
+	http.Redirect(w, r, "/reminders", http.StatusSeeOther)
+}
+
+// ReminderDetailHandler handles POST or DELETE /reminders/{id}/delete
+func ReminderDetailHandler(w http.ResponseWriter, r *http.Request) {
+	reminderID, action, err := parseDetailPath(r.URL.Path, "/reminders/")
+	if err != nil || action != "delete" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err = models.DeleteReminder(reminderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting reminder", "err", err)
+		http.Error(w, "Error deleting reminder", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Successfully deleted reminder", "id", reminderID)
+	respondTrashed(w, r, models.TrashReminder, reminderID, "/reminders")
+}
+
+// ReminderSettingsHandler handles POST /reminders/settings, which configures
+// the notification channels. The SMTP password is kept when left empty.
+func ReminderSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	validateURL(form, "appURL")
+	validateURL(form, "webhookURL")
+	if addr := form.Get("smtpAddr"); addr != "" {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			form.AddError("smtpAddr", "Please enter a host and port, e.g. smtp.example.com:587")
+		}
+	}
+	for _, field := range []string{"emailFrom", "emailTo"} {
+		if address := form.Get(field); address != "" {
+			if _, err := mail.ParseAddress(address); err != nil {
+				form.AddError(field, "Please enter a valid email address")
+			}
+		}
+	}
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for notification settings", "errors", form.Errors)
+		renderRemindersPage(w, r, forms.New(nil), form)
+		return
+	}
+
+	settings, err := models.GetNotificationSettings()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving notification settings", "err", err)
+		http.Error(w, "Error retrieving notification settings", http.StatusInternalServerError)
+		return
+	}
+	settings.AppURL = strings.TrimSuffix(form.Get("appURL"), "/")
+	settings.SMTPAddr = form.Get("smtpAddr")
+	settings.SMTPUsername = form.Get("smtpUsername")
+	if password := form.Get("smtpPassword"); password != "" || settings.SMTPUsername == "" {
+		settings.SMTPPassword = password
+	}
+	settings.EmailFrom = form.Get("emailFrom")
+	settings.EmailTo = form.Get("emailTo")
+	settings.WebhookURL = form.Get("webhookURL")
+	if err := models.SaveNotificationSettings(settings); err != nil {
+		slog.ErrorContext(r.Context(), "Error saving notification settings", "err", err)
+		http.Error(w, "Error saving notification settings", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully saved notification settings")
+	http.Redirect(w, r, "/reminders", http.StatusSeeOther)
+}
+
+// validateURL checks that an optional field holds an http or https URL
+func validateURL(form *forms.Form, field string) {
+	value := form.Get(field)
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		form.AddError(field, "Please enter a URL starting with http:// or https://")
+	}
+}
+
+// ReminderTestHandler handles POST /reminders/test, which queues a test
+// notification through the channel given in the form
+func ReminderTestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.OneOf("channel", models.ChannelEmail, models.ChannelPush, models.ChannelWebhook)
+	if !form.Valid() {
+		http.Error(w, "Invalid channel", http.StatusBadRequest)
+		return
+	}
+
+	_, err := models.EnqueueDelivery(0, form.Get("channel"), "Test notification", "Notifications from the Journal App reach you.", "")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error queuing test notification", "err", err)
+		http.Error(w, "Error queuing test notification", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Queued test notification", "channel", form.Get("channel"))
+	http.Redirect(w, r, "/reminders", http.StatusSeeOther)
+}
+
+// pushSubscriptionRequest is the JSON of a PushSubscription of the browser
+type pushSubscriptionRequest struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// PushSubscriptionsHandler handles POST /reminders/push-subscriptions, which
+// subscribes the browser to push notifications
+func PushSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var subscription pushSubscriptionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&subscription); err != nil {
+		http.Error(w, "Invalid subscription", http.StatusBadRequest)
+		return
+	}
+	endpoint, err := url.Parse(subscription.Endpoint)
+	if err != nil || endpoint.Scheme != "https" || subscription.Keys.P256dh == "" || subscription.Keys.Auth == "" {
+		http.Error(w, "Invalid subscription", http.StatusBadRequest)
+		return
+	}
+
+	if err := models.SavePushSubscription(subscription.Endpoint, subscription.Keys.P256dh, subscription.Keys.Auth); err != nil {
+		slog.ErrorContext(r.Context(), "Error saving push subscription", "err", err)
+		http.Error(w, "Error saving push subscription", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Successfully saved push subscription")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// renderRemindersPage renders the reminders page with the reminder form and
+// the settings form, filled with the stored settings if nil
+func renderRemindersPage(w http.ResponseWriter, r *http.Request, form, settingsForm *forms.Form) {
+	reminders, err := models.GetAllReminders()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving reminders", "err", err)
+		http.Error(w, "Error retrieving reminders", http.StatusInternalServerError)
+		return
+	}
+
+	deliveries, err := models.GetRecentDeliveries(recentDeliveries)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving deliveries", "err", err)
+		http.Error(w, "Error retrieving deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	if settingsForm == nil {
+		settings, err := models.GetNotificationSettings()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error retrieving notification settings", "err", err)
+			http.Error(w, "Error retrieving notification settings", http.StatusInternalServerError)
+			return
+		}
+		settingsForm = forms.New(url.Values{
+			"appURL":       {settings.AppURL},
+			"smtpAddr":     {settings.SMTPAddr},
+			"smtpUsername": {settings.SMTPUsername},
+			"emailFrom":    {settings.EmailFrom},
+			"emailTo":      {settings.EmailTo},
+			"webhookURL":   {settings.WebhookURL},
+		})
+	}
+
+	keys, err := vapidKeys()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving VAPID keys", "err", err)
+		http.Error(w, "Error retrieving push notification keys", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.RemindersPage(reminders, deliveries, form, settingsForm, keys.PublicKey())
+	if !form.Valid() || !settingsForm.Valid() {
+		renderInvalidForm(w, r, "", component)
+		return
+	}
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering Reminders page", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.DebugContext(r.Context(), "Successfully rendered Reminders page", "count", len(reminders))
+}
+
+// vapidKeys returns the keys identifying the app to push services,
+// generating them on first use
+func vapidKeys() (notify.VAPIDKeys, error) {
+	stored, err := models.GetSetting(vapidKeySetting)
+	if err != nil {
+		return notify.VAPIDKeys{}, err
+	}
+	if stored != "" {
+		return notify.ParseVAPIDKeys(stored)
+	}
+
+	keys, err := notify.GenerateVAPIDKeys()
+	if err != nil {
+		return notify.VAPIDKeys{}, err
+	}
+	return keys, models.SetSetting(vapidKeySetting, keys.String())
+}
+
+// RunReminders queues the notifications of the reminders whose time has
+// come. It is run periodically in the background.
+func RunReminders() error {
+	now := time.Now()
+	reminders, err := models.GetDueReminders(now)
+	if err != nil {
+		return fmt.Errorf("retrieving due reminders: %w", err)
+	}
+
+	appURL, err := notificationAppURL()
+	if err != nil {
+		return fmt.Errorf("retrieving notification settings: %w", err)
+	}
+
+	for _, reminder := range reminders {
+		n, ok, err := reminderNotification(reminder, appURL, now)
+		if err != nil {
+			slog.Error("Error preparing reminder", "reminder_id", reminder.ID, "err", err)
+			continue
+		}
+		if ok {
+			if _, err := models.EnqueueDelivery(reminder.ID, reminder.Channel, n.Title, n.Body, n.URL); err != nil {
+				slog.Error("Error queuing reminder", "reminder_id", reminder.ID, "err", err)
+				continue
+			}
+			slog.Info("Queued reminder", "reminder_id", reminder.ID, "channel", reminder.Channel)
+		}
+		if err := models.MarkReminderFired(reminder.ID, now); err != nil {
+			slog.Error("Error marking reminder as sent", "reminder_id", reminder.ID, "err", err)
+		}
+	}
+	return nil
+}
+
+// notificationAppURL returns the base URL of the links of notifications
+func notificationAppURL() (string, error) {
+	settings, err := models.GetNotificationSettings()
+	if err != nil || settings.AppURL == "" {
+		return defaultAppURL, err
+	}
+	return settings.AppURL, nil
+}
+
+// reminderNotification writes the notification of a reminder. It returns
+// false when there is nothing to remind, e.g. the journal of the day was
+// already written or no plan is overdue.
+func reminderNotification(reminder models.Reminder, appURL string, now time.Time) (notify.Notification, bool, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	switch reminder.Kind {
+	case models.ReminderDailyReview:
+		journals, err := models.GetJournalsForDay(today)
+		if err != nil || len(journals) > 0 {
+			return notify.Notification{}, false, err
+		}
+		return notify.Notification{
+			Title: "Time for your daily review",
+			Body:  "Take a few minutes to write the journal of your day.",
+			URL:   appURL + "/journals",
+		}, true, nil
+
+	case models.ReminderHabits:
+		habits, err := models.GetAllHabits()
+		if err != nil {
+			return notify.Notification{}, false, err
+		}
+		var lines []string
+		for _, habit := range habits {
+			if habit.Pending(now) {
+				lines = append(lines, fmt.Sprintf("- %s (%s, streak of %d %s)", habit.Name, habit.ScheduleText(), habit.Streak(now), habit.StreakUnit()))
+			}
+		}
+		if len(lines) == 0 {
+			return notify.Notification{}, false, nil
+		}
+		return notify.Notification{
+			Title: pluralize(len(lines), "habit", "habits") + " left to check in today",
+			Body:  strings.Join(lines, "\n"),
+			URL:   appURL + "/habits",
+		}, true, nil
+
+	case models.ReminderOverduePlans:
+		plans, err := models.GetPlansOverdueAt(now)
+		if err != nil || len(plans) == 0 {
+			return notify.Notification{}, false, err
+		}
+		lines := make([]string, len(plans))
+		for i, plan := range plans {
+			lines[i] = fmt.Sprintf("- %s (due %s)", plan.Name, plan.DueDate.Format("Jan 02, 2006"))
+		}
+		return notify.Notification{
+			Title: pluralize(len(plans), "plan is", "plans are") + " overdue",
+			Body:  strings.Join(lines, "\n"),
+			URL:   appURL + "/plans",
+		}, true, nil
+
+	case models.ReminderStatement:
+		statement, err := models.GetStatementOfTheDay(today)
+		if errors.Is(err, sql.ErrNoRows) {
+			return notify.Notification{}, false, nil
+		}
+		if err != nil {
+			return notify.Notification{}, false, err
+		}
+		return notify.Notification{
+			Title: "Statement of the day",
+			Body:  statement.Content,
+			URL:   appURL + "/statements/rehearse",
+		}, true, nil
+	}
+	return notify.Notification{}, false, fmt.Errorf("unknown reminder kind %q", reminder.Kind)
+}
+
+// pluralize formats a count with the singular or plural form of a noun
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return "1 " + singular
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
+
+// DeliverNotifications attempts to send the queued notifications. It is run
+// periodically in the background.
+func DeliverNotifications() error {
+	now := time.Now()
+	deliveries, err := models.GetPendingDeliveries(now)
+	if err != nil {
+		return fmt.Errorf("retrieving pending deliveries: %w", err)
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	settings, err := models.GetNotificationSettings()
+	if err != nil {
+		return fmt.Errorf("retrieving notification settings: %w", err)
+	}
+
+	for _, delivery := range deliveries {
+		err := sendDelivery(delivery, settings)
+		if err != nil {
+			slog.Warn("Error sending notification", "delivery_id", delivery.ID, "channel", delivery.Channel, "attempt", delivery.Attempts+1, "err", err)
+		} else {
+			slog.Info("Sent notification", "delivery_id", delivery.ID, "channel", delivery.Channel)
+		}
+		if err := models.RecordDeliveryAttempt(delivery, err, time.Now()); err != nil {
+			slog.Error("Error recording delivery attempt", "delivery_id", delivery.ID, "err", err)
+		}
+	}
+	return nil
+}
+
+// sendDelivery sends a queued notification through its channel
+func sendDelivery(delivery models.Delivery, settings models.NotificationSettings) error {
+	notifier, err := notifierFor(delivery.Channel, settings)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+	return notifier.Notify(ctx, notify.Notification{Title: delivery.Title, Body: delivery.Body, URL: delivery.URL})
+}
+
+// notifierFor returns the notifier of a channel, configured with the
+// settings
+func notifierFor(channel string, settings models.NotificationSettings) (notify.Notifier, error) {
+	switch channel {
+	case models.ChannelEmail:
+		return notify.SMTP{
+			Addr:     settings.SMTPAddr,
+			Username: settings.SMTPUsername,
+			Password: settings.SMTPPassword,
+			From:     settings.EmailFrom,
+			To:       settings.EmailTo,
+		}, nil
+	case models.ChannelWebhook:
+		return notify.Webhook{URL: settings.WebhookURL}, nil
+	case models.ChannelPush:
+		keys, err := vapidKeys()
+		if err != nil {
+			return nil, err
+		}
+		stored, err := models.GetAllPushSubscriptions()
+		if err != nil {
+			return nil, err
+		}
+		subscriptions := make([]notify.PushSubscription, len(stored))
+		for i, s := range stored {
+			subscriptions[i] = notify.PushSubscription{Endpoint: s.Endpoint, P256dh: s.P256dh, Auth: s.Auth}
+		}
+		// Push services require a contact of the sender
+		subject := "mailto:" + settings.EmailTo
+		if settings.EmailTo == "" {
+			subject = settings.AppURL
+		}
+		if subject == "" {
+			subject = defaultAppURL
+		}
+		return notify.WebPush{
+			Keys:          keys,
+			Subject:       subject,
+			Subscriptions: subscriptions,
+			Expired: func(s notify.PushSubscription) {
+				slog.Info("Removing expired push subscription")
+				if err := models.DeletePushSubscription(s.Endpoint); err != nil {
+					slog.Error("Error deleting push subscription", "err", err)
+				}
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown channel %q", channel)
+}
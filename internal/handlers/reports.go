@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"pds/internal/models"
+	"pds/internal/templates"
+	"strings"
+	"time"
+)
+
+// ReportsHandler handles /reports/{week|month}/{date}: it shows the report,
+// exports it with ?format=md or ?format=html, and saves the reflection on POST
+func ReportsHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "ReportsHandler called", "path", r.URL.Path, "method", r.Method)
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 1 {
+		// Default to the current week
+		http.Redirect(w, r, "/reports/week/"+time.Now().Format("2006-01-02"), http.StatusSeeOther)
+		return
+	}
+	if len(parts) != 3 {
+		http.NotFound(w, r)
+		return
+	}
+
+	period := parts[1]
+	date, err := parseReportDate(parts[2])
+	if err != nil {
+		slog.WarnContext(r.Context(), "Invalid report date", "date", parts[2], "err", err)
+		http.Error(w, "Invalid report date", http.StatusBadRequest)
+		return
+	}
+	if period != models.ReportWeek && period != models.ReportMonth {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		handleGetReport(w, r, period, date)
+	case http.MethodPost:
+		handleSaveReflection(w, r, period, date)
+	default:
+		slog.WarnContext(r.Context(), "Method not allowed for reports", "method", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// parseReportDate accepts either a day or, for monthly reports, a month
+func parseReportDate(value string) (time.Time, error) {
+	if date, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return date, nil
+	}
+	return time.ParseInLocation("2006-01", value, time.Local)
+}
+
+// handleGetReport renders or exports a report
+func handleGetReport(w http.ResponseWriter, r *http.Request, period string, date time.Time) {
+	report, err := models.BuildReport(period, date)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error building report", "err", err)
+		http.Error(w, "Error building report", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("report-%s-%s", period, report.Start.Format("2006-01-02"))
+
+	switch r.URL.Query().Get("format") {
+	case "md", "markdown":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.md"`)
+		writeReportMarkdown(w, report)
+	case "html":
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.html"`)
+		component := templates.ReportDocument(report)
+		if err := component.Render(r.Context(), w); err != nil {
+			slog.ErrorContext(r.Context(), "Error rendering report document", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+	default:
+		component := templates.ReportPage(report)
+		if err := component.Render(r.Context(), w); err != nil {
+			slog.ErrorContext(r.Context(), "Error rendering report page", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		slog.DebugContext(r.Context(), "Successfully rendered report", "period", period, "start", report.Start.Format("2006-01-02"))
+	}
+}
+
+// handleSaveReflection saves the reflection written about a report
+func handleSaveReflection(w http.ResponseWriter, r *http.Request, period string, date time.Time) {
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	start, _, err := models.ReportRange(period, date)
+	if err != nil {
+		http.Error(w, "Invalid report period", http.StatusBadRequest)
+		return
+	}
+
+	reflection := r.PostForm.Get("reflection")
+	if err := models.SaveReportReflection(period, start, reflection); err != nil {
+		slog.ErrorContext(r.Context(), "Error saving reflection", "err", err)
+		http.Error(w, "Error saving reflection", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully saved reflection", "period", period, "start", start.Format("2006-01-02"))
+
+	if r.Header.Get("HX-Request") == "true" {
+		component := templates.ReflectionSaved(time.Now())
+		if err := component.Render(r.Context(), w); err != nil {
+			slog.ErrorContext(r.Context(), "Error rendering saved reflection", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+}
+
+// writeReportMarkdown exports a report as a Markdown document
+func writeReportMarkdown(w io.Writer, report models.Report) {
+	fmt.Fprintf(w, "# %s\n\n", templates.ReportTitle(report))
+
+	fmt.Fprintf(w, "## Journals\n\n")
+	if len(report.JournalCounts) == 0 {
+		fmt.Fprintf(w, "No journal entries.\n")
+	}
+	for _, count := range report.JournalCounts {
+		fmt.Fprintf(w, "- %s: %d\n", count.JournalType, count.Count)
+	}
+	fmt.Fprintf(w, "\nTotal: %d\n\n", report.TotalJournals)
+
+	fmt.Fprintf(w, "## Behaviour occurrences\n\n")
+	if len(report.BehaviourOccurrences) == 0 {
+		fmt.Fprintf(w, "No behaviour occurrences.\n")
+	}
+	for _, count := range report.BehaviourOccurrences {
+		fmt.Fprintf(w, "- %s: %d\n", count.AimName, count.Count)
+	}
+
+	fmt.Fprintf(w, "\n## Plans\n\n")
+	writeMarkdownPlans(w, "Started", report.PlansStarted)
+	writeMarkdownPlans(w, "Finished", report.PlansFinished)
+	writeMarkdownPlans(w, "Overdue", report.PlansOverdue)
+
+	fmt.Fprintf(w, "## Attention\n\n### Most attention\n\n")
+	for _, a := range report.MostAttention {
+		fmt.Fprintf(w, "- %s (%d)\n", a.AimName, a.Total())
+	}
+	fmt.Fprintf(w, "\n### Least attention\n\n")
+	for _, a := range report.LeastAttention {
+		fmt.Fprintf(w, "- %s (%d)\n", a.AimName, a.Total())
+	}
+
+	fmt.Fprintf(w, "\n## Mood\n\n")
+	if len(report.Moods) == 0 {
+		fmt.Fprintf(w, "No mood recorded.\n")
+	} else {
+		fmt.Fprintf(w, "Average: %.1f (%s)\n\n", report.MoodAverage, templates.FormatTrend(report.MoodTrend()))
+		for _, point := range report.Moods {
+			fmt.Fprintf(w, "- %s: %.1f\n", point.Day.Format("Mon Jan 02"), point.Average)
+		}
+	}
+
+	if report.Reflection != "" {
+		fmt.Fprintf(w, "\n## Reflection\n\n%s\n", report.Reflection)
+	}
+}
+
+// writeMarkdownPlans writes a titled list of plans
+func writeMarkdownPlans(w io.Writer, title string, plans []models.Plan) {
+	fmt.Fprintf(w, "### %s\n\n", title)
+	if len(plans) == 0 {
+		fmt.Fprintf(w, "None.\n")
+	}
+	for _, plan := range plans {
+		fmt.Fprintf(w, "- %s\n", plan.Name)
+	}
+	fmt.Fprintf(w, "\n")
+}
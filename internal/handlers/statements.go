@@ -1,23 +1,27 @@
 package handlers
 
 import (
-	"log"
+	"database/sql"
+	"errors"
+	"log/slog"
 	"net/http"
+	"pds/internal/forms"
 	"pds/internal/models"
 	"pds/internal/templates"
 	"strconv"
+	"time"
 )
 
 // StatementsHandler handles the Statements page
 func StatementsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("StatementsHandler called with path: %s, method: %s", r.URL.Path, r.Method)
+	slog.DebugContext(r.Context(), "StatementsHandler called", "path", r.URL.Path, "method", r.Method)
 
 	// Handle GET requests
 	if r.Method == http.MethodGet {
-		log.Printf("Handling GET request for Statements page")
+		slog.DebugContext(r.Context(), "Handling GET request for Statements page")
 		handleGetStatements(w, r)
 	} else {
-		log.Printf("Method %s not allowed for Statements page", r.Method)
+		slog.WarnContext(r.Context(), "Method not allowed for Statements page", "method", r.Method)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
@@ -31,95 +35,290 @@ func CreateStatementHandler(w http.ResponseWriter, r *http.Request) {
 
 	err := r.ParseForm()
 	if err != nil {
-		log.Printf("Error parsing form: %v", err)
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
 		http.Error(w, "Error parsing form", http.StatusBadRequest)
 		return
 	}
 
-	content := r.PostForm.Get("content")
-	priorityStr := r.PostForm.Get("priority")
-	priority, err := strconv.Atoi(priorityStr)
-	if err != nil {
-		log.Printf("Invalid priority: %v", err)
-		priority = 0 // Default priority
+	form := forms.New(r.PostForm)
+	content := form.Get("content")
+	form.Required("content")
+	priority := form.Int("priority", 0, 10, 0)
+	form.IDs("aims")
+	form.IDs("behaviours")
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for new statement", "errors", form.Errors)
+		renderStatementsPage(w, r, form)
+		return
 	}
 
-	log.Printf("Creating new statement - Content: %s, Priority: %d", content, priority)
+	slog.DebugContext(r.Context(), "Creating new statement", "priority", priority)
 
 	id, err := models.CreateStatement(content, priority)
 	if err != nil {
-		log.Printf("Error creating statement: %v", err)
+		slog.ErrorContext(r.Context(), "Error creating statement", "err", err)
 		http.Error(w, "Error creating statement", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully created statement with ID: %d", id)
+	if err := saveStatementLinks(id, r); err != nil {
+		slog.ErrorContext(r.Context(), "Error linking statement", "err", err)
+		http.Error(w, "Error linking statement", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully created statement", "id", id)
 	http.Redirect(w, r, "/statements", http.StatusSeeOther)
 }
 
-// DeleteStatementHandler handles deleting statements
+// DeleteStatementHandler handles POST requests to move statements to the trash
 func DeleteStatementHandler(w http.ResponseWriter, r *http.Request) {
-	var statementIDStr string
-
-	if r.Method == http.MethodPost {
-		// Parse form for POST requests
-		if err := r.ParseForm(); err != nil {
-			log.Printf("Error parsing form: %v", err)
-			http.Error(w, "Error parsing form", http.StatusBadRequest)
-			return
-		}
-		statementIDStr = r.PostForm.Get("statementID")
-		log.Printf("POST Delete - Form data: %+v, statementID: %s", r.PostForm, statementIDStr)
-	} else if r.Method == http.MethodGet {
-		// Get query parameters for GET requests
-		statementIDStr = r.URL.Query().Get("statementID")
-		log.Printf("GET Delete - Query params: %+v, statementID: %s", r.URL.Query(), statementIDStr)
-	} else {
+	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	statementIDStr := r.PostForm.Get("statementID")
+	slog.DebugContext(r.Context(), "Deleting statement", "statement_id", statementIDStr)
+
 	// Parse the statement ID
 	statementID, err := strconv.ParseInt(statementIDStr, 10, 64)
 	if err != nil {
-		log.Printf("Invalid statement ID: %v", err)
+		slog.WarnContext(r.Context(), "Invalid statement ID", "err", err)
 		http.Error(w, "Invalid statement ID", http.StatusBadRequest)
 		return
 	}
 
 	if statementID <= 0 {
-		log.Printf("Missing statement ID")
+		slog.WarnContext(r.Context(), "Missing statement ID")
 		http.Error(w, "statementID is required", http.StatusBadRequest)
 		return
 	}
 
 	// Delete the statement
 	err = models.DeleteStatement(statementID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Statement not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		log.Printf("Error deleting statement: %v", err)
+		slog.ErrorContext(r.Context(), "Error deleting statement", "err", err)
 		http.Error(w, "Error deleting statement", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully deleted statement with ID: %d", statementID)
-	http.Redirect(w, r, "/statements", http.StatusSeeOther)
+	slog.InfoContext(r.Context(), "Successfully deleted statement", "id", statementID)
+	respondTrashed(w, r, models.TrashStatement, statementID, "/statements")
+}
+
+// saveStatementLinks replaces the aims and behaviours linked to a statement
+// with the ones selected in the submitted form
+func saveStatementLinks(statementID int64, r *http.Request) error {
+	aimIDs, err := parseIDs(r.PostForm["aims"])
+	if err != nil {
+		return err
+	}
+	behaviourIDs, err := parseIDs(r.PostForm["behaviours"])
+	if err != nil {
+		return err
+	}
+
+	if err := models.SetStatementAims(statementID, aimIDs); err != nil {
+		return err
+	}
+	return models.SetStatementBehaviours(statementID, behaviourIDs)
+}
+
+// StatementDetailHandler shows a statement with the aims and behaviours it is
+// linked to on GET /statements/{id}, and updates these links on POST /statements/{id}/links
+func StatementDetailHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "StatementDetailHandler called", "path", r.URL.Path, "method", r.Method)
+
+	statementID, action, err := parseDetailPath(r.URL.Path, "/statements/")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		handleGetStatement(w, r, statementID)
+	case action == "links" && r.Method == http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+			http.Error(w, "Error parsing form", http.StatusBadRequest)
+			return
+		}
+		if err := saveStatementLinks(statementID, r); err != nil {
+			slog.ErrorContext(r.Context(), "Error linking statement", "err", err)
+			http.Error(w, "Error linking statement", http.StatusBadRequest)
+			return
+		}
+		slog.InfoContext(r.Context(), "Successfully updated links of statement", "id", statementID)
+		http.Redirect(w, r, "/statements/"+strconv.FormatInt(statementID, 10), http.StatusSeeOther)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleGetStatement displays a statement and its links
+func handleGetStatement(w http.ResponseWriter, r *http.Request, statementID int64) {
+	statement, err := models.GetStatement(statementID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving statement", "err", err)
+		http.Error(w, "Error retrieving statement", http.StatusInternalServerError)
+		return
+	}
+
+	linkedAims, err := models.GetAimsForStatement(statementID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving statement aims", "err", err)
+		http.Error(w, "Error retrieving statement aims", http.StatusInternalServerError)
+		return
+	}
+
+	linkedBehaviours, err := models.GetBehavioursForStatement(statementID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving statement behaviours", "err", err)
+		http.Error(w, "Error retrieving statement behaviours", http.StatusInternalServerError)
+		return
+	}
+
+	aims, behaviours, err := getLinkChoices()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving link choices", "err", err)
+		http.Error(w, "Error retrieving link choices", http.StatusInternalServerError)
+		return
+	}
+
+	rehearsals, err := models.GetRehearsals(statementID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving rehearsals", "err", err)
+		http.Error(w, "Error retrieving rehearsals", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.StatementPage(statement, linkedAims, linkedBehaviours, aims, behaviours, rehearsals)
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering Statement page", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// getLinkChoices retrieves the aims and behaviours a statement can be linked to
+func getLinkChoices() ([]models.Aim, []models.Behaviour, error) {
+	aims, err := models.GetAllValues()
+	if err != nil {
+		return nil, nil, err
+	}
+	behaviours, err := models.GetAllBehaviours()
+	return aims, behaviours, err
 }
 
 // handleGetStatements retrieves and displays all statements
 func handleGetStatements(w http.ResponseWriter, r *http.Request) {
+	renderStatementsPage(w, r, forms.New(nil))
+}
+
+// renderStatementsPage renders the Statements page with the given creation form
+func renderStatementsPage(w http.ResponseWriter, r *http.Request, form *forms.Form) {
 	statements, err := models.GetAllStatements()
 	if err != nil {
-		log.Printf("Error retrieving statements: %v", err)
+		slog.ErrorContext(r.Context(), "Error retrieving statements", "err", err)
 		http.Error(w, "Error retrieving statements", http.StatusInternalServerError)
 		return
 	}
 
-	component := templates.StatementsPage(statements)
+	aims, behaviours, err := getLinkChoices()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving link choices", "err", err)
+		http.Error(w, "Error retrieving link choices", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.StatementsPage(statements, aims, behaviours, form)
+	if !form.Valid() {
+		renderInvalidForm(w, r, "", component)
+		return
+	}
 	if err := component.Render(r.Context(), w); err != nil {
-		log.Printf("Error rendering Statements page: %v", err)
+		slog.ErrorContext(r.Context(), "Error rendering Statements page", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully rendered Statements page with %d statements", len(statements))
+	slog.DebugContext(r.Context(), "Successfully rendered Statements page", "count", len(statements))
+}
+
+// RehearseHandler shows the statements one at a time on GET, and records how
+// strongly the rehearsed statement resonated on POST before showing the next one
+func RehearseHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "RehearseHandler called", "method", r.Method)
+
+	switch r.Method {
+	case http.MethodGet:
+		renderNextRehearsal(w, r)
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+			http.Error(w, "Error parsing form", http.StatusBadRequest)
+			return
+		}
+
+		statementID, err := strconv.ParseInt(r.PostForm.Get("statementID"), 10, 64)
+		if err != nil {
+			slog.WarnContext(r.Context(), "Invalid statement ID", "err", err)
+			http.Error(w, "Invalid statement ID", http.StatusBadRequest)
+			return
+		}
+
+		resonance, err := strconv.Atoi(r.PostForm.Get("resonance"))
+		if err != nil || resonance < models.MinResonance || resonance > models.MaxResonance {
+			slog.WarnContext(r.Context(), "Invalid resonance", "resonance", r.PostForm.Get("resonance"))
+			http.Error(w, "Invalid resonance", http.StatusBadRequest)
+			return
+		}
+
+		statement, err := models.RehearseStatement(statementID, resonance, time.Now())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error rehearsing statement", "err", err)
+			http.Error(w, "Error rehearsing statement", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Statement rehearsed", "statement_id", statement.ID, "interval_days", statement.IntervalDays)
+		renderNextRehearsal(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// renderNextRehearsal renders the next statement to rehearse, as a fragment
+// for HTMX requests and as a full page otherwise
+func renderNextRehearsal(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	statement, err := models.NextStatementToRehearse(now)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		slog.ErrorContext(r.Context(), "Error picking statement to rehearse", "err", err)
+		http.Error(w, "Error picking statement to rehearse", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.RehearsalPage(statement, now)
+	if r.Header.Get("HX-Request") == "true" {
+		component = templates.RehearsalCard(statement, now)
+	}
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering rehearsal", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
 }
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"pds/internal/forms"
+	"pds/internal/models"
+	"pds/internal/templates"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxTrashRetentionDays is the longest deleted items can be kept in the trash
+const maxTrashRetentionDays = 3650
+
+// respondTrashed answers a request that moved an item to the trash. HTMX
+// requests get an empty body, removing the item from the page, and a toast
+// to undo the deletion; other requests are redirected.
+func respondTrashed(w http.ResponseWriter, r *http.Request, itemType string, id int64, redirectURL string) {
+	if r.Header.Get("HX-Request") != "true" {
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if err := templates.UndoToast(itemType, id).Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering undo toast", "err", err)
+	}
+}
+
+// TrashHandler handles the trash page on GET /trash, and saves how long
+// deleted items are kept on POST
+func TrashHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "TrashHandler called", "path", r.URL.Path, "method", r.Method)
+
+	switch r.Method {
+	case http.MethodGet:
+		days, err := models.GetTrashRetentionDays()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error retrieving trash retention", "err", err)
+			http.Error(w, "Error retrieving trash retention", http.StatusInternalServerError)
+			return
+		}
+		renderTrashPage(w, r, forms.New(url.Values{"retentionDays": {strconv.Itoa(days)}}))
+	case http.MethodPost:
+		handleSaveTrashSettings(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSaveTrashSettings stores how long deleted items are kept
+func handleSaveTrashSettings(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("retentionDays")
+	days := form.Int("retentionDays", 1, maxTrashRetentionDays, models.DefaultTrashRetentionDays)
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for trash settings", "errors", form.Errors)
+		renderTrashPage(w, r, form)
+		return
+	}
+
+	if err := models.SetTrashRetentionDays(days); err != nil {
+		slog.ErrorContext(r.Context(), "Error saving trash retention", "err", err)
+		http.Error(w, "Error saving trash retention", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully saved trash retention", "days", days)
+	http.Redirect(w, r, "/trash", http.StatusSeeOther)
+}
+
+// renderTrashPage renders the trash page with its settings form
+func renderTrashPage(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	items, err := models.GetTrash()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving trash", "err", err)
+		http.Error(w, "Error retrieving trash", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.TrashPage(items, form)
+	if !form.Valid() {
+		renderInvalidForm(w, r, "", component)
+		return
+	}
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering Trash page", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	slog.DebugContext(r.Context(), "Successfully rendered Trash page", "count", len(items))
+}
+
+// TrashItemHandler restores an item on POST /trash/{type}/{id}/restore,
+// deletes it permanently on POST /trash/{type}/{id}/purge, and deletes
+// everything in the trash permanently on POST /trash/empty
+func TrashItemHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "TrashItemHandler called", "path", r.URL.Path, "method", r.Method)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/trash/"), "/")
+	if rest == "empty" {
+		handleEmptyTrash(w, r)
+		return
+	}
+
+	itemType, detail, _ := strings.Cut(rest, "/")
+	id, action, err := parseDetailPath(detail, "")
+	if err != nil || !slices.Contains(models.TrashTypes, itemType) {
+		slog.WarnContext(r.Context(), "Invalid path format for trash item", "path", r.URL.Path)
+		http.NotFound(w, r)
+		return
+	}
+
+	switch action {
+	case "restore":
+		err = models.RestoreTrashItem(itemType, id)
+	case "purge":
+		err = models.PurgeTrashItem(itemType, id)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Item not found in the trash", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error changing trash item", "type", itemType, "id", id, "action", action, "err", err)
+		http.Error(w, "Error changing trash item", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Successfully changed trash item", "type", itemType, "id", id, "action", action)
+
+	if action == "purge" && itemType == models.TrashJournal {
+		CollectAttachmentGarbage()
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		// A restored item shows up again on the page it was deleted from
+		if action == "restore" {
+			w.Header().Set("HX-Refresh", "true")
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, "/trash", http.StatusSeeOther)
+}
+
+// handleEmptyTrash deletes everything in the trash permanently
+func handleEmptyTrash(w http.ResponseWriter, r *http.Request) {
+	purged, err := models.PurgeTrash(time.Now())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error emptying trash", "err", err)
+		http.Error(w, "Error emptying trash", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Successfully emptied trash", "count", purged)
+	CollectAttachmentGarbage()
+	http.Redirect(w, r, "/trash", http.StatusSeeOther)
+}
+
+// RunTrashPurge permanently deletes the items that have been in the trash
+// for longer than the retention. It is run periodically in the background.
+func RunTrashPurge() error {
+	days, err := models.GetTrashRetentionDays()
+	if err != nil {
+		return fmt.Errorf("retrieving trash retention: %w", err)
+	}
+	purged, err := models.PurgeTrash(time.Now().AddDate(0, 0, -days))
+	if purged > 0 {
+		slog.Info("Purged items from the trash", "count", purged, "retention_days", days)
+		CollectAttachmentGarbage()
+	}
+	if err != nil {
+		return fmt.Errorf("purging trash: %w", err)
+	}
+	return nil
+}
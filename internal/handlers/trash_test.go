@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pds/internal/database"
+	"pds/internal/models"
+)
+
+func TestEmptyTrashWithChildren(t *testing.T) {
+	valueID, err := models.CreateValue("Health", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	planID, err := models.CreatePlan("Run a marathon", "", "", []models.PlanAim{{AimID: valueID, Weight: 1}}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	milestoneID, err := models.CreateMilestone(planID, "Run a half marathon", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	behaviourID, err := models.CreateBehaviour("Skipping runs", "", "", valueID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intentionID, err := models.CreateIntention(behaviourID, "it rains", "run on the treadmill", planID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The milestone is trashed before its plan, so that the plan is purged
+	// first, along with the milestone
+	if err := models.DeleteMilestone(milestoneID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.DB.Exec("UPDATE plan_milestones SET deleted_at = datetime('now', '-1 minute') WHERE id = ?", milestoneID); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.DeletePlan(planID); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	TrashItemHandler(rec, httptest.NewRequest(http.MethodPost, "/trash/empty", nil))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("emptying the trash answered %d: %s", rec.Code, rec.Body)
+	}
+	items, err := models.GetTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Errorf("%d items left in the trash: %+v", len(items), items)
+	}
+
+	var planRef *int64
+	if err := database.DB.QueryRow("SELECT plan_id FROM intentions WHERE id = ?", intentionID).Scan(&planRef); err != nil {
+		t.Fatal(err)
+	}
+	if planRef != nil {
+		t.Errorf("the intention still follows the purged plan %d", *planRef)
+	}
+}
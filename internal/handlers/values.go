@@ -1,11 +1,15 @@
 package handlers
 
 import (
-	"log"
+	"database/sql"
+	"errors"
+	"log/slog"
 	"net/http"
+	"pds/internal/forms"
 	"pds/internal/models"
 	"pds/internal/templates"
 	"strconv"
+	"time"
 )
 
 // ValuesHandler handles the Values page.
@@ -25,19 +29,19 @@ func handleGetChildren(w http.ResponseWriter, r *http.Request) {
 
 	children, err := models.GetChildren(valueID)
 	if err != nil {
-		log.Printf("Error retrieving children: %v", err)
+		slog.ErrorContext(r.Context(), "Error retrieving children", "err", err)
 		http.Error(w, "Error retrieving children", http.StatusInternalServerError)
 		return
 	}
 
 	component := templates.ChildrenPage(children)
 	if err := component.Render(r.Context(), w); err != nil {
-		log.Printf("Error rendering Children page: %v", err)
+		slog.ErrorContext(r.Context(), "Error rendering Children page", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully rendered Children page")
+	slog.DebugContext(r.Context(), "Successfully rendered Children page")
 }
 
 // handleGetParents retrieves and displays parents for a specific value.
@@ -55,89 +59,109 @@ func handleGetParents(w http.ResponseWriter, r *http.Request) {
 
 	parents, err := models.GetParents(valueID)
 	if err != nil {
-		log.Printf("Error retrieving parents: %v", err)
+		slog.ErrorContext(r.Context(), "Error retrieving parents", "err", err)
 		http.Error(w, "Error retrieving parents", http.StatusInternalServerError)
 		return
 	}
 
 	component := templates.ParentsPage(parents)
 	if err := component.Render(r.Context(), w); err != nil {
-		log.Printf("Error rendering Parents page: %v", err)
+		slog.ErrorContext(r.Context(), "Error rendering Parents page", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully rendered Parents page")
+	slog.DebugContext(r.Context(), "Successfully rendered Parents page")
 }
 
 func ValuesHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("ValuesHandler called with path: %s, method: %s", r.URL.Path, r.Method)
+	slog.DebugContext(r.Context(), "ValuesHandler called", "path", r.URL.Path, "method", r.Method)
 
 	// Handle GET, POST, and DELETE requests
 	switch r.Method {
 	case http.MethodGet:
-		log.Printf("Handling GET request for Values page")
+		slog.DebugContext(r.Context(), "Handling GET request for Values page")
 		handleGetValues(w, r)
 	case http.MethodPost:
-		log.Printf("Handling POST request for Values page")
+		slog.DebugContext(r.Context(), "Handling POST request for Values page")
 		handleCreateValue(w, r)
 	case http.MethodDelete:
-		log.Printf("Handling DELETE request for Values page")
+		slog.DebugContext(r.Context(), "Handling DELETE request for Values page")
 		handleDeleteValue(w, r)
 	default:
-		log.Printf("Method %s not allowed for Values page", r.Method)
+		slog.WarnContext(r.Context(), "Method not allowed for Values page", "method", r.Method)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
 // handleGetValues retrieves and displays all values.
 func handleGetValues(w http.ResponseWriter, r *http.Request) {
+	renderValuesPage(w, r, forms.New(nil))
+}
+
+// renderValuesPage renders the Values page with the given creation form.
+func renderValuesPage(w http.ResponseWriter, r *http.Request, form *forms.Form) {
 	values, err := models.GetAllValues()
 	if err != nil {
-		log.Printf("Error retrieving values: %v", err)
+		slog.ErrorContext(r.Context(), "Error retrieving values", "err", err)
 		http.Error(w, "Error retrieving values", http.StatusInternalServerError)
 		return
 	}
 
-	component := templates.ValuesPage(values)
+	healths, err := models.GetAimHealth(time.Now())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error computing aim health", "err", err)
+		http.Error(w, "Error computing aim health", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.ValuesPage(values, models.AimHealthTree(healths), form)
+	if !form.Valid() {
+		renderInvalidForm(w, r, "", component)
+		return
+	}
 	if err := component.Render(r.Context(), w); err != nil {
-		log.Printf("Error rendering Values page: %v", err)
+		slog.ErrorContext(r.Context(), "Error rendering Values page", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully rendered Values page")
+	slog.DebugContext(r.Context(), "Successfully rendered Values page")
 }
 
 // handleCreateValue creates a new value with parent relationships.
 func handleCreateValue(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		log.Printf("Error parsing form: %v", err)
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
 		http.Error(w, "Error parsing form", http.StatusBadRequest)
 		return
 	}
 
-	name := r.PostForm.Get("name")
-	description := r.PostForm.Get("description")
+	form := forms.New(r.PostForm)
+	name := form.Get("name")
+	description := form.Get("description")
 	parentIDs := r.PostForm["parents"]
 
-	log.Printf("Creating new value - Name: %s, Description: %s, Parent IDs: %v", name, description, parentIDs)
+	slog.DebugContext(r.Context(), "Creating new value", "parent_ids", parentIDs)
 
-	if name == "" {
-		log.Printf("Validation failed: name is empty")
-		http.Error(w, "Name is required", http.StatusBadRequest)
+	form.Required("name")
+	form.MaxLength("name", 200)
+	form.IDs("parents")
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for new value", "errors", form.Errors)
+		renderValuesPage(w, r, form)
 		return
 	}
 
 	id, err := models.CreateValue(name, description, parentIDs)
 	if err != nil {
-		log.Printf("Error creating value: %v", err)
+		slog.ErrorContext(r.Context(), "Error creating value", "err", err)
 		http.Error(w, "Error creating value", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully created value with ID: %d", id)
+	slog.InfoContext(r.Context(), "Successfully created value", "id", id)
 	http.Redirect(w, r, "/values", http.StatusSeeOther)
 }
 
@@ -155,14 +179,18 @@ func handleDeleteValue(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = models.DeleteValue(valueID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Value not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		log.Printf("Error deleting value: %v", err)
+		slog.ErrorContext(r.Context(), "Error deleting value", "err", err)
 		http.Error(w, "Error deleting value", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully deleted value with ID: %d", valueID)
-	http.Redirect(w, r, "/values", http.StatusSeeOther)
+	slog.InfoContext(r.Context(), "Successfully deleted value", "id", valueID)
+	respondTrashed(w, r, models.TrashValue, valueID, "/values")
 }
 
 // DeleteValueHandler handles POST requests to delete a value
@@ -174,7 +202,7 @@ func DeleteValueHandler(w http.ResponseWriter, r *http.Request) {
 
 	err := r.ParseForm()
 	if err != nil {
-		log.Printf("Error parsing form: %v", err)
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
 		http.Error(w, "Error parsing form", http.StatusBadRequest)
 		return
 	}
@@ -191,12 +219,122 @@ func DeleteValueHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = models.DeleteValue(valueID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Value not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		log.Printf("Error deleting value: %v", err)
+		slog.ErrorContext(r.Context(), "Error deleting value", "err", err)
 		http.Error(w, "Error deleting value", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully deleted value with ID: %d", valueID)
-	http.Redirect(w, r, "/values", http.StatusSeeOther)
+	slog.InfoContext(r.Context(), "Successfully deleted value", "id", valueID)
+	respondTrashed(w, r, models.TrashValue, valueID, "/values")
+}
+
+// ValueDetailHandler shows a value with its parents, children and supporting
+// statements on GET /values/{id}, and updates these statements on POST /values/{id}/statements
+func ValueDetailHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "ValueDetailHandler called", "path", r.URL.Path, "method", r.Method)
+
+	valueID, action, err := parseDetailPath(r.URL.Path, "/values/")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		handleGetValue(w, r, valueID)
+	case action == "statements" && r.Method == http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+			http.Error(w, "Error parsing form", http.StatusBadRequest)
+			return
+		}
+		statementIDs, err := parseIDs(r.PostForm["statements"])
+		if err != nil {
+			http.Error(w, "Invalid statement ID", http.StatusBadRequest)
+			return
+		}
+		if err := models.SetAimStatements(valueID, statementIDs); err != nil {
+			slog.ErrorContext(r.Context(), "Error linking value statements", "err", err)
+			http.Error(w, "Error linking value statements", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Successfully updated statements of value", "id", valueID)
+		http.Redirect(w, r, "/values/"+strconv.FormatInt(valueID, 10), http.StatusSeeOther)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleGetValue displays a value and what is related to it
+func handleGetValue(w http.ResponseWriter, r *http.Request, valueID int64) {
+	value, err := models.GetValue(valueID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving value", "err", err)
+		http.Error(w, "Error retrieving value", http.StatusInternalServerError)
+		return
+	}
+
+	parents, err := models.GetParents(valueID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving parents", "err", err)
+		http.Error(w, "Error retrieving parents", http.StatusInternalServerError)
+		return
+	}
+
+	children, err := models.GetChildren(valueID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving children", "err", err)
+		http.Error(w, "Error retrieving children", http.StatusInternalServerError)
+		return
+	}
+
+	linked, err := models.GetStatementsForAim(valueID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving value statements", "err", err)
+		http.Error(w, "Error retrieving value statements", http.StatusInternalServerError)
+		return
+	}
+
+	statements, err := models.GetAllStatements()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving statements", "err", err)
+		http.Error(w, "Error retrieving statements", http.StatusInternalServerError)
+		return
+	}
+
+	contributions, err := models.GetPlansServingAim(valueID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving value plans", "err", err)
+		http.Error(w, "Error retrieving value plans", http.StatusInternalServerError)
+		return
+	}
+
+	journals, err := models.GetJournalsForAim(valueID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving value journals", "err", err)
+		http.Error(w, "Error retrieving value journals", http.StatusInternalServerError)
+		return
+	}
+
+	health, err := models.GetHealthOfAim(valueID, time.Now())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error computing value health", "err", err)
+		http.Error(w, "Error computing value health", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.ValuePage(value, health, parents, children, linked, statements, contributions, journals)
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering Value page", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
 }
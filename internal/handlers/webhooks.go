@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"pds/internal/events"
+	"pds/internal/forms"
+	"pds/internal/models"
+	"pds/internal/templates"
+	"pds/internal/webhooks"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// webhookPing is the type of the event sent to test a webhook
+const webhookPing = "webhook.ping"
+
+// recentWebhookDeliveries is the number of deliveries listed in the log
+const recentWebhookDeliveries = 50
+
+// WebhooksHandler handles the Webhooks page, and registers webhooks on POST
+func WebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "WebhooksHandler called", "path", r.URL.Path, "method", r.Method)
+
+	switch r.Method {
+	case http.MethodGet:
+		renderWebhooksPage(w, r, forms.New(nil))
+	case http.MethodPost:
+		handleCreateWebhook(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleCreateWebhook registers a webhook from the form
+func handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		slog.WarnContext(r.Context(), "Error parsing form", "err", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("url")
+	validateURL(form, "url")
+	eventTypes := form.Values["eventTypes"]
+	if len(eventTypes) == 0 {
+		form.AddError("eventTypes", "Please choose at least one event")
+	}
+	for _, eventType := range eventTypes {
+		if !slices.Contains(events.Types, eventType) {
+			form.AddError("eventTypes", "This value is not allowed")
+			break
+		}
+	}
+	if !form.Valid() {
+		slog.WarnContext(r.Context(), "Validation failed for new webhook", "errors", form.Errors)
+		renderWebhooksPage(w, r, form)
+		return
+	}
+
+	id, err := models.CreateWebhook(form.Get("url"), eventTypes)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating webhook", "err", err)
+		http.Error(w, "Error creating webhook", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Successfully created webhook", "id", id)
+	http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+}
+
+// WebhookDetailHandler handles POST or DELETE /webhooks/{id}/delete, and
+// POST /webhooks/{id}/ping which sends a test event to the webhook
+func WebhookDetailHandler(w http.ResponseWriter, r *http.Request) {
+	webhookID, action, err := parseDetailPath(r.URL.Path, "/webhooks/")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch action {
+	case "delete":
+		if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		err := models.DeleteWebhook(webhookID)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error deleting webhook", "err", err)
+			http.Error(w, "Error deleting webhook", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Successfully deleted webhook", "id", webhookID)
+		respondTrashed(w, r, models.TrashWebhook, webhookID, "/webhooks")
+		return
+	case "ping":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		webhook, err := models.GetWebhook(webhookID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error retrieving webhook", "err", err)
+			http.NotFound(w, r)
+			return
+		}
+		event := events.Event{
+			ID:         "evt_ping_" + strconv.FormatInt(time.Now().UnixNano(), 10),
+			Type:       webhookPing,
+			OccurredAt: time.Now().UTC(),
+			Data:       map[string]any{"webhook_id": webhook.ID},
+		}
+		if err := queueWebhookDelivery(webhook, event); err != nil {
+			slog.ErrorContext(r.Context(), "Error queueing webhook ping", "err", err)
+			http.Error(w, "Error queueing webhook ping", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Queued a ping of webhook", "webhook_id", webhookID)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+}
+
+// WebhookDeliveryHandler handles POST /webhooks/deliveries/{id}/retry, which
+// queues a delivery again, e.g. once the receiver is fixed
+func WebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	deliveryID, action, err := parseDetailPath(r.URL.Path, "/webhooks/deliveries/")
+	if err != nil || action != "retry" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := models.RetryWebhookDelivery(deliveryID); err != nil {
+		slog.ErrorContext(r.Context(), "Error retrying webhook delivery", "err", err)
+		http.Error(w, "Error retrying webhook delivery", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Queued webhook delivery again", "delivery_id", deliveryID)
+	http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+}
+
+// renderWebhooksPage renders the webhooks page with the webhook form and the
+// delivery log
+func renderWebhooksPage(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	hooks, err := models.GetAllWebhooks()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving webhooks", "err", err)
+		http.Error(w, "Error retrieving webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	deliveries, err := models.GetRecentWebhookDeliveries(recentWebhookDeliveries)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving webhook deliveries", "err", err)
+		http.Error(w, "Error retrieving webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.WebhooksPage(hooks, deliveries, events.Types, form)
+	if !form.Valid() {
+		renderInvalidForm(w, r, "", component)
+		return
+	}
+	if err := component.Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering Webhooks page", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.DebugContext(r.Context(), "Successfully rendered Webhooks page", "count", len(hooks))
+}
+
+// QueueWebhookDeliveries queues the delivery of an event to the webhooks
+// receiving its type. It subscribes to the domain events.
+func QueueWebhookDeliveries(event events.Event) {
+	hooks, err := models.GetWebhooksForEvent(event.Type)
+	if err != nil {
+		slog.Error("Error retrieving webhooks for event", "event_type", event.Type, "err", err)
+		return
+	}
+	for _, webhook := range hooks {
+		if err := queueWebhookDelivery(webhook, event); err != nil {
+			slog.Error("Error queueing event for webhook", "event_type", event.Type, "webhook_id", webhook.ID, "err", err)
+		}
+	}
+}
+
+// queueWebhookDelivery queues the delivery of an event to a webhook
+func queueWebhookDelivery(webhook models.Webhook, event events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = models.EnqueueWebhookDelivery(webhook.ID, event.ID, event.Type, string(payload))
+	return err
+}
+
+// DeliverWebhooks attempts to post the queued events to their webhooks. It
+// is run periodically in the background.
+func DeliverWebhooks() error {
+	deliveries, err := models.GetPendingWebhookDeliveries(time.Now())
+	if err != nil {
+		return fmt.Errorf("retrieving pending webhook deliveries: %w", err)
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	hooks, err := models.GetAllWebhooks()
+	if err != nil {
+		return fmt.Errorf("retrieving webhooks: %w", err)
+	}
+	secrets := make(map[int64]string, len(hooks))
+	for _, webhook := range hooks {
+		secrets[webhook.ID] = webhook.Secret
+	}
+
+	for _, delivery := range deliveries {
+		ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+		status, err := webhooks.Send(ctx, delivery.WebhookURL, secrets[delivery.WebhookID],
+			strconv.FormatInt(delivery.ID, 10), delivery.EventType, []byte(delivery.Payload))
+		cancel()
+		if err != nil {
+			slog.Warn("Error delivering event to webhook", "event_type", delivery.EventType, "url", delivery.WebhookURL, "attempt", delivery.Attempts+1, "err", err)
+		} else {
+			slog.Info("Delivered event to webhook", "event_type", delivery.EventType, "url", delivery.WebhookURL)
+		}
+		if err := models.RecordWebhookDeliveryAttempt(delivery, status, err, time.Now()); err != nil {
+			slog.Error("Error recording webhook delivery attempt", "delivery_id", delivery.ID, "err", err)
+		}
+	}
+	return nil
+}
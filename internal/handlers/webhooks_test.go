@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"pds/internal/database"
+	"pds/internal/events"
+	"pds/internal/models"
+	"pds/internal/webhooks"
+	"pds/internal/webhooks/webhookstest"
+)
+
+func TestMain(m *testing.M) {
+	// The migrations are read relative to the root of the repository
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	dir, err := os.MkdirTemp("", "pds-handlers-test")
+	if err != nil {
+		panic(err)
+	}
+	if err := database.Initialize(filepath.Join(dir, "test.db")); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	database.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// queueTestDelivery registers a webhook posting to a URL and queues the
+// delivery of an event to it
+func queueTestDelivery(t *testing.T, url string) (models.Webhook, int64) {
+	t.Helper()
+	id, err := models.CreateWebhook(url, []string{events.PlanCreated})
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhook, err := models.GetWebhook(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliveryID, err := models.EnqueueWebhookDelivery(id, "event-"+strconv.FormatInt(id, 10), events.PlanCreated, `{"id":1}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return webhook, deliveryID
+}
+
+// getTestDelivery retrieves a delivery by ID
+func getTestDelivery(t *testing.T, id int64) models.WebhookDelivery {
+	t.Helper()
+	deliveries, err := models.GetRecentWebhookDeliveries(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, delivery := range deliveries {
+		if delivery.ID == id {
+			return delivery
+		}
+	}
+	t.Fatalf("delivery %d not found", id)
+	return models.WebhookDelivery{}
+}
+
+// makeDeliveryDue moves the next attempt of a delivery to now, as if its
+// retry delay had passed
+func makeDeliveryDue(t *testing.T, id int64) {
+	t.Helper()
+	if _, err := database.DB.Exec("UPDATE webhook_deliveries SET next_attempt_at = CURRENT_TIMESTAMP WHERE id = ?", id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeliverWebhooksRetries(t *testing.T) {
+	server, requests := webhookstest.NewReceiver(t, http.StatusInternalServerError, http.StatusOK)
+	webhook, deliveryID := queueTestDelivery(t, server.URL)
+
+	if err := DeliverWebhooks(); err != nil {
+		t.Fatalf("DeliverWebhooks: %v", err)
+	}
+	first := <-requests
+	delivery := getTestDelivery(t, deliveryID)
+	if delivery.Status != models.DeliveryPending || delivery.Attempts != 1 || delivery.ResponseStatus != http.StatusInternalServerError || delivery.LastError == "" {
+		t.Errorf("after a failed attempt: %+v", delivery)
+	}
+	if delay := time.Until(delivery.NextAttemptAt); delay < 50*time.Second || delay > 70*time.Second {
+		t.Errorf("retried in %v, want a minute", delay)
+	}
+
+	// The delivery is not attempted again before its delay
+	if err := DeliverWebhooks(); err != nil {
+		t.Fatalf("DeliverWebhooks: %v", err)
+	}
+	if len(requests) != 0 {
+		t.Fatal("the delivery was retried before its delay")
+	}
+
+	makeDeliveryDue(t, deliveryID)
+	if err := DeliverWebhooks(); err != nil {
+		t.Fatalf("DeliverWebhooks: %v", err)
+	}
+	retry := <-requests
+	delivery = getTestDelivery(t, deliveryID)
+	if delivery.Status != models.DeliverySent || delivery.Attempts != 2 || delivery.ResponseStatus != http.StatusOK || delivery.SentAt.IsZero() {
+		t.Errorf("after a successful retry: %+v", delivery)
+	}
+	want := strconv.FormatInt(deliveryID, 10)
+	for _, req := range []webhookstest.Request{first, retry} {
+		if got := req.Header.Get(webhooks.HeaderDelivery); got != want {
+			t.Errorf("delivery ID %q, want %q", got, want)
+		}
+		if err := webhooks.Verify(webhook.Secret, req.Header, req.Body, time.Now()); err != nil {
+			t.Errorf("Verify: %v", err)
+		}
+	}
+}
+
+func TestDeliverWebhooksGivesUp(t *testing.T) {
+	server, requests := webhookstest.NewReceiver(t, http.StatusServiceUnavailable)
+	_, deliveryID := queueTestDelivery(t, server.URL)
+
+	var previousDelay time.Duration
+	for attempt := 1; attempt <= models.MaxDeliveryAttempts; attempt++ {
+		makeDeliveryDue(t, deliveryID)
+		if err := DeliverWebhooks(); err != nil {
+			t.Fatalf("DeliverWebhooks: %v", err)
+		}
+		<-requests
+
+		delivery := getTestDelivery(t, deliveryID)
+		if delivery.Attempts != attempt {
+			t.Fatalf("%d attempts, want %d", delivery.Attempts, attempt)
+		}
+		if attempt < models.MaxDeliveryAttempts {
+			if delivery.Status != models.DeliveryPending {
+				t.Errorf("attempt %d: status %q, want pending", attempt, delivery.Status)
+			}
+			// The delays increase, so that a receiver that is down is not flooded
+			delay := time.Until(delivery.NextAttemptAt)
+			if delay < previousDelay {
+				t.Errorf("attempt %d: retried in %v, after %v the last time", attempt, delay, previousDelay)
+			}
+			previousDelay = delay
+		} else if delivery.Status != models.DeliveryFailed {
+			t.Errorf("status %q after %d attempts, want failed", delivery.Status, attempt)
+		}
+	}
+
+	makeDeliveryDue(t, deliveryID)
+	if err := DeliverWebhooks(); err != nil {
+		t.Fatalf("DeliverWebhooks: %v", err)
+	}
+	if len(requests) != 0 {
+		t.Error("a failed delivery was attempted again")
+	}
+}
@@ -0,0 +1,227 @@
+// Package ical reads and writes the iCalendar format (RFC 5545) used by
+// calendar apps. Only all-day events and to-dos are supported.
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Component kinds
+const (
+	KindEvent = "VEVENT"
+	KindTodo  = "VTODO"
+)
+
+// maxLineLength is the length in octets after which lines are folded
+const maxLineLength = 75
+
+// Entry is an all-day event or to-do of a calendar
+type Entry struct {
+	Kind        string // KindEvent or KindTodo
+	UID         string
+	Summary     string
+	Description string
+	URL         string
+	Date        time.Time // Day of an event, due day of a to-do
+	RRule       string    // Recurrence rule of an event, if it repeats
+	Completed   time.Time // Completion time of a to-do, zero if it is not done
+}
+
+// Write writes a calendar with the given entries
+func Write(w io.Writer, name string, entries []Entry, now time.Time) error {
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeLine(bw, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//pds//Journal App//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("X-WR-CALNAME", escape(name))
+	for _, entry := range entries {
+		line("BEGIN", entry.Kind)
+		line("UID", escape(entry.UID))
+		line("DTSTAMP", now.UTC().Format("20060102T150405Z"))
+		line("SUMMARY", escape(entry.Summary))
+		if entry.Description != "" {
+			line("DESCRIPTION", escape(entry.Description))
+		}
+		if entry.URL != "" {
+			line("URL", entry.URL)
+		}
+		if entry.Kind == KindTodo {
+			line("DUE;VALUE=DATE", entry.Date.Format("20060102"))
+			if entry.Completed.IsZero() {
+				line("STATUS", "NEEDS-ACTION")
+			} else {
+				line("STATUS", "COMPLETED")
+				line("COMPLETED", entry.Completed.UTC().Format("20060102T150405Z"))
+			}
+		} else {
+			line("DTSTART;VALUE=DATE", entry.Date.Format("20060102"))
+			line("DTEND;VALUE=DATE", entry.Date.AddDate(0, 0, 1).Format("20060102"))
+			if entry.RRule != "" {
+				line("RRULE", entry.RRule)
+			}
+		}
+		line("END", entry.Kind)
+	}
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+// writeLine writes a content line, folded so that no line is longer than
+// maxLineLength octets. UTF-8 sequences are never split.
+func writeLine(w *bufio.Writer, s string) {
+	length := 0
+	for _, r := range s {
+		size := len(string(r))
+		if length+size > maxLineLength {
+			w.WriteString("\r\n ")
+			length = 1
+		}
+		w.WriteRune(r)
+		length += size
+	}
+	w.WriteString("\r\n")
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// escape escapes a TEXT value
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// unescape reads an escaped TEXT value
+func unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' || s[i] == 'N' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// Parse reads the events and to-dos of a calendar. Entries without a date
+// are returned with a zero Date.
+func Parse(r io.Reader) ([]Entry, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	var current *Entry
+	for _, line := range lines {
+		name, params, value, ok := splitLine(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case name == "BEGIN" && (value == KindEvent || value == KindTodo):
+			current = &Entry{Kind: value}
+		case name == "END" && current != nil && value == current.Kind:
+			entries = append(entries, *current)
+			current = nil
+		case current == nil:
+			continue
+		case name == "UID":
+			current.UID = unescape(value)
+		case name == "SUMMARY":
+			current.Summary = unescape(value)
+		case name == "DESCRIPTION":
+			current.Description = unescape(value)
+		case name == "URL":
+			current.URL = value
+		case name == "RRULE":
+			current.RRule = value
+		case name == "DUE" || (name == "DTSTART" && current.Date.IsZero()):
+			date, err := parseDate(params, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %w", name, value, err)
+			}
+			current.Date = date
+		case name == "COMPLETED":
+			if completed, err := parseDate(nil, value); err == nil {
+				current.Completed = completed
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("no event or to-do found")
+	}
+	return entries, nil
+}
+
+// unfold reads the content lines, joining the folded ones
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// splitLine splits a content line such as "DUE;VALUE=DATE:20260101" into
+// its uppercase name, its parameters and its value
+func splitLine(line string) (string, map[string]string, string, bool) {
+	// Parameters may contain quoted colons, e.g. TZID="America/New_York"
+	inQuotes := false
+	for i, r := range line {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == ':' && !inQuotes:
+			head := strings.Split(line[:i], ";")
+			params := make(map[string]string)
+			for _, param := range head[1:] {
+				key, value, _ := strings.Cut(param, "=")
+				params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+			}
+			return strings.ToUpper(head[0]), params, line[i+1:], true
+		}
+	}
+	return "", nil, "", false
+}
+
+// parseDate reads a DATE or DATE-TIME value. Date-times are converted to
+// the local time zone; those without a zone are taken as local.
+func parseDate(params map[string]string, value string) (time.Time, error) {
+	if len(value) == len("20060102") {
+		return time.ParseInLocation("20060102", value, time.Local)
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t.Local(), err
+	}
+	location := time.Local
+	if tzid := params["TZID"]; tzid != "" {
+		if loc, err := time.LoadLocation(tzid); err == nil {
+			location = loc
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, location)
+	return t.Local(), err
+}
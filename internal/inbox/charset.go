@@ -0,0 +1,77 @@
+package inbox
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrUndecodable is returned for a text that cannot be decoded to UTF-8,
+// e.g. in an unknown charset
+var ErrUndecodable = errors.New("text cannot be decoded to UTF-8")
+
+// windows1252 maps the bytes 0x80 to 0x9F of windows-1252 to their runes.
+// The bytes it leaves undefined are kept as the C1 controls they are in
+// ISO-8859-1.
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+// iso885915 maps the bytes where ISO-8859-15 differs from ISO-8859-1
+var iso885915 = map[byte]rune{
+	0xA4: '€', 0xA6: 'Š', 0xA8: 'š', 0xB4: 'Ž', 0xB8: 'ž', 0xBC: 'Œ', 0xBD: 'œ', 0xBE: 'Ÿ',
+}
+
+// toUTF8 decodes a text in a charset to UTF-8. A text without charset must
+// already be valid UTF-8.
+func toUTF8(charset string, data []byte) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8":
+		if !utf8.Valid(data) {
+			return "", fmt.Errorf("%w: invalid UTF-8", ErrUndecodable)
+		}
+		return string(data), nil
+	// Like browsers, ISO-8859-1 is read as windows-1252, its superset that
+	// mail clients often send under its name
+	case "us-ascii", "ascii", "iso-8859-1", "iso8859-1", "latin1", "windows-1252", "cp1252":
+		return decodeSingleByte(data, nil), nil
+	case "iso-8859-15", "iso8859-15", "latin-9", "latin9":
+		return decodeSingleByte(data, iso885915), nil
+	}
+	return "", fmt.Errorf("%w: unknown charset %q", ErrUndecodable, charset)
+}
+
+// decodeSingleByte decodes a text in windows-1252, with the given bytes
+// mapped to other runes
+func decodeSingleByte(data []byte, overrides map[byte]rune) string {
+	var b strings.Builder
+	b.Grow(len(data))
+	for _, c := range data {
+		switch r, ok := overrides[c]; {
+		case ok:
+			b.WriteRune(r)
+		case c >= 0x80 && c < 0xA0:
+			b.WriteRune(windows1252[c-0x80])
+		default:
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String()
+}
+
+// charsetReader decodes the encoded words of headers, e.g. the subject, in
+// the charsets mime.WordDecoder does not know
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	text, err := toUTF8(charset, data)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(text), nil
+}
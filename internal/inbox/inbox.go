@@ -0,0 +1,345 @@
+// Package inbox reads the emails delivered to a Maildir, e.g. by fetchmail
+// or the local mail server, and parses them into their subject, text and
+// attached files.
+package inbox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// maxMessageSize bounds the size of the messages read
+const maxMessageSize = 32 << 20
+
+// ErrTooLarge is returned for messages larger than maxMessageSize
+var ErrTooLarge = fmt.Errorf("message is larger than %d MB", maxMessageSize>>20)
+
+// Message is a parsed email
+type Message struct {
+	From        string   // Address of the sender
+	Verified    bool     // Whether the mail server authenticated the domain of the sender
+	Recipients  []string // Addresses the message was delivered or sent to
+	Subject     string
+	Text        string // Plain text of the body, without the signature
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a message
+type Attachment struct {
+	Filename string
+	Data     []byte
+}
+
+// Maildir is a mail directory, whose new/ subdirectory receives the
+// messages. Read messages are moved to cur/.
+type Maildir string
+
+// New lists the names of the messages not read yet, oldest first
+func (m Maildir) New() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(string(m), "new"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+	// Names start with the delivery time in seconds
+	sort.Strings(names)
+	return names, nil
+}
+
+// Read parses a message not read yet
+func (m Maildir) Read(name string) (Message, error) {
+	f, err := os.Open(filepath.Join(string(m), "new", name))
+	if err != nil {
+		return Message{}, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxMessageSize+1))
+	if err != nil {
+		return Message{}, err
+	}
+	if len(data) > maxMessageSize {
+		return Message{}, ErrTooLarge
+	}
+	return Parse(bytes.NewReader(data))
+}
+
+// MarkRead moves a message to cur/ with the seen flag, so that it is not read
+// again
+func (m Maildir) MarkRead(name string) error {
+	return os.Rename(
+		filepath.Join(string(m), "new", name),
+		filepath.Join(string(m), "cur", name+":2,S"),
+	)
+}
+
+// Parse parses a message in the Internet Message Format. It fails with
+// ErrUndecodable when none of the texts of the message can be decoded.
+func Parse(r io.Reader) (Message, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return Message{}, err
+	}
+
+	var m Message
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return Message{}, fmt.Errorf("invalid sender: %w", err)
+	}
+	m.From = strings.ToLower(from.Address)
+	m.Verified = senderVerified(msg.Header, m.From)
+	m.Recipients = recipients(msg.Header)
+
+	decoder := mime.WordDecoder{CharsetReader: charsetReader}
+	if m.Subject, err = decoder.DecodeHeader(msg.Header.Get("Subject")); err != nil {
+		m.Subject = msg.Header.Get("Subject")
+	}
+	m.Subject = strings.TrimSpace(m.Subject)
+
+	var p parts
+	if err := p.walk(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), "", msg.Body); err != nil {
+		return Message{}, err
+	}
+	m.Text = p.plain
+	if m.Text == "" && p.html != "" {
+		m.Text = htmlText(p.html)
+	}
+	if m.Text == "" && p.rejected != nil {
+		return Message{}, p.rejected
+	}
+	m.Text = stripSignature(m.Text)
+	m.Attachments = p.attachments
+	return m, nil
+}
+
+// recipients returns the addresses a message was delivered to by the mail
+// server, then the ones in its To and Cc headers
+func recipients(header mail.Header) []string {
+	var addresses []string
+	for _, key := range []string{"Delivered-To", "X-Original-To"} {
+		for _, value := range header[key] {
+			if addr, err := mail.ParseAddress(value); err == nil {
+				addresses = append(addresses, strings.ToLower(addr.Address))
+			}
+		}
+	}
+	for _, key := range []string{"To", "Cc"} {
+		list, err := header.AddressList(key)
+		if err != nil {
+			continue
+		}
+		for _, addr := range list {
+			addresses = append(addresses, strings.ToLower(addr.Address))
+		}
+	}
+	return addresses
+}
+
+// senderVerified tells whether the mail server that received a message
+// authenticated the domain of its sender, i.e. whether its topmost
+// Authentication-Results header reports a DKIM signature or an SPF check
+// passing for that domain. The headers added further down the way may be
+// forged, like the From header itself.
+func senderVerified(header mail.Header, from string) bool {
+	results := header["Authentication-Results"]
+	_, domain, ok := strings.Cut(from, "@")
+	if len(results) == 0 || !ok {
+		return false
+	}
+
+	// The first result identifies the server, e.g. "mx.example.com; dkim=pass
+	// header.d=example.com; spf=fail smtp.mailfrom=example.org"
+	for _, result := range strings.Split(stripComments(results[0]), ";")[1:] {
+		fields := strings.Fields(strings.ToLower(result))
+		if len(fields) == 0 {
+			continue
+		}
+		var property string
+		switch fields[0] {
+		case "dkim=pass":
+			property = "header.d="
+		case "spf=pass":
+			property = "smtp.mailfrom="
+		default:
+			continue
+		}
+		for _, field := range fields[1:] {
+			value, ok := strings.CutPrefix(field, property)
+			if !ok {
+				continue
+			}
+			// SPF reports the address of the envelope sender
+			if _, d, ok := strings.Cut(value, "@"); ok {
+				value = d
+			}
+			// A parent domain of the sender's passes too, but not a top-level one
+			if domain == value || strings.Contains(value, ".") && strings.HasSuffix(domain, "."+value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stripComments removes the comments in parentheses from a header value
+func stripComments(value string) string {
+	var sb strings.Builder
+	depth := 0
+	for _, r := range value {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// parts collects the text and files of a message as its parts are walked
+type parts struct {
+	plain       string
+	html        string
+	attachments []Attachment
+	rejected    error // Why the first text part left out could not be decoded
+}
+
+// walk reads a part of a message, descending into multipart parts
+func (p *parts) walk(contentType, encoding, disposition string, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			err = p.walk(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"),
+				part.Header.Get("Content-Disposition"), part)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(decode(encoding, body))
+	if err != nil {
+		return err
+	}
+
+	dispositionType, dispositionParams, _ := mime.ParseMediaType(disposition)
+	filename := dispositionParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	isText := mediaType == "text/plain" || mediaType == "text/html"
+	if dispositionType == "attachment" || filename != "" || !isText {
+		if filename == "" {
+			filename = "attachment"
+		}
+		p.attachments = append(p.attachments, Attachment{Filename: filepath.Base(filename), Data: data})
+		return nil
+	}
+
+	// A text that cannot be decoded is left out rather than stored garbled.
+	// Another version of it may be in a following part.
+	text, err := toUTF8(params["charset"], data)
+	if err != nil {
+		if p.rejected == nil {
+			p.rejected = err
+		}
+		return nil
+	}
+
+	// Alternative versions of the text come in order of preference, the
+	// first one of each type is kept
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if mediaType == "text/plain" && p.plain == "" {
+		p.plain = strings.TrimSpace(text)
+	} else if mediaType == "text/html" && p.html == "" {
+		p.html = text
+	}
+	return nil
+}
+
+// decode decodes the content of a part according to its transfer encoding
+func decode(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
+
+// newlineStripper drops the line breaks of base64 content
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (s *newlineStripper) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	kept := 0
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' {
+			p[kept] = b
+			kept++
+		}
+	}
+	return kept, err
+}
+
+// htmlText returns the text of an HTML body, keeping its paragraphs
+func htmlText(body string) string {
+	for _, tag := range []string{"</p>", "<br>", "<br/>", "<br />", "</div>", "</li>"} {
+		body = strings.ReplaceAll(body, tag, tag+"\n")
+		body = strings.ReplaceAll(body, strings.ToUpper(tag), tag+"\n")
+	}
+	text := html.UnescapeString(bluemonday.StrictPolicy().Sanitize(body))
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// stripSignature removes the signature following the "-- " line, whose
+// trailing space may have been lost, e.g. by quoted-printable encoding
+func stripSignature(text string) string {
+	lines := strings.Split(text, "\n")
+	for i := len(lines) - 1; i > 0; i-- {
+		if strings.TrimRight(lines[i], " ") == "--" {
+			return strings.TrimSpace(strings.Join(lines[:i], "\n"))
+		}
+	}
+	return text
+}
@@ -0,0 +1,37 @@
+package inbox
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseVerified(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []string
+		want    bool
+	}{
+		{"no results", nil, false},
+		{"dkim pass", []string{"mx.example.net; dkim=pass (2048-bit key) header.d=example.com header.s=mail"}, true},
+		{"dkim pass for a parent domain", []string{"mx.example.net; dkim=pass header.d=com"}, false},
+		{"spf pass", []string{"mx.example.net; spf=pass smtp.mailfrom=bounces@example.com"}, true},
+		{"dkim pass for another domain", []string{"mx.example.net; dkim=pass header.d=example.org; spf=fail smtp.mailfrom=example.com"}, false},
+		{"pass in a comment", []string{"mx.example.net; dkim=fail (dkim=pass header.d=example.com) header.d=example.com"}, false},
+		{"pass below the topmost header", []string{"mx.example.net; dkim=none", "evil.example.org; dkim=pass header.d=example.com"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var header strings.Builder
+			for _, result := range tt.results {
+				header.WriteString("Authentication-Results: " + result + "\r\n")
+			}
+			msg, err := Parse(strings.NewReader(header.String() + "From: Me <me@example.com>\r\nSubject: Hi\r\n\r\nHello\r\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Verified != tt.want {
+				t.Errorf("Verified = %v, want %v", msg.Verified, tt.want)
+			}
+		})
+	}
+}
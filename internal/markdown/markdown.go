@@ -0,0 +1,151 @@
+// Package markdown renders the Markdown written in journal entries and plan
+// descriptions to sanitized HTML
+package markdown
+
+import (
+	"bytes"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// taskAttribute holds the index of a checkbox among the checkboxes of the document
+const taskAttribute = "task-index"
+
+var (
+	readOnly    = newMarkdown(false)
+	interactive = newMarkdown(true)
+	policy      = newPolicy()
+)
+
+// newMarkdown configures goldmark with GitHub flavoured tables,
+// strikethrough, autolinks and checklists. Line breaks are kept, as entries
+// used to be displayed as plain text.
+func newMarkdown(tickable bool) goldmark.Markdown {
+	return goldmark.New(
+		goldmark.WithExtensions(extension.Table, extension.Strikethrough, extension.Linkify),
+		goldmark.WithParserOptions(
+			parser.WithInlineParsers(util.Prioritized(extension.NewTaskCheckBoxParser(), 0)),
+		),
+		goldmark.WithRendererOptions(
+			html.WithHardWraps(),
+			renderer.WithNodeRenderers(util.Prioritized(&checkBoxRenderer{tickable: tickable}, 500)),
+		),
+	)
+}
+
+// newPolicy allows what users usually write in Markdown, and the checkboxes
+// of checklists
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	p.AllowAttrs("name").Matching(regexp.MustCompile(`^task$`)).OnElements("input")
+	p.AllowAttrs("value").Matching(regexp.MustCompile(`^[0-9]+$`)).OnElements("input")
+	return p
+}
+
+// Render converts Markdown to sanitized HTML. Checklist items are shown
+// with disabled checkboxes.
+func Render(source string) string {
+	return render(readOnly, source)
+}
+
+// RenderChecklist converts Markdown to sanitized HTML like Render, but its
+// checklist items can be ticked. Each checkbox is named "task" and holds the
+// index of the item, so that submitting them in a form gives the ticked
+// items to SetTasks.
+func RenderChecklist(source string) string {
+	return render(interactive, source)
+}
+
+func render(md goldmark.Markdown, source string) string {
+	src := []byte(source)
+	doc := md.Parser().Parse(text.NewReader(src))
+	for i, checkBox := range checkBoxes(doc) {
+		checkBox.SetAttributeString(taskAttribute, i)
+	}
+
+	var buf bytes.Buffer
+	if err := md.Renderer().Render(&buf, src, doc); err != nil {
+		slog.Error("Error rendering markdown", "err", err)
+		return policy.Sanitize(source)
+	}
+	return policy.Sanitize(buf.String())
+}
+
+// SetTasks returns the Markdown source with exactly the checklist items at
+// the given indexes ticked
+func SetTasks(source string, ticked []int) string {
+	src := []byte(source)
+	doc := readOnly.Parser().Parse(text.NewReader(src))
+	for i, checkBox := range checkBoxes(doc) {
+		// The line of the item starts with its checkbox, e.g. "[x] item"
+		lines := checkBox.Parent().Lines()
+		if lines.Len() == 0 {
+			continue
+		}
+		mark := lines.At(0).Start + 1
+		if slices.Contains(ticked, i) {
+			src[mark] = 'x'
+		} else {
+			src[mark] = ' '
+		}
+	}
+	return string(src)
+}
+
+// checkBoxes returns the checkboxes of the checklist items of a document, in order
+func checkBoxes(doc ast.Node) []*extast.TaskCheckBox {
+	var found []*extast.TaskCheckBox
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if checkBox, ok := n.(*extast.TaskCheckBox); ok && entering {
+			found = append(found, checkBox)
+		}
+		return ast.WalkContinue, nil
+	})
+	return found
+}
+
+// checkBoxRenderer renders the checkboxes of checklist items, numbered in
+// document order when they can be ticked
+type checkBoxRenderer struct {
+	tickable bool
+}
+
+func (r *checkBoxRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(extast.KindTaskCheckBox, r.renderCheckBox)
+}
+
+func (r *checkBoxRenderer) renderCheckBox(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	_, _ = w.WriteString(`<input type="checkbox"`)
+	if node.(*extast.TaskCheckBox).IsChecked {
+		_, _ = w.WriteString(` checked`)
+	}
+	if r.tickable {
+		index, _ := node.AttributeString(taskAttribute)
+		if i, ok := index.(int); ok {
+			_, _ = w.WriteString(` name="task" value="` + strconv.Itoa(i) + `"`)
+		}
+	} else {
+		_, _ = w.WriteString(` disabled`)
+	}
+	_, _ = w.WriteString("> ")
+	return ast.WalkContinue, nil
+}
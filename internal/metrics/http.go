@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	httpRequests = NewCounter("pds_http_requests_total",
+		"Number of HTTP requests served, by route, method and status.", "route", "method", "status")
+	httpRequestDuration = NewHistogram("pds_http_request_duration_seconds",
+		"Time taken to serve HTTP requests, by route and method.", DefaultBuckets, "route", "method")
+)
+
+// Middleware counts and times the requests served by a ServeMux. Requests
+// are labelled with the pattern of the route that served them, rather than
+// their path, so that IDs in paths do not make new series.
+func Middleware(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		// The mux records the pattern it matched in the request it is given
+		req := r.WithContext(r.Context())
+		mux.ServeHTTP(rec, req)
+
+		route := req.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		method := methodLabel(r.Method)
+		httpRequests.Inc(route, method, strconv.Itoa(rec.status))
+		httpRequestDuration.ObserveDuration(start, route, method)
+	})
+}
+
+// methodLabel returns the label of a request method, which clients may make
+// up
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "other"
+}
+
+// statusRecorder records the status of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets streamed responses, e.g. server-sent events, through
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the original writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"pds/internal/database"
+	"pds/internal/events"
 )
 
 // Aim represents a value in the system
@@ -15,22 +16,11 @@ type Aim struct {
 	ParentIDs   []int64
 }
 
-// GetChildren retrieves all child values for a given value ID.
-func GetChildren(valueID int64) ([]Aim, error) {
-	db := database.DB
-	rows, err := db.Query(
-		`SELECT v.id, v.name, v.description
-		 FROM aims v
-		 JOIN value_parents vp ON v.id = vp.value_id
-		 WHERE vp.parent_value_id = ?`,
-		valueID,
-	)
-	if err != nil {
-		return nil, err
-	}
+// scanAims reads the id, name and description of the selected aims and closes rows
+func scanAims(rows *sql.Rows) ([]Aim, error) {
 	defer rows.Close()
 
-	var children []Aim
+	var aims []Aim
 	for rows.Next() {
 		var v Aim
 		var description sql.NullString
@@ -38,74 +28,66 @@ func GetChildren(valueID int64) ([]Aim, error) {
 			return nil, err
 		}
 		v.Description = description.String
-		children = append(children, v)
+		aims = append(aims, v)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return children, nil
+	return aims, nil
 }
 
-// GetParents retrieves all parent values for a given Aim ID.
-func GetParents(valueID int64) ([]Aim, error) {
+// GetValue retrieves an aim by ID
+func GetValue(valueID int64) (Aim, error) {
+	var v Aim
+	var description sql.NullString
+	err := database.DB.QueryRow("SELECT id, name, description FROM aims WHERE id = ? AND deleted_at IS NULL", valueID).
+		Scan(&v.ID, &v.Name, &description)
+	v.Description = description.String
+	return v, err
+}
+
+// GetChildren retrieves all child values for a given value ID.
+func GetChildren(valueID int64) ([]Aim, error) {
 	db := database.DB
 	rows, err := db.Query(
 		`SELECT v.id, v.name, v.description
 		 FROM aims v
-		 JOIN value_parents vp ON v.id = vp.parent_value_id
-		 WHERE vp.value_id = ?`,
+		 JOIN value_parents vp ON v.id = vp.value_id
+		 WHERE vp.parent_value_id = ? AND v.deleted_at IS NULL`,
 		valueID,
 	)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var parents []Aim
-	for rows.Next() {
-		var v Aim
-		var description sql.NullString
-		if err := rows.Scan(&v.ID, &v.Name, &description); err != nil {
-			return nil, err
-		}
-		v.Description = description.String
-		parents = append(parents, v)
-	}
+	return scanAims(rows)
+}
 
-	if err = rows.Err(); err != nil {
+// GetParents retrieves all parent values for a given Aim ID.
+func GetParents(valueID int64) ([]Aim, error) {
+	db := database.DB
+	rows, err := db.Query(
+		`SELECT v.id, v.name, v.description
+		 FROM aims v
+		 JOIN value_parents vp ON v.id = vp.parent_value_id
+		 WHERE vp.value_id = ? AND v.deleted_at IS NULL`,
+		valueID,
+	)
+	if err != nil {
 		return nil, err
 	}
-
-	return parents, nil
+	return scanAims(rows)
 }
 
 // GetAllValues retrieves all Aim from the database.
 func GetAllValues() ([]Aim, error) {
 	db := database.DB
-	rows, err := db.Query("SELECT id, name, description FROM aims")
+	rows, err := db.Query("SELECT id, name, description FROM aims WHERE deleted_at IS NULL")
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var values []Aim
-	for rows.Next() {
-		var v Aim
-		var description sql.NullString
-		if err := rows.Scan(&v.ID, &v.Name, &description); err != nil {
-			return nil, err
-		}
-		v.Description = description.String
-		values = append(values, v)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return values, nil
+	return scanAims(rows)
 }
 
 // CreateValue inserts a new value into the database.
@@ -134,33 +116,37 @@ func CreateValue(name string, description string, parentIDs []string) (int64, er
 		}
 	}
 
+	events.Publish(events.AimCreated, map[string]any{"id": valueID, "name": name, "parent_ids": parentIDs})
 	return valueID, nil
 }
 
-// DeleteValue removes a value and its relationships from the database.
+// DeleteValue moves a value to the trash. Its relationships are kept until
+// it is purged, so that they come back if it is restored.
 func DeleteValue(valueID int64) error {
-	db := database.DB
-
-	// Delete relationships first
-	_, err := db.Exec("DELETE FROM value_parents WHERE value_id = ? OR parent_value_id = ?", valueID, valueID)
-	if err != nil {
-		return fmt.Errorf("failed to delete value relationships: %w", err)
+	if err := trashRow("aims", valueID); err != nil {
+		return fmt.Errorf("failed to delete value %d: %w", valueID, err)
 	}
+	events.Publish(events.AimDeleted, map[string]any{"id": valueID})
+	return nil
+}
 
-	// Delete the value itself
-	result, err := db.Exec("DELETE FROM aims WHERE id = ?", valueID)
-	if err != nil {
-		return fmt.Errorf("failed to delete value: %w", err)
+// RestoreValue moves a value out of the trash
+func RestoreValue(valueID int64) error {
+	if err := restoreRow("aims", valueID); err != nil {
+		return fmt.Errorf("failed to restore value %d: %w", valueID, err)
 	}
+	events.Publish(events.AimRestored, map[string]any{"id": valueID})
+	return nil
+}
 
-	rowsAffected, err := result.RowsAffected()
+// PurgeValue permanently removes a value in the trash and its relationships
+// from the database
+func PurgeValue(valueID int64) error {
+	err := purgeRow("aims", valueID, "value_parents.value_id", "value_parents.parent_value_id", "aim_health_history.aim_id",
+		"statement_aims.aim_id", "plan_aims.aim_id", "journal_aims.aim_id", "plan_template_aims.aim_id")
 	if err != nil {
-		return fmt.Errorf("failed to retrieve rows affected: %w", err)
-	}
-
-	if rowsAffected == 0 {
-		return fmt.Errorf("no value found with ID %d", valueID)
+		return fmt.Errorf("failed to purge value %d: %w", valueID, err)
 	}
-
+	events.Publish(events.AimPurged, map[string]any{"id": valueID})
 	return nil
 }
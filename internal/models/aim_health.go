@@ -0,0 +1,704 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pds/internal/database"
+)
+
+// Factors of the health score of an aim
+const (
+	HealthPlans      = "plans"      // Progress of the plans serving the aim
+	HealthHabits     = "habits"     // Completion of the habits serving the aim
+	HealthBehaviours = "behaviours" // Occurrences of the behaviours conflicting with the aim
+	HealthJournals   = "journals"   // Journal entries linked to the aim
+)
+
+// HealthFactors lists the factors of the health score in the order they are shown
+var HealthFactors = []string{HealthPlans, HealthHabits, HealthBehaviours, HealthJournals}
+
+// Periods and scales of the health score
+const (
+	HealthWindowDays        = 30 // Days of activity a score is computed from
+	MaxHealthWeight         = 10 // Highest weight of a factor
+	healthTrendDays         = 7  // Least days between the scores a trend compares
+	healthTrendPoints       = 2  // Points a score must move by to trend up or down
+	healthOccurrencePenalty = 10 // Points lost per occurrence of a conflicting behaviour
+	healthJournalTarget     = 4  // Linked journal entries giving a full score
+)
+
+// HealthWeights are the relative weights of the factors of the health score
+type HealthWeights struct {
+	Plans      int
+	Habits     int
+	Behaviours int
+	Journals   int
+}
+
+// DefaultHealthWeights are used until the weights are configured
+var DefaultHealthWeights = HealthWeights{Plans: 4, Habits: 3, Behaviours: 2, Journals: 1}
+
+// weights maps the factors to the fields of the weights
+func (w *HealthWeights) weights() map[string]*int {
+	return map[string]*int{
+		HealthPlans:      &w.Plans,
+		HealthHabits:     &w.Habits,
+		HealthBehaviours: &w.Behaviours,
+		HealthJournals:   &w.Journals,
+	}
+}
+
+// Weight returns the weight of a factor
+func (w HealthWeights) Weight(factor string) int {
+	if weight, ok := w.weights()[factor]; ok {
+		return *weight
+	}
+	return 0
+}
+
+// Validate checks that the weights are in range and that a factor counts
+func (w HealthWeights) Validate() error {
+	total := 0
+	for _, factor := range HealthFactors {
+		weight := w.Weight(factor)
+		if weight < 0 || weight > MaxHealthWeight {
+			return fmt.Errorf("the weight of %s must be between 0 and %d", factor, MaxHealthWeight)
+		}
+		total += weight
+	}
+	if total == 0 {
+		return errors.New("at least one factor needs a weight")
+	}
+	return nil
+}
+
+// healthWeightKey is the setting holding the weight of a factor
+func healthWeightKey(factor string) string {
+	return "health_weight_" + factor
+}
+
+// GetHealthWeights retrieves the weights of the factors of the health score.
+// Factors whose weight was never configured keep their default weight.
+func GetHealthWeights() (HealthWeights, error) {
+	values := make(map[string]*string)
+	for _, factor := range HealthFactors {
+		values[healthWeightKey(factor)] = new(string)
+	}
+	if err := getSettings(values); err != nil {
+		return DefaultHealthWeights, err
+	}
+
+	weights := DefaultHealthWeights
+	for factor, weight := range weights.weights() {
+		value := *values[healthWeightKey(factor)]
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return DefaultHealthWeights, fmt.Errorf("invalid weight of %s %q: %w", factor, value, err)
+		}
+		*weight = n
+	}
+	if err := weights.Validate(); err != nil {
+		return DefaultHealthWeights, fmt.Errorf("invalid health weights: %w", err)
+	}
+	return weights, nil
+}
+
+// SaveHealthWeights stores the weights of the factors of the health score
+func SaveHealthWeights(weights HealthWeights) error {
+	if err := weights.Validate(); err != nil {
+		return err
+	}
+	values := make(map[string]*string)
+	for factor, weight := range weights.weights() {
+		value := strconv.Itoa(*weight)
+		values[healthWeightKey(factor)] = &value
+	}
+	return saveSettings(values)
+}
+
+// HealthFactorLabel returns the name of a factor of the health score as shown
+// to the user
+func HealthFactorLabel(factor string) string {
+	switch factor {
+	case HealthPlans:
+		return "Plans"
+	case HealthHabits:
+		return "Habits"
+	case HealthBehaviours:
+		return "Behaviours"
+	case HealthJournals:
+		return "Journal entries"
+	}
+	return factor
+}
+
+// HealthFactor is the part a factor takes in the health score of an aim
+type HealthFactor struct {
+	Name        string  // HealthPlans, HealthHabits, HealthBehaviours or HealthJournals
+	Score       float64 // Between 0 and 100
+	Weight      int
+	Detail      string  // What the score was computed from, e.g. "2 plans, 65% done"
+	Previous    float64 // Score healthTrendDays ago
+	HasPrevious bool
+}
+
+// AimHealth is the health score of an aim, computed from the activity around
+// the aim and its descendants in the values hierarchy over the last
+// HealthWindowDays
+type AimHealth struct {
+	AimID       int64
+	AimName     string
+	ChildIDs    []int64        // Children of the aim in the values hierarchy
+	Score       float64        // Between 0 and 100, the weighted average of the factors
+	Rated       bool           // Whether a weighted factor applies to the aim
+	Factors     []HealthFactor // The factors applying to the aim
+	Previous    float64        // Score healthTrendDays ago
+	HasPrevious bool
+}
+
+// Trend tells whether the score went "up" or "down" over the last
+// healthTrendDays, or stayed "steady". It is empty when there is no score
+// to compare with.
+func (h AimHealth) Trend() string {
+	if !h.Rated || !h.HasPrevious {
+		return ""
+	}
+	switch delta := h.Score - h.Previous; {
+	case delta >= healthTrendPoints:
+		return "up"
+	case delta <= -healthTrendPoints:
+		return "down"
+	}
+	return "steady"
+}
+
+// Explanation describes what drove the score: the factor that moved it the
+// most when it trends, and the factor holding it back the most
+func (h AimHealth) Explanation() string {
+	if !h.Rated {
+		return "Not scored yet: nothing weighted is linked to this aim"
+	}
+
+	var parts []string
+	if trend := h.Trend(); trend == "up" || trend == "down" {
+		part := fmt.Sprintf("%s %.0f points since last week", trend, math.Abs(h.Score-h.Previous))
+		if driver, ok := h.driver(trend); ok {
+			part += fmt.Sprintf(", mostly from %s (%.0f → %.0f)",
+				strings.ToLower(HealthFactorLabel(driver.Name)), driver.Previous, driver.Score)
+		}
+		parts = append(parts, part)
+	}
+	if weakest, ok := h.weakest(); ok {
+		parts = append(parts, fmt.Sprintf("held back by %s: %s", strings.ToLower(HealthFactorLabel(weakest.Name)), weakest.Detail))
+	}
+	if len(parts) == 0 {
+		return "Every factor is at its best"
+	}
+	explanation := strings.Join(parts, "; ")
+	return strings.ToUpper(explanation[:1]) + explanation[1:]
+}
+
+// driver returns the weighted factor that moved the score the most in the
+// direction of its trend
+func (h AimHealth) driver(trend string) (HealthFactor, bool) {
+	sign := 1.0
+	if trend == "down" {
+		sign = -1
+	}
+	var driver HealthFactor
+	var best float64
+	for _, f := range h.Factors {
+		if !f.HasPrevious {
+			continue
+		}
+		if moved := sign * (f.Score - f.Previous) * float64(f.Weight); moved > best {
+			driver, best = f, moved
+		}
+	}
+	return driver, best > 0
+}
+
+// weakest returns the weighted factor costing the score the most points
+func (h AimHealth) weakest() (HealthFactor, bool) {
+	var weakest HealthFactor
+	var worst float64
+	for _, f := range h.Factors {
+		if cost := (100 - f.Score) * float64(f.Weight); cost > worst {
+			weakest, worst = f, cost
+		}
+	}
+	return weakest, worst > 0
+}
+
+// SortAimHealthByScore sorts aims from the lowest to the highest score, the
+// aims that are not rated last
+func SortAimHealthByScore(healths []AimHealth) {
+	sort.SliceStable(healths, func(i, j int) bool {
+		if healths[i].Rated != healths[j].Rated {
+			return healths[i].Rated
+		}
+		return healths[i].Score < healths[j].Score
+	})
+}
+
+// AimHealthNode is an aim in the values hierarchy with its health and its
+// children. An aim with several parents appears under each of them.
+type AimHealthNode struct {
+	AimHealth
+	Children []AimHealthNode
+}
+
+// AimHealthTree arranges the health of aims as the values hierarchy, from
+// the aims without parents. The aims of a cycle no root leads to are shown
+// from the first of them.
+func AimHealthTree(healths []AimHealth) []AimHealthNode {
+	byID := make(map[int64]AimHealth, len(healths))
+	isChild := make(map[int64]bool)
+	for _, h := range healths {
+		byID[h.AimID] = h
+		for _, id := range h.ChildIDs {
+			isChild[id] = true
+		}
+	}
+
+	// path guards against cycles in the hierarchy
+	path := make(map[int64]bool)
+	visited := make(map[int64]bool)
+	var build func(h AimHealth) AimHealthNode
+	build = func(h AimHealth) AimHealthNode {
+		node := AimHealthNode{AimHealth: h}
+		path[h.AimID], visited[h.AimID] = true, true
+		for _, id := range h.ChildIDs {
+			if child, ok := byID[id]; ok && !path[id] {
+				node.Children = append(node.Children, build(child))
+			}
+		}
+		delete(path, h.AimID)
+		return node
+	}
+
+	var roots []AimHealthNode
+	for _, h := range healths {
+		if !isChild[h.AimID] {
+			roots = append(roots, build(h))
+		}
+	}
+	for _, h := range healths {
+		if !visited[h.AimID] {
+			roots = append(roots, build(h))
+		}
+	}
+	return roots
+}
+
+// GetAimHealth computes the health score of every aim at now, with the
+// scores recorded healthTrendDays before for their trend
+func GetAimHealth(now time.Time) ([]AimHealth, error) {
+	healths, err := computeAimHealth(now)
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := getAimHealthSnapshots(localDay(now).AddDate(0, 0, -healthTrendDays))
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range healths {
+		h := &healths[i]
+		snapshot, ok := snapshots[h.AimID]
+		if !ok {
+			continue
+		}
+		h.Previous, h.HasPrevious = snapshot.score, true
+		for j := range h.Factors {
+			if score := snapshot.factors[h.Factors[j].Name]; score.Valid {
+				h.Factors[j].Previous, h.Factors[j].HasPrevious = score.Float64, true
+			}
+		}
+	}
+	return healths, nil
+}
+
+// GetHealthOfAim computes the health score of an aim at now. It fails with
+// sql.ErrNoRows if the aim does not exist.
+func GetHealthOfAim(aimID int64, now time.Time) (AimHealth, error) {
+	healths, err := GetAimHealth(now)
+	if err != nil {
+		return AimHealth{}, err
+	}
+	for _, h := range healths {
+		if h.AimID == aimID {
+			return h, nil
+		}
+	}
+	return AimHealth{}, sql.ErrNoRows
+}
+
+// RecordAimHealth stores the health scores of the rated aims for the day of
+// now, replacing the ones recorded earlier that day
+func RecordAimHealth(now time.Time) error {
+	healths, err := computeAimHealth(now)
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	day := sqlDate(localDay(now))
+	for _, h := range healths {
+		if !h.Rated {
+			continue
+		}
+		scores := make(map[string]sql.NullFloat64)
+		for _, f := range h.Factors {
+			scores[f.Name] = sql.NullFloat64{Float64: f.Score, Valid: true}
+		}
+		_, err := tx.Exec(`
+			INSERT INTO aim_health_history (aim_id, day, score, plans, habits, behaviours, journals)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (aim_id, day) DO UPDATE SET
+				score = excluded.score, plans = excluded.plans, habits = excluded.habits,
+				behaviours = excluded.behaviours, journals = excluded.journals`,
+			h.AimID, day, h.Score,
+			scores[HealthPlans], scores[HealthHabits], scores[HealthBehaviours], scores[HealthJournals],
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record health of aim %d: %w", h.AimID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// healthSnapshot is a health score recorded in the past
+type healthSnapshot struct {
+	score   float64
+	factors map[string]sql.NullFloat64
+}
+
+// getAimHealthSnapshots retrieves the latest health score of every aim
+// recorded on or before a day
+func getAimHealthSnapshots(day time.Time) (map[int64]healthSnapshot, error) {
+	query := `
+		SELECT h.aim_id, h.score, h.plans, h.habits, h.behaviours, h.journals
+		FROM aim_health_history h
+		WHERE h.day = (SELECT MAX(day) FROM aim_health_history WHERE aim_id = h.aim_id AND day <= ?)
+	`
+	rows, err := database.DB.Query(query, sqlDate(day))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := make(map[int64]healthSnapshot)
+	for rows.Next() {
+		var aimID int64
+		var plans, habits, behaviours, journals sql.NullFloat64
+		snapshot := healthSnapshot{}
+		if err := rows.Scan(&aimID, &snapshot.score, &plans, &habits, &behaviours, &journals); err != nil {
+			return nil, err
+		}
+		snapshot.factors = map[string]sql.NullFloat64{
+			HealthPlans:      plans,
+			HealthHabits:     habits,
+			HealthBehaviours: behaviours,
+			HealthJournals:   journals,
+		}
+		snapshots[aimID] = snapshot
+	}
+	return snapshots, rows.Err()
+}
+
+// computeAimHealth computes the health score of every aim at now
+func computeAimHealth(now time.Time) ([]AimHealth, error) {
+	weights, err := GetHealthWeights()
+	if err != nil {
+		return nil, err
+	}
+	aims, err := GetAllValues()
+	if err != nil {
+		return nil, err
+	}
+	children, err := getValueChildren()
+	if err != nil {
+		return nil, err
+	}
+	activity, err := getAimActivity(now)
+	if err != nil {
+		return nil, err
+	}
+
+	healths := make([]AimHealth, len(aims))
+	for i, aim := range aims {
+		h := AimHealth{AimID: aim.ID, AimName: aim.Name, ChildIDs: children[aim.ID]}
+		h.Factors = activity.factors(subtree(aim.ID, children), weights)
+		var total, weighted float64
+		for _, f := range h.Factors {
+			total += float64(f.Weight)
+			weighted += float64(f.Weight) * f.Score
+		}
+		if total > 0 {
+			h.Score, h.Rated = weighted/total, true
+		}
+		healths[i] = h
+	}
+	return healths, nil
+}
+
+// getValueChildren retrieves the children of every aim in the values
+// hierarchy, leaving out the aims in the trash
+func getValueChildren() (map[int64][]int64, error) {
+	rows, err := database.DB.Query(`
+		SELECT vp.parent_value_id, vp.value_id
+		FROM value_parents vp
+		JOIN aims parent ON vp.parent_value_id = parent.id AND parent.deleted_at IS NULL
+		JOIN aims child ON vp.value_id = child.id AND child.deleted_at IS NULL
+		ORDER BY vp.value_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	children := make(map[int64][]int64)
+	for rows.Next() {
+		var parentID, childID int64
+		if err := rows.Scan(&parentID, &childID); err != nil {
+			return nil, err
+		}
+		children[parentID] = append(children[parentID], childID)
+	}
+	return children, rows.Err()
+}
+
+// subtree returns an aim followed by its descendants in the values
+// hierarchy, each of them once
+func subtree(aimID int64, children map[int64][]int64) []int64 {
+	ids := []int64{aimID}
+	seen := map[int64]bool{aimID: true}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range children[ids[i]] {
+			if !seen[child] {
+				seen[child] = true
+				ids = append(ids, child)
+			}
+		}
+	}
+	return ids
+}
+
+// planShare is the progress of a plan serving an aim, with the share of the
+// plan going to the aim
+type planShare struct {
+	planID   int64
+	progress float64
+	share    float64
+}
+
+// aimActivity is the activity over the window of the health score, by aim
+type aimActivity struct {
+	plans       map[int64][]planShare // Active and recently completed plans
+	habitRates  map[int64][]float64   // Completion rates of the habits
+	occurrences map[int64][]int       // Occurrences of each conflicting behaviour
+	journals    map[int64][]int64     // IDs of the linked journal entries
+}
+
+// getAimActivity retrieves the activity of every aim over the
+// HealthWindowDays before now
+func getAimActivity(now time.Time) (aimActivity, error) {
+	since := now.AddDate(0, 0, -HealthWindowDays)
+	var activity aimActivity
+	var err error
+	if activity.plans, err = getPlanSharesSince(since); err != nil {
+		return activity, err
+	}
+	if activity.occurrences, err = getConflictingOccurrencesSince(since); err != nil {
+		return activity, err
+	}
+	if activity.journals, err = getJournalAimsSince(since); err != nil {
+		return activity, err
+	}
+
+	habits, err := GetAllHabits()
+	if err != nil {
+		return activity, err
+	}
+	activity.habitRates = make(map[int64][]float64)
+	for _, habit := range habits {
+		if rate, ok := habit.CompletionRate(now, HealthWindowDays); ok {
+			activity.habitRates[habit.AimID] = append(activity.habitRates[habit.AimID], rate)
+		}
+	}
+	return activity, nil
+}
+
+// getPlanSharesSince retrieves the active plans and the plans completed
+// since the given date, by aim served
+func getPlanSharesSince(since time.Time) (map[int64][]planShare, error) {
+	rows, err := database.DB.Query(`
+		SELECT pa.aim_id, p.id, p.progress,
+			pa.weight / (SELECT SUM(weight) FROM plan_aims WHERE plan_id = p.id)
+		FROM plan_aims pa
+		JOIN plans p ON pa.plan_id = p.id
+		WHERE p.deleted_at IS NULL AND p.started_at IS NOT NULL
+		AND (p.completed_at IS NULL OR p.completed_at >= ?)
+	`, sqlTime(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := make(map[int64][]planShare)
+	for rows.Next() {
+		var aimID int64
+		var plan planShare
+		if err := rows.Scan(&aimID, &plan.planID, &plan.progress, &plan.share); err != nil {
+			return nil, err
+		}
+		plans[aimID] = append(plans[aimID], plan)
+	}
+	return plans, rows.Err()
+}
+
+// getConflictingOccurrencesSince counts the occurrences of every behaviour
+// since the given date, by aim the behaviour conflicts with
+func getConflictingOccurrencesSince(since time.Time) (map[int64][]int, error) {
+	rows, err := database.DB.Query(`
+		SELECT b.conflicting_aim_id,
+			(SELECT COUNT(*) FROM behaviour_occurrences o WHERE o.behaviour_id = b.id AND o.occurred_at >= ?)
+		FROM behaviours b
+		WHERE b.conflicting_aim_id IS NOT NULL AND b.deleted_at IS NULL
+	`, sqlTime(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	occurrences := make(map[int64][]int)
+	for rows.Next() {
+		var aimID int64
+		var n int
+		if err := rows.Scan(&aimID, &n); err != nil {
+			return nil, err
+		}
+		occurrences[aimID] = append(occurrences[aimID], n)
+	}
+	return occurrences, rows.Err()
+}
+
+// getJournalAimsSince retrieves the IDs of the journal entries written since
+// the given date, by aim they are linked to
+func getJournalAimsSince(since time.Time) (map[int64][]int64, error) {
+	rows, err := database.DB.Query(`
+		SELECT ja.aim_id, ja.journal_id
+		FROM journal_aims ja
+		JOIN journals j ON ja.journal_id = j.id
+		WHERE j.deleted_at IS NULL AND j.created_at >= ?
+	`, sqlTime(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	journals := make(map[int64][]int64)
+	for rows.Next() {
+		var aimID, journalID int64
+		if err := rows.Scan(&aimID, &journalID); err != nil {
+			return nil, err
+		}
+		journals[aimID] = append(journals[aimID], journalID)
+	}
+	return journals, rows.Err()
+}
+
+// factors computes the factors of the health score of a subtree of aims.
+// Each factor only applies when something of its kind is linked to the
+// aims, except the journal entries, which also apply alongside another
+// factor. Aims without any activity have no factors.
+func (a aimActivity) factors(aimIDs []int64, weights HealthWeights) []HealthFactor {
+	plans := make(map[int64]bool)
+	journals := make(map[int64]bool)
+	var shares, progress float64
+	var rates []float64
+	var behaviours, occurrences int
+	for _, id := range aimIDs {
+		for _, plan := range a.plans[id] {
+			plans[plan.planID] = true
+			shares += plan.share
+			progress += plan.share * plan.progress
+		}
+		rates = append(rates, a.habitRates[id]...)
+		for _, n := range a.occurrences[id] {
+			behaviours++
+			occurrences += n
+		}
+		for _, journalID := range a.journals[id] {
+			journals[journalID] = true
+		}
+	}
+
+	var factors []HealthFactor
+	if len(plans) > 0 {
+		var score float64
+		if shares > 0 {
+			score = progress / shares
+		}
+		factors = append(factors, HealthFactor{
+			Name:   HealthPlans,
+			Score:  score,
+			Detail: fmt.Sprintf("%s, %.0f%% done", pluralize(len(plans), "plan", "plans"), score),
+		})
+	}
+	if len(rates) > 0 {
+		var total float64
+		for _, rate := range rates {
+			total += rate
+		}
+		score := 100 * total / float64(len(rates))
+		factors = append(factors, HealthFactor{
+			Name:   HealthHabits,
+			Score:  score,
+			Detail: fmt.Sprintf("%s, %.0f%% kept", pluralize(len(rates), "habit", "habits"), score),
+		})
+	}
+	if behaviours > 0 {
+		factors = append(factors, HealthFactor{
+			Name:   HealthBehaviours,
+			Score:  math.Max(0, 100-healthOccurrencePenalty*float64(occurrences)),
+			Detail: pluralize(occurrences, "occurrence", "occurrences") + " of conflicting behaviours",
+		})
+	}
+	if len(journals) > 0 || len(factors) > 0 {
+		factors = append(factors, HealthFactor{
+			Name:   HealthJournals,
+			Score:  100 * math.Min(1, float64(len(journals))/healthJournalTarget),
+			Detail: pluralize(len(journals), "journal entry", "journal entries"),
+		})
+	}
+
+	for i := range factors {
+		factors[i].Weight = weights.Weight(factors[i].Name)
+	}
+	return factors
+}
+
+// pluralize formats a count with the singular or plural form of a noun
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return "1 " + singular
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
@@ -0,0 +1,27 @@
+package models
+
+import "testing"
+
+func TestAimHealthFactorsWithoutActivity(t *testing.T) {
+	activity := aimActivity{journals: map[int64][]int64{2: {10}}}
+
+	if factors := activity.factors([]int64{1}, HealthWeights{}); len(factors) != 0 {
+		t.Errorf("an aim without activity has factors %+v", factors)
+	}
+	if factors := activity.factors([]int64{2}, HealthWeights{}); len(factors) != 1 || factors[0].Name != HealthJournals {
+		t.Errorf("an aim with a journal entry has factors %+v, want the journal entries", factors)
+	}
+}
+
+func TestAimHealthTreeCycle(t *testing.T) {
+	// 1 and 2 are each other's parent, so neither is a root
+	healths := []AimHealth{{AimID: 1, ChildIDs: []int64{2}}, {AimID: 2, ChildIDs: []int64{1}}, {AimID: 3}}
+
+	roots := AimHealthTree(healths)
+	if len(roots) != 2 || roots[0].AimID != 3 || roots[1].AimID != 1 {
+		t.Fatalf("got roots %+v, want 3 then 1", roots)
+	}
+	if children := roots[1].Children; len(children) != 1 || children[0].AimID != 2 || len(children[0].Children) != 0 {
+		t.Errorf("got children %+v under 1, want 2 alone", children)
+	}
+}
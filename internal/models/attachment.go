@@ -0,0 +1,142 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"pds/internal/database"
+	"pds/internal/events"
+)
+
+// Attachment is a file attached to a journal entry
+type Attachment struct {
+	ID        int64
+	JournalID int64
+	Hash      string
+	Filename  string
+	MimeType  string
+	Size      int64
+	CreatedAt time.Time
+}
+
+// IsImage reports whether the attachment can be displayed inline
+func (a Attachment) IsImage() bool {
+	return strings.HasPrefix(a.MimeType, "image/")
+}
+
+const attachmentColumns = "id, journal_id, hash, filename, mime_type, size, created_at"
+
+// NewAttachment is a file stored in the attachments directory, to be
+// attached to a journal entry
+type NewAttachment struct {
+	Hash     string
+	Filename string
+	MimeType string
+	Size     int64
+}
+
+// AttachFiles records stored files as attached to a journal entry, including
+// the entries in the trash, in one transaction
+func AttachFiles(journalID int64, files []NewAttachment) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids, err := insertAttachments(tx, journalID, files)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	publishAttachmentsCreated(journalID, files, ids)
+	return nil
+}
+
+// insertAttachments records stored files as attached to a journal entry
+// within a transaction, and returns the IDs of the attachments
+func insertAttachments(tx *sql.Tx, journalID int64, files []NewAttachment) ([]int64, error) {
+	ids := make([]int64, len(files))
+	for i, file := range files {
+		result, err := tx.Exec(
+			"INSERT INTO attachments (journal_id, hash, filename, mime_type, size) VALUES (?, ?, ?, ?, ?)",
+			journalID, file.Hash, file.Filename, file.MimeType, file.Size,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if ids[i], err = result.LastInsertId(); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// publishAttachmentsCreated publishes the attachments of a journal entry once
+// they are committed
+func publishAttachmentsCreated(journalID int64, files []NewAttachment, ids []int64) {
+	for i, file := range files {
+		events.Publish(events.AttachmentCreated, map[string]any{
+			"id": ids[i], "journal_id": journalID, "filename": file.Filename, "mime_type": file.MimeType, "size": file.Size,
+		})
+	}
+}
+
+// GetAttachment retrieves an attachment of a journal entry not in the trash
+// by ID
+func GetAttachment(id int64) (Attachment, error) {
+	var a Attachment
+	query := "SELECT " + attachmentColumns + " FROM attachments WHERE id = ?" +
+		" AND journal_id IN (SELECT id FROM journals WHERE deleted_at IS NULL)"
+	err := database.DB.QueryRow(query, id).
+		Scan(&a.ID, &a.JournalID, &a.Hash, &a.Filename, &a.MimeType, &a.Size, &a.CreatedAt)
+	return a, err
+}
+
+// GetJournalAttachments retrieves the attachments of a journal entry
+func GetJournalAttachments(journalID int64) ([]Attachment, error) {
+	rows, err := database.DB.Query("SELECT "+attachmentColumns+" FROM attachments WHERE journal_id = ? ORDER BY id", journalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []Attachment
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.JournalID, &a.Hash, &a.Filename, &a.MimeType, &a.Size, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// GetAttachmentHashes retrieves the hashes of all the stored files still
+// attached to a journal entry, including the entries in the trash
+func GetAttachmentHashes() (map[string]bool, error) {
+	rows, err := database.DB.Query("SELECT DISTINCT hash FROM attachments")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := map[string]bool{}
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes[hash] = true
+	}
+
+	return hashes, rows.Err()
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"pds/internal/database"
+)
+
+// AuditActor is the actor of the changes recorded in the audit log. The app
+// has a single user, who is not authenticated, so every change is theirs.
+const AuditActor = "owner"
+
+// AuditEntry records a change made to an entity
+type AuditEntry struct {
+	ID         int64
+	OccurredAt time.Time
+	Actor      string
+	Action     string // e.g. created, updated, deleted or completed
+	EntityType string // e.g. journal or plan
+	EntityID   int64  // Zero when the change is not about a single entity
+	EventType  string
+	EventID    string
+}
+
+// AppendAuditEntry appends the change described by a domain event, e.g.
+// "plan.completed", to the audit log
+func AppendAuditEntry(eventID, eventType string, entityID int64, occurredAt time.Time) error {
+	entityType, action, _ := strings.Cut(eventType, ".")
+	var id sql.NullInt64
+	if entityID != 0 {
+		id = sql.NullInt64{Int64: entityID, Valid: true}
+	}
+	_, err := database.DB.Exec(
+		`INSERT INTO audit_log (occurred_at, actor, action, entity_type, entity_id, event_type, event_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		sqlTime(occurredAt), AuditActor, action, entityType, id, eventType, eventID,
+	)
+	return err
+}
+
+// GetAuditEntries retrieves the latest entries of the audit log, the most
+// recent first, optionally only the ones about a type of entity
+func GetAuditEntries(entityType string, limit int) ([]AuditEntry, error) {
+	query := "SELECT id, occurred_at, actor, action, entity_type, entity_id, event_type, event_id FROM audit_log"
+	var args []any
+	if entityType != "" {
+		query += " WHERE entity_type = ?"
+		args = append(args, entityType)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var entityID sql.NullInt64
+		err := rows.Scan(&e.ID, &e.OccurredAt, &e.Actor, &e.Action, &e.EntityType, &entityID, &e.EventType, &e.EventID)
+		if err != nil {
+			return nil, err
+		}
+		e.EntityID = entityID.Int64
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// GetAuditEntityTypes retrieves the types of the entities in the audit log
+func GetAuditEntityTypes() ([]string, error) {
+	rows, err := database.DB.Query("SELECT DISTINCT entity_type FROM audit_log ORDER BY entity_type")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var types []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+	}
+	return types, rows.Err()
+}
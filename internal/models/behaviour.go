@@ -1,7 +1,12 @@
 package models
 
 import (
+	"database/sql"
+	"fmt"
+	"time"
+
 	"pds/internal/database"
+	"pds/internal/events"
 )
 
 // Behaviour represents a behaviour that conflicts with an aim
@@ -14,27 +19,122 @@ type Behaviour struct {
 	ConflictingAimName string // For display purposes
 }
 
-// CreateBehaviour inserts a new behaviour into the database
+// BehaviourOccurrence records a moment where a behaviour happened
+type BehaviourOccurrence struct {
+	ID          int64
+	BehaviourID int64
+	Note        string
+	OccurredAt  time.Time
+}
+
+// AimOccurrences counts the behaviour occurrences conflicting with an aim
+type AimOccurrences struct {
+	AimID   int64
+	AimName string
+	Count   int
+}
+
+// BehaviourStreak tells how long a behaviour has been avoided
+type BehaviourStreak struct {
+	BehaviourID    int64
+	BehaviourName  string
+	LastOccurrence time.Time // Zero if the behaviour never occurred
+}
+
+// Days returns the number of full days since the last occurrence
+func (s BehaviourStreak) Days(now time.Time) int {
+	return int(now.Sub(s.LastOccurrence).Hours() / 24)
+}
+
+// CreateBehaviour inserts a new behaviour into the database, starting the
+// history of its mark
 func CreateBehaviour(name, description, mark string, conflictingAimID int64) (int64, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	query := "INSERT INTO behaviours (name, description, mark, conflicting_aim_id) VALUES (?, ?, ?, ?)"
-	result, err := database.DB.Exec(query, name, description, mark, conflictingAimID)
+	result, err := tx.Exec(query, name, description, mark, conflictingAimID)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
 	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+	if mark != "" {
+		if err := recordMarkChange(tx, id, mark); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	events.Publish(events.BehaviourCreated, map[string]any{"id": id, "name": name, "mark": mark, "conflicting_aim_id": conflictingAimID})
+	return id, nil
+}
+
+// UpdateBehaviour updates a behaviour, recording its mark in its history
+// when it changed
+func UpdateBehaviour(behaviour Behaviour) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var previousMark string
+	query := "SELECT COALESCE(mark, '') FROM behaviours WHERE id = ? AND deleted_at IS NULL"
+	if err := tx.QueryRow(query, behaviour.ID).Scan(&previousMark); err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"UPDATE behaviours SET name = ?, description = ?, mark = ?, conflicting_aim_id = ? WHERE id = ?",
+		behaviour.Name, behaviour.Description, behaviour.Mark, behaviour.ConflictingAimID, behaviour.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if behaviour.Mark != previousMark {
+		if err := recordMarkChange(tx, behaviour.ID, behaviour.Mark); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	events.Publish(events.BehaviourUpdated, map[string]any{
+		"id": behaviour.ID, "name": behaviour.Name, "mark": behaviour.Mark, "previous_mark": previousMark,
+		"conflicting_aim_id": behaviour.ConflictingAimID,
+	})
+	return nil
+}
+
+// recordMarkChange adds the mark a behaviour was just given to its history
+func recordMarkChange(tx *sql.Tx, behaviourID int64, mark string) error {
+	_, err := tx.Exec("INSERT INTO behaviour_mark_history (behaviour_id, mark) VALUES (?, ?)", behaviourID, mark)
+	return err
 }
 
 // GetAllBehaviours retrieves all behaviours with their conflicting aim names
 func GetAllBehaviours() ([]Behaviour, error) {
 	query := `
-		SELECT b.id, b.name, b.description, b.mark, b.conflicting_aim_id, a.name
+		SELECT b.id, b.name, b.description, b.mark, b.conflicting_aim_id, COALESCE(a.name, '')
 		FROM behaviours b
-		LEFT JOIN aims a ON b.conflicting_aim_id = a.id
+		LEFT JOIN aims a ON b.conflicting_aim_id = a.id AND a.deleted_at IS NULL
+		WHERE b.deleted_at IS NULL
 	`
 	rows, err := database.DB.Query(query)
 	if err != nil {
 		return nil, err
 	}
+	return scanBehaviours(rows)
+}
+
+// scanBehaviours reads the selected behaviours and closes rows
+func scanBehaviours(rows *sql.Rows) ([]Behaviour, error) {
 	defer rows.Close()
 
 	var behaviours []Behaviour
@@ -52,12 +152,172 @@ func GetAllBehaviours() ([]Behaviour, error) {
 		}
 		behaviours = append(behaviours, behaviour)
 	}
-	return behaviours, nil
+	return behaviours, rows.Err()
 }
 
-// DeleteBehaviour deletes a behaviour by ID
+// DeleteBehaviour moves a behaviour to the trash by ID
 func DeleteBehaviour(id int64) error {
-	query := "DELETE FROM behaviours WHERE id = ?"
-	_, err := database.DB.Exec(query, id)
-	return err
+	if err := trashRow("behaviours", id); err != nil {
+		return fmt.Errorf("failed to delete behaviour %d: %w", id, err)
+	}
+	events.Publish(events.BehaviourDeleted, map[string]any{"id": id})
+	return nil
+}
+
+// RestoreBehaviour moves a behaviour out of the trash by ID
+func RestoreBehaviour(id int64) error {
+	if err := restoreRow("behaviours", id); err != nil {
+		return fmt.Errorf("failed to restore behaviour %d: %w", id, err)
+	}
+	events.Publish(events.BehaviourRestored, map[string]any{"id": id})
+	return nil
+}
+
+// PurgeBehaviour permanently deletes a behaviour in the trash, its
+// occurrences, its intentions, the history of its mark and its links by ID
+func PurgeBehaviour(id int64) error {
+	deleteOutcomes := func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM intention_outcomes WHERE intention_id IN (SELECT id FROM intentions WHERE behaviour_id = ?)", id)
+		return err
+	}
+	err := purgeRowWith("behaviours", id, deleteOutcomes, "intentions.behaviour_id", "behaviour_mark_history.behaviour_id",
+		"behaviour_occurrences.behaviour_id", "statement_behaviours.behaviour_id", "journal_behaviours.behaviour_id")
+	if err != nil {
+		return fmt.Errorf("failed to purge behaviour %d: %w", id, err)
+	}
+	events.Publish(events.BehaviourPurged, map[string]any{"id": id})
+	return nil
+}
+
+// GetBehaviour retrieves a behaviour by ID
+func GetBehaviour(id int64) (Behaviour, error) {
+	query := `
+		SELECT b.id, b.name, b.description, b.mark, b.conflicting_aim_id, COALESCE(a.name, '')
+		FROM behaviours b
+		LEFT JOIN aims a ON b.conflicting_aim_id = a.id AND a.deleted_at IS NULL
+		WHERE b.id = ? AND b.deleted_at IS NULL
+	`
+	var behaviour Behaviour
+	err := database.DB.QueryRow(query, id).Scan(
+		&behaviour.ID,
+		&behaviour.Name,
+		&behaviour.Description,
+		&behaviour.Mark,
+		&behaviour.ConflictingAimID,
+		&behaviour.ConflictingAimName,
+	)
+	return behaviour, err
+}
+
+// LogBehaviourOccurrence records that a behaviour just happened. It fails
+// with sql.ErrNoRows if the behaviour does not exist or is in the trash.
+func LogBehaviourOccurrence(behaviourID int64, note string) (BehaviourOccurrence, error) {
+	query := "INSERT INTO behaviour_occurrences (behaviour_id, note) SELECT id, ? FROM behaviours WHERE id = ? AND deleted_at IS NULL"
+	result, err := database.DB.Exec(query, note, behaviourID)
+	if err != nil {
+		return BehaviourOccurrence{}, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return BehaviourOccurrence{}, err
+	} else if n == 0 {
+		return BehaviourOccurrence{}, sql.ErrNoRows
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return BehaviourOccurrence{}, err
+	}
+	occurrence, err := GetBehaviourOccurrence(id)
+	if err != nil {
+		return occurrence, err
+	}
+	events.Publish(events.BehaviourLogged, map[string]any{
+		"id": occurrence.ID, "behaviour_id": behaviourID, "note": note, "occurred_at": occurrence.OccurredAt,
+	})
+	return occurrence, nil
+}
+
+// GetBehaviourOccurrence retrieves an occurrence by ID
+func GetBehaviourOccurrence(id int64) (BehaviourOccurrence, error) {
+	query := "SELECT id, behaviour_id, note, occurred_at FROM behaviour_occurrences WHERE id = ?"
+	var occurrence BehaviourOccurrence
+	var note sql.NullString
+	err := database.DB.QueryRow(query, id).Scan(&occurrence.ID, &occurrence.BehaviourID, &note, &occurrence.OccurredAt)
+	occurrence.Note = note.String
+	return occurrence, err
+}
+
+// CountBehaviourOccurrences counts the behaviour occurrences in [start, end)
+func CountBehaviourOccurrences(start, end time.Time) (int, error) {
+	var count int
+	err := database.DB.QueryRow(
+		`SELECT COUNT(*) FROM behaviour_occurrences o
+		 JOIN behaviours b ON o.behaviour_id = b.id AND b.deleted_at IS NULL
+		 WHERE o.occurred_at >= ? AND o.occurred_at < ?`,
+		sqlTime(start), sqlTime(end),
+	).Scan(&count)
+	return count, err
+}
+
+// GetOccurrencesByAim counts the behaviour occurrences in [start, end),
+// grouped by the aim the behaviour conflicts with
+func GetOccurrencesByAim(start, end time.Time) ([]AimOccurrences, error) {
+	query := `
+		SELECT a.id, a.name, COUNT(o.id)
+		FROM behaviour_occurrences o
+		JOIN behaviours b ON o.behaviour_id = b.id AND b.deleted_at IS NULL
+		JOIN aims a ON b.conflicting_aim_id = a.id AND a.deleted_at IS NULL
+		WHERE o.occurred_at >= ? AND o.occurred_at < ?
+		GROUP BY a.id, a.name
+		ORDER BY COUNT(o.id) DESC
+	`
+	rows, err := database.DB.Query(query, sqlTime(start), sqlTime(end))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []AimOccurrences
+	for rows.Next() {
+		var count AimOccurrences
+		if err := rows.Scan(&count.AimID, &count.AimName, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// GetBehaviourStreaks retrieves the last occurrence of every behaviour,
+// the most recent first
+func GetBehaviourStreaks() ([]BehaviourStreak, error) {
+	query := `
+		SELECT b.id, b.name, MAX(o.occurred_at)
+		FROM behaviours b
+		LEFT JOIN behaviour_occurrences o ON o.behaviour_id = b.id
+		WHERE b.deleted_at IS NULL
+		GROUP BY b.id, b.name
+		ORDER BY MAX(o.occurred_at) IS NULL, MAX(o.occurred_at) DESC
+	`
+	rows, err := database.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var streaks []BehaviourStreak
+	for rows.Next() {
+		var streak BehaviourStreak
+		var last sql.NullString
+		if err := rows.Scan(&streak.BehaviourID, &streak.BehaviourName, &last); err != nil {
+			return nil, err
+		}
+		if last.Valid {
+			streak.LastOccurrence, err = time.Parse(sqlTimeFormat, last.String)
+			if err != nil {
+				return nil, err
+			}
+		}
+		streaks = append(streaks, streak)
+	}
+	return streaks, rows.Err()
 }
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"time"
+
+	"pds/internal/database"
+)
+
+// CalendarDay summarises the activity of a single day
+type CalendarDay struct {
+	Day           time.Time
+	JournalCounts []JournalTypeCount
+	Mood          float64 // Average mood, zero if no mood was recorded
+	Occurrences   int     // Behaviour occurrences
+}
+
+// Journals is the number of journal entries written on the day
+func (d CalendarDay) Journals() int {
+	total := 0
+	for _, count := range d.JournalCounts {
+		total += count.Count
+	}
+	return total
+}
+
+// GetCalendarDays summarises the activity of every day in [start, end),
+// where start and end are local midnights
+func GetCalendarDays(start, end time.Time) ([]CalendarDay, error) {
+	var days []CalendarDay
+	index := make(map[string]int)
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		index[sqlDate(day)] = len(days)
+		days = append(days, CalendarDay{Day: day})
+	}
+
+	rows, err := database.DB.Query(
+		`SELECT date(created_at, 'localtime'), journal_type, COUNT(*)
+		 FROM journals
+		 WHERE created_at >= ? AND created_at < ? AND deleted_at IS NULL
+		 GROUP BY date(created_at, 'localtime'), journal_type
+		 ORDER BY date(created_at, 'localtime'), journal_type`,
+		sqlTime(start), sqlTime(end),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day string
+		var count JournalTypeCount
+		if err := rows.Scan(&day, &count.JournalType, &count.Count); err != nil {
+			return nil, err
+		}
+		if i, ok := index[day]; ok {
+			days[i].JournalCounts = append(days[i].JournalCounts, count)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	moods, err := GetDailyMoods(start, end)
+	if err != nil {
+		return nil, err
+	}
+	for _, mood := range moods {
+		if i, ok := index[sqlDate(mood.Day)]; ok {
+			days[i].Mood = mood.Average
+		}
+	}
+
+	occurrenceRows, err := database.DB.Query(
+		`SELECT date(o.occurred_at, 'localtime'), COUNT(*)
+		 FROM behaviour_occurrences o
+		 JOIN behaviours b ON o.behaviour_id = b.id AND b.deleted_at IS NULL
+		 WHERE o.occurred_at >= ? AND o.occurred_at < ?
+		 GROUP BY date(o.occurred_at, 'localtime')`,
+		sqlTime(start), sqlTime(end),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer occurrenceRows.Close()
+
+	for occurrenceRows.Next() {
+		var day string
+		var count int
+		if err := occurrenceRows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		if i, ok := index[day]; ok {
+			days[i].Occurrences = count
+		}
+	}
+
+	return days, occurrenceRows.Err()
+}
+
+// GetJournalsForDay retrieves the journal entries written on the day
+// starting at the given local midnight
+func GetJournalsForDay(day time.Time) ([]Journal, error) {
+	return queryJournals(
+		"SELECT "+journalColumns+" FROM journals WHERE created_at >= ? AND created_at < ? AND deleted_at IS NULL ORDER BY created_at, id",
+		sqlTime(day), sqlTime(day.AddDate(0, 0, 1)),
+	)
+}
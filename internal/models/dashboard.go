@@ -0,0 +1,210 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"pds/internal/database"
+)
+
+// DashboardWidget is a block of the dashboard home page
+type DashboardWidget struct {
+	Name     string
+	Title    string
+	Position int
+	Enabled  bool
+}
+
+// dashboardWidgets lists the available widgets in their default order
+var dashboardWidgets = []DashboardWidget{
+	{Name: "statements", Title: "Today's Statements"},
+	{Name: "plans", Title: "Active Plans"},
+	{Name: "behaviours", Title: "Behaviour Streaks"},
+	{Name: "habits", Title: "Today's Habits"},
+	{Name: "journals", Title: "Recent Journal Entries"},
+	{Name: "mood", Title: "Mood"},
+	{Name: "attention", Title: "Aims Needing Attention"},
+	{Name: "health", Title: "Aim Health"},
+}
+
+// IsDashboardWidget reports whether name identifies an available widget
+func IsDashboardWidget(name string) bool {
+	for _, widget := range dashboardWidgets {
+		if widget.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDashboardWidgets retrieves every available widget, ordered as chosen by
+// the user. Widgets the user never configured are enabled and come last.
+func GetDashboardWidgets() ([]DashboardWidget, error) {
+	rows, err := database.DB.Query("SELECT name, position, enabled FROM dashboard_widgets")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type setting struct {
+		position int
+		enabled  bool
+	}
+	settings := make(map[string]setting)
+	for rows.Next() {
+		var name string
+		var s setting
+		if err := rows.Scan(&name, &s.position, &s.enabled); err != nil {
+			return nil, err
+		}
+		settings[name] = s
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	widgets := make([]DashboardWidget, len(dashboardWidgets))
+	for i, widget := range dashboardWidgets {
+		widget.Position = len(dashboardWidgets) + i
+		widget.Enabled = true
+		if s, ok := settings[widget.Name]; ok {
+			widget.Position = s.position
+			widget.Enabled = s.enabled
+		}
+		widgets[i] = widget
+	}
+	sort.SliceStable(widgets, func(i, j int) bool {
+		return widgets[i].Position < widgets[j].Position
+	})
+	return widgets, nil
+}
+
+// SaveDashboardWidgets stores the order and visibility of the widgets
+func SaveDashboardWidgets(widgets []DashboardWidget) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, widget := range widgets {
+		_, err := tx.Exec(
+			`INSERT INTO dashboard_widgets (name, position, enabled) VALUES (?, ?, ?)
+			 ON CONFLICT (name) DO UPDATE SET position = excluded.position, enabled = excluded.enabled`,
+			widget.Name, widget.Position, widget.Enabled,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// habitAttentionRate is the habit completion rate under which an aim needs attention
+const habitAttentionRate = 0.5
+
+// AimNeedingAttention is an aim that is neglected or under pressure
+type AimNeedingAttention struct {
+	AimID           int64
+	AimName         string
+	ActivePlans     int
+	Occurrences     int     // Occurrences of conflicting behaviours since the given date
+	Habits          int     // Habits serving the aim
+	HabitCompletion float64 // Average completion rate of its habits since the given date
+	habitsTracked   bool    // Whether any of its habits was expected to be done
+}
+
+// neglected reports whether nothing is done for the aim
+func (a AimNeedingAttention) neglected() bool {
+	return a.ActivePlans == 0 && a.Habits == 0
+}
+
+// habitsSlipping reports whether the habits serving the aim are not kept
+func (a AimNeedingAttention) habitsSlipping() bool {
+	return a.habitsTracked && a.HabitCompletion < habitAttentionRate
+}
+
+// Reason explains why the aim needs attention
+func (a AimNeedingAttention) Reason() string {
+	var reasons []string
+	if a.neglected() {
+		reasons = append(reasons, "no active plan or habit")
+	}
+	if a.Occurrences > 0 {
+		reasons = append(reasons, "conflicting behaviours keep happening")
+	}
+	if a.habitsSlipping() {
+		reasons = append(reasons, fmt.Sprintf("its habits are slipping (%.0f%% done)", a.HabitCompletion*100))
+	}
+	return strings.Join(reasons, " and ")
+}
+
+// GetAimsNeedingAttention retrieves the aims without any active plan or
+// habit, with conflicting behaviour occurrences since the given date, or
+// whose habits were mostly skipped since then, the most pressing first
+func GetAimsNeedingAttention(since time.Time) ([]AimNeedingAttention, error) {
+	query := `
+		SELECT a.id, a.name,
+			(SELECT COUNT(*) FROM plans p
+			 JOIN plan_aims pa ON pa.plan_id = p.id
+			 WHERE pa.aim_id = a.id AND p.started_at IS NOT NULL AND p.completed_at IS NULL AND p.deleted_at IS NULL) AS active_plans,
+			(SELECT COUNT(*) FROM behaviour_occurrences o
+			 JOIN behaviours b ON o.behaviour_id = b.id AND b.deleted_at IS NULL
+			 WHERE b.conflicting_aim_id = a.id AND o.occurred_at >= ?) AS occurrences
+		FROM aims a
+		WHERE a.deleted_at IS NULL
+		ORDER BY occurrences DESC, active_plans
+	`
+	rows, err := database.DB.Query(query, sqlTime(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all []AimNeedingAttention
+	for rows.Next() {
+		var a AimNeedingAttention
+		if err := rows.Scan(&a.AimID, &a.AimName, &a.ActivePlans, &a.Occurrences); err != nil {
+			return nil, err
+		}
+		all = append(all, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	habits, err := GetAllHabits()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	days := int(math.Round(localDay(now).Sub(localDay(since)).Hours()/24)) + 1
+
+	var aims []AimNeedingAttention
+	for _, a := range all {
+		var total float64
+		var tracked int
+		for _, habit := range habits {
+			if habit.AimID != a.AimID {
+				continue
+			}
+			a.Habits++
+			if rate, ok := habit.CompletionRate(now, days); ok {
+				total += rate
+				tracked++
+			}
+		}
+		if tracked > 0 {
+			a.HabitCompletion = total / float64(tracked)
+			a.habitsTracked = true
+		}
+
+		if a.neglected() || a.Occurrences > 0 || a.habitsSlipping() {
+			aims = append(aims, a)
+		}
+	}
+	return aims, nil
+}
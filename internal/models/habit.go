@@ -0,0 +1,369 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"pds/internal/database"
+	"pds/internal/events"
+)
+
+// Habit schedules
+const (
+	HabitDaily    = "daily"    // Every day
+	HabitWeekly   = "weekly"   // A number of days per week, any of them
+	HabitWeekdays = "weekdays" // Specific days of the week
+)
+
+// Habit is a positive habit serving an aim, checked in on the days it is done
+type Habit struct {
+	ID           int64
+	Name         string
+	Description  string
+	AimID        int64
+	AimName      string // For display purposes
+	Schedule     string
+	TimesPerWeek int            // For weekly habits
+	Weekdays     []time.Weekday // For habits on specific weekdays
+	CreatedAt    time.Time
+	CheckIns     map[string]bool // Days the habit was done, formatted as 2006-01-02
+}
+
+// localDay returns the local midnight starting the day of t
+func localDay(t time.Time) time.Time {
+	t = t.Local()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// startOfWeek returns the Monday starting the week of a day
+func startOfWeek(day time.Time) time.Time {
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// weekdayMask stores weekdays as a bitmask, bit 0 being Sunday
+func weekdayMask(weekdays []time.Weekday) int {
+	mask := 0
+	for _, weekday := range weekdays {
+		mask |= 1 << weekday
+	}
+	return mask
+}
+
+// maskWeekdays reads weekdays stored as a bitmask, starting on Monday
+func maskWeekdays(mask int) []time.Weekday {
+	var weekdays []time.Weekday
+	for i := 1; i <= 7; i++ {
+		weekday := time.Weekday(i % 7)
+		if mask&(1<<weekday) != 0 {
+			weekdays = append(weekdays, weekday)
+		}
+	}
+	return weekdays
+}
+
+// ScheduleText describes the schedule of the habit, e.g. "3 times a week"
+func (h Habit) ScheduleText() string {
+	switch h.Schedule {
+	case HabitWeekly:
+		if h.TimesPerWeek == 1 {
+			return "once a week"
+		}
+		return fmt.Sprintf("%d times a week", h.TimesPerWeek)
+	case HabitWeekdays:
+		names := make([]string, len(h.Weekdays))
+		for i, weekday := range h.Weekdays {
+			names[i] = weekday.String()[:3]
+		}
+		return "every " + strings.Join(names, ", ")
+	default:
+		return "every day"
+	}
+}
+
+// IsScheduled reports whether the habit may be done on a day. Weekly habits
+// may be done on any day.
+func (h Habit) IsScheduled(day time.Time) bool {
+	if h.Schedule != HabitWeekdays {
+		return true
+	}
+	for _, weekday := range h.Weekdays {
+		if day.Weekday() == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// Done reports whether the habit was checked in on a day
+func (h Habit) Done(day time.Time) bool {
+	return h.CheckIns[sqlDate(day)]
+}
+
+// Pending reports whether the habit is still to be done on the day of now:
+// it is scheduled and not done yet, or for weekly habits the target of the
+// week is not met yet
+func (h Habit) Pending(now time.Time) bool {
+	today := localDay(now)
+	if h.Done(today) {
+		return false
+	}
+	if h.Schedule == HabitWeekly {
+		return h.weekCount(startOfWeek(today)) < h.TimesPerWeek
+	}
+	return h.IsScheduled(today)
+}
+
+// firstDay is the day the habit was created, or the day of its first
+// check-in if it was done earlier
+func (h Habit) firstDay() time.Time {
+	first := localDay(h.CreatedAt)
+	for day := range h.CheckIns {
+		if d, err := time.ParseInLocation(sqlDateFormat, day, time.Local); err == nil && d.Before(first) {
+			first = d
+		}
+	}
+	return first
+}
+
+// weekCount counts the check-ins of the week starting on the given Monday
+func (h Habit) weekCount(week time.Time) int {
+	count := 0
+	for i := 0; i < 7; i++ {
+		if h.Done(week.AddDate(0, 0, i)) {
+			count++
+		}
+	}
+	return count
+}
+
+// Streak returns the number of consecutive scheduled days the habit was
+// done, or of weeks it met its target for weekly habits. The current day or
+// week does not break the streak until it is over.
+func (h Habit) Streak(now time.Time) int {
+	today := localDay(now)
+	first := h.firstDay()
+	streak := 0
+
+	if h.Schedule == HabitWeekly {
+		week := startOfWeek(today)
+		if h.weekCount(week) < h.TimesPerWeek {
+			week = week.AddDate(0, 0, -7)
+		}
+		for !week.Before(startOfWeek(first)) && h.weekCount(week) >= h.TimesPerWeek {
+			streak++
+			week = week.AddDate(0, 0, -7)
+		}
+		return streak
+	}
+
+	day := today
+	if !h.Done(day) {
+		day = day.AddDate(0, 0, -1)
+	}
+	for ; !day.Before(first); day = day.AddDate(0, 0, -1) {
+		if !h.IsScheduled(day) {
+			continue
+		}
+		if !h.Done(day) {
+			break
+		}
+		streak++
+	}
+	return streak
+}
+
+// StreakUnit is the unit of the streak of the habit
+func (h Habit) StreakUnit() string {
+	if h.Schedule == HabitWeekly {
+		return "weeks"
+	}
+	return "days"
+}
+
+// CompletionRate returns the share, between 0 and 1, of what the schedule
+// expected over the last given days that was done. The current day or week
+// only counts once done. It returns false when nothing was expected yet,
+// e.g. for a habit created today.
+func (h Habit) CompletionRate(now time.Time, days int) (float64, bool) {
+	today := localDay(now)
+	start := today.AddDate(0, 0, 1-days)
+	if first := h.firstDay(); first.After(start) {
+		start = first
+	}
+
+	var done, expected float64
+	if h.Schedule == HabitWeekly {
+		target := float64(h.TimesPerWeek)
+		for week := startOfWeek(start); !week.After(today); week = week.AddDate(0, 0, 7) {
+			covered, count := 0, 0
+			for i := 0; i < 7; i++ {
+				day := week.AddDate(0, 0, i)
+				if day.Before(start) || day.After(today) {
+					continue
+				}
+				covered++
+				if h.Done(day) {
+					count++
+				}
+			}
+			if week.Equal(startOfWeek(today)) && count < h.TimesPerWeek {
+				continue
+			}
+			weekTarget := target * float64(covered) / 7
+			done += min(float64(count), weekTarget)
+			expected += weekTarget
+		}
+	} else {
+		for day := start; !day.After(today); day = day.AddDate(0, 0, 1) {
+			if !h.IsScheduled(day) || (day.Equal(today) && !h.Done(day)) {
+				continue
+			}
+			expected++
+			if h.Done(day) {
+				done++
+			}
+		}
+	}
+
+	if expected == 0 {
+		return 0, false
+	}
+	return done / expected, true
+}
+
+// CreateHabit inserts a new habit into the database
+func CreateHabit(name, description string, aimID int64, schedule string, timesPerWeek int, weekdays []time.Weekday) (int64, error) {
+	result, err := database.DB.Exec(
+		"INSERT INTO habits (name, description, aim_id, schedule, times_per_week, weekdays) VALUES (?, ?, ?, ?, ?, ?)",
+		name, description, aimID, schedule, timesPerWeek, weekdayMask(weekdays),
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	events.Publish(events.HabitCreated, map[string]any{"id": id, "name": name, "aim_id": aimID, "schedule": schedule})
+	return id, nil
+}
+
+// habitQuery selects the habits not in the trash with the name of their aim
+const habitQuery = `
+	SELECT h.id, h.name, h.description, h.aim_id, COALESCE(a.name, ''), h.schedule, h.times_per_week, h.weekdays, h.created_at
+	FROM habits h
+	LEFT JOIN aims a ON h.aim_id = a.id AND a.deleted_at IS NULL
+	WHERE h.deleted_at IS NULL
+`
+
+// GetAllHabits retrieves all habits with their check-ins
+func GetAllHabits() ([]Habit, error) {
+	return queryHabits(habitQuery + " ORDER BY h.name")
+}
+
+// GetHabit retrieves a habit with its check-ins by ID
+func GetHabit(id int64) (Habit, error) {
+	habits, err := queryHabits(habitQuery+" AND h.id = ?", id)
+	if err != nil {
+		return Habit{}, err
+	}
+	if len(habits) == 0 {
+		return Habit{}, sql.ErrNoRows
+	}
+	return habits[0], nil
+}
+
+// queryHabits runs a query selecting habits and loads their check-ins
+func queryHabits(query string, args ...any) ([]Habit, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var habits []Habit
+	for rows.Next() {
+		var h Habit
+		var description sql.NullString
+		var mask int
+		if err := rows.Scan(&h.ID, &h.Name, &description, &h.AimID, &h.AimName, &h.Schedule, &h.TimesPerWeek, &mask, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		h.Description = description.String
+		h.Weekdays = maskWeekdays(mask)
+		habits = append(habits, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range habits {
+		if habits[i].CheckIns, err = getHabitCheckIns(habits[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return habits, nil
+}
+
+// getHabitCheckIns retrieves the days a habit was done
+func getHabitCheckIns(habitID int64) (map[string]bool, error) {
+	rows, err := database.DB.Query("SELECT day FROM habit_checkins WHERE habit_id = ?", habitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checkIns := make(map[string]bool)
+	for rows.Next() {
+		var day time.Time
+		if err := rows.Scan(&day); err != nil {
+			return nil, err
+		}
+		checkIns[sqlDate(day)] = true
+	}
+	return checkIns, rows.Err()
+}
+
+// SetHabitCheckIn records whether a habit was done on a day
+func SetHabitCheckIn(habitID int64, day time.Time, done bool) error {
+	var err error
+	if done {
+		_, err = database.DB.Exec("INSERT OR IGNORE INTO habit_checkins (habit_id, day) VALUES (?, ?)", habitID, sqlDate(day))
+	} else {
+		_, err = database.DB.Exec("DELETE FROM habit_checkins WHERE habit_id = ? AND day = ?", habitID, sqlDate(day))
+	}
+	if err != nil {
+		return err
+	}
+	events.Publish(events.HabitCheckedIn, map[string]any{"id": habitID, "day": sqlDate(day), "done": done})
+	return nil
+}
+
+// DeleteHabit moves a habit to the trash by ID
+func DeleteHabit(id int64) error {
+	if err := trashRow("habits", id); err != nil {
+		return fmt.Errorf("failed to delete habit %d: %w", id, err)
+	}
+	events.Publish(events.HabitDeleted, map[string]any{"id": id})
+	return nil
+}
+
+// RestoreHabit moves a habit out of the trash by ID
+func RestoreHabit(id int64) error {
+	if err := restoreRow("habits", id); err != nil {
+		return fmt.Errorf("failed to restore habit %d: %w", id, err)
+	}
+	events.Publish(events.HabitRestored, map[string]any{"id": id})
+	return nil
+}
+
+// PurgeHabit permanently deletes a habit in the trash and its check-ins by ID
+func PurgeHabit(id int64) error {
+	if err := purgeRow("habits", id, "habit_checkins.habit_id"); err != nil {
+		return fmt.Errorf("failed to purge habit %d: %w", id, err)
+	}
+	events.Publish(events.HabitPurged, map[string]any{"id": id})
+	return nil
+}
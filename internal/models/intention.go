@@ -0,0 +1,231 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"pds/internal/database"
+	"pds/internal/events"
+)
+
+// Intention is an implementation intention: an if-then plan responding to a
+// behaviour, e.g. "when I feel bored at my desk, I will take a walk"
+type Intention struct {
+	ID               int64
+	BehaviourID      int64
+	Cue              string // The feeling and situation triggering the behaviour
+	Response         string // What to do instead
+	PlanID           int64  // Zero if the intention follows no plan
+	PlanName         string // For display purposes
+	StatementID      int64  // Zero if the intention follows no statement
+	StatementContent string // For display purposes
+	CreatedAt        time.Time
+}
+
+// IntentionEffectiveness summarizes the outcomes recorded for an intention
+type IntentionEffectiveness struct {
+	Intention
+	Occurrences int // Occurrences of the behaviour since the intention was made
+	Recorded    int // Occurrences with an outcome recorded
+	Applied     int // Occurrences where the intention was applied
+	Worked      int // Occurrences where the intention was applied and worked
+}
+
+// ApplicationRate returns the share of the recorded occurrences where the
+// intention was applied, and false if no outcome was recorded
+func (e IntentionEffectiveness) ApplicationRate() (float64, bool) {
+	if e.Recorded == 0 {
+		return 0, false
+	}
+	return float64(e.Applied) / float64(e.Recorded), true
+}
+
+// SuccessRate returns the share of the applications of the intention that
+// worked, and false if it was never applied
+func (e IntentionEffectiveness) SuccessRate() (float64, bool) {
+	if e.Applied == 0 {
+		return 0, false
+	}
+	return float64(e.Worked) / float64(e.Applied), true
+}
+
+// intentionColumns selects an intention with the names of its plan and
+// statement, from intentions i joined with plans p and statements s
+const intentionColumns = `i.id, i.behaviour_id, i.cue, i.response, COALESCE(p.id, 0), COALESCE(p.name, ''),
+	COALESCE(s.id, 0), COALESCE(s.content, ''), i.created_at`
+
+// intentionJoins joins the plan and statement of an intention, unless they
+// are in the trash
+const intentionJoins = `
+	LEFT JOIN plans p ON i.plan_id = p.id AND p.deleted_at IS NULL
+	LEFT JOIN statements s ON i.statement_id = s.id AND s.deleted_at IS NULL`
+
+// CreateIntention adds an implementation intention to a behaviour. planID
+// and statementID are zero when the intention follows no plan or statement.
+func CreateIntention(behaviourID int64, cue, response string, planID, statementID int64) (int64, error) {
+	query := "INSERT INTO intentions (behaviour_id, cue, response, plan_id, statement_id) VALUES (?, ?, ?, ?, ?)"
+	result, err := database.DB.Exec(query, behaviourID, cue, response, nullID(planID), nullID(statementID))
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	events.Publish(events.IntentionCreated, map[string]any{
+		"id": id, "behaviour_id": behaviourID, "plan_id": planID, "statement_id": statementID,
+	})
+	return id, nil
+}
+
+// nullID stores a zero ID as NULL
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
+
+// GetIntention retrieves an intention by ID
+func GetIntention(id int64) (Intention, error) {
+	query := "SELECT " + intentionColumns + " FROM intentions i" + intentionJoins + " WHERE i.id = ? AND i.deleted_at IS NULL"
+	return scanIntention(database.DB.QueryRow(query, id))
+}
+
+// GetIntentionsForBehaviour retrieves the intentions responding to a
+// behaviour, the oldest first
+func GetIntentionsForBehaviour(behaviourID int64) ([]Intention, error) {
+	query := "SELECT " + intentionColumns + " FROM intentions i" + intentionJoins + " WHERE i.behaviour_id = ? AND i.deleted_at IS NULL ORDER BY i.id"
+	rows, err := database.DB.Query(query, behaviourID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var intentions []Intention
+	for rows.Next() {
+		intention, err := scanIntention(rows)
+		if err != nil {
+			return nil, err
+		}
+		intentions = append(intentions, intention)
+	}
+	return intentions, rows.Err()
+}
+
+// scanIntention reads an intention selected with intentionColumns
+func scanIntention(row rowScanner) (Intention, error) {
+	var intention Intention
+	err := row.Scan(
+		&intention.ID,
+		&intention.BehaviourID,
+		&intention.Cue,
+		&intention.Response,
+		&intention.PlanID,
+		&intention.PlanName,
+		&intention.StatementID,
+		&intention.StatementContent,
+		&intention.CreatedAt,
+	)
+	return intention, err
+}
+
+// DeleteIntention moves an intention to the trash by ID
+func DeleteIntention(id int64) error {
+	if err := trashRow("intentions", id); err != nil {
+		return fmt.Errorf("failed to delete intention %d: %w", id, err)
+	}
+	events.Publish(events.IntentionDeleted, map[string]any{"id": id})
+	return nil
+}
+
+// RestoreIntention moves an intention out of the trash by ID
+func RestoreIntention(id int64) error {
+	if err := restoreRow("intentions", id); err != nil {
+		return fmt.Errorf("failed to restore intention %d: %w", id, err)
+	}
+	events.Publish(events.IntentionRestored, map[string]any{"id": id})
+	return nil
+}
+
+// PurgeIntention permanently deletes an intention in the trash and its
+// outcomes by ID
+func PurgeIntention(id int64) error {
+	if err := purgeRow("intentions", id, "intention_outcomes.intention_id"); err != nil {
+		return fmt.Errorf("failed to purge intention %d: %w", id, err)
+	}
+	events.Publish(events.IntentionPurged, map[string]any{"id": id})
+	return nil
+}
+
+// RecordIntentionOutcome records whether an intention was applied when its
+// behaviour occurred, and whether it worked, replacing any outcome recorded
+// before. It fails with sql.ErrNoRows unless the occurrence is one of the
+// behaviour of the intention since the intention was set.
+func RecordIntentionOutcome(intentionID, occurrenceID int64, applied, worked bool) error {
+	// Whether an intention that was not applied worked is unknown
+	var workedValue sql.NullBool
+	if applied {
+		workedValue = sql.NullBool{Bool: worked, Valid: true}
+	}
+	err := execAffectingRow(`
+		INSERT INTO intention_outcomes (occurrence_id, intention_id, applied, worked)
+		SELECT o.id, i.id, ?, ?
+		FROM intentions i
+		JOIN behaviour_occurrences o ON o.behaviour_id = i.behaviour_id
+		WHERE i.id = ? AND i.deleted_at IS NULL AND o.id = ? AND o.occurred_at >= i.created_at
+		ON CONFLICT (occurrence_id, intention_id) DO UPDATE SET
+			applied = excluded.applied, worked = excluded.worked, recorded_at = CURRENT_TIMESTAMP`,
+		applied, workedValue, intentionID, occurrenceID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record outcome of intention %d: %w", intentionID, err)
+	}
+	events.Publish(events.IntentionOutcomeRecorded, map[string]any{
+		"id": intentionID, "occurrence_id": occurrenceID, "applied": applied, "worked": workedValue.Bool,
+	})
+	return nil
+}
+
+// GetIntentionEffectiveness summarizes the outcomes recorded for the
+// intentions responding to a behaviour, the oldest intention first
+func GetIntentionEffectiveness(behaviourID int64) ([]IntentionEffectiveness, error) {
+	query := `
+		SELECT ` + intentionColumns + `,
+			(SELECT COUNT(*) FROM behaviour_occurrences o
+			 WHERE o.behaviour_id = i.behaviour_id AND o.occurred_at >= i.created_at),
+			(SELECT COUNT(*) FROM intention_outcomes io WHERE io.intention_id = i.id),
+			(SELECT COUNT(*) FROM intention_outcomes io WHERE io.intention_id = i.id AND io.applied),
+			(SELECT COUNT(*) FROM intention_outcomes io WHERE io.intention_id = i.id AND io.applied AND io.worked)
+		FROM intentions i` + intentionJoins + `
+		WHERE i.behaviour_id = ? AND i.deleted_at IS NULL
+		ORDER BY i.id
+	`
+	rows, err := database.DB.Query(query, behaviourID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []IntentionEffectiveness
+	for rows.Next() {
+		var e IntentionEffectiveness
+		if err := rows.Scan(
+			&e.ID,
+			&e.BehaviourID,
+			&e.Cue,
+			&e.Response,
+			&e.PlanID,
+			&e.PlanName,
+			&e.StatementID,
+			&e.StatementContent,
+			&e.CreatedAt,
+			&e.Occurrences,
+			&e.Recorded,
+			&e.Applied,
+			&e.Worked,
+		); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, e)
+	}
+	return summaries, rows.Err()
+}
@@ -2,10 +2,14 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"pds/internal/database"
+	"pds/internal/events"
 )
 
 // Journal represents a journal entry in the database
@@ -16,12 +20,19 @@ type Journal struct {
 	JournalType string
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+	Tags        []string
+	Aims        []Aim
+	Plans       []Plan
+	Behaviours  []Behaviour
+	Attachments []Attachment
 }
 
-// GetAllJournals retrieves all journal entries from the database
-func GetAllJournals() ([]Journal, error) {
-	db := database.DB
-	rows, err := db.Query("SELECT id, title, content, journal_type, created_at, updated_at FROM journals ORDER BY created_at DESC")
+const journalColumns = "id, title, content, journal_type, created_at, updated_at"
+
+// queryJournals runs a query selecting journalColumns and loads the tags and
+// links of the journal entries
+func queryJournals(query string, args ...any) ([]Journal, error) {
+	rows, err := database.DB.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -43,33 +54,177 @@ func GetAllJournals() ([]Journal, error) {
 		return nil, err
 	}
 
+	for i := range journals {
+		if err := loadJournalDetails(&journals[i]); err != nil {
+			return nil, err
+		}
+	}
+
 	return journals, nil
 }
 
+// loadJournalDetails reads the tags, links and attachments of a journal entry
+func loadJournalDetails(j *Journal) error {
+	if err := loadJournalLinks(j); err != nil {
+		return err
+	}
+	var err error
+	j.Attachments, err = GetJournalAttachments(j.ID)
+	return err
+}
+
+// GetAllJournals retrieves all journal entries from the database
+func GetAllJournals() ([]Journal, error) {
+	return queryJournals("SELECT " + journalColumns + " FROM journals WHERE deleted_at IS NULL ORDER BY created_at DESC")
+}
+
+// GetRecentJournals retrieves the most recent journal entries
+func GetRecentJournals(limit int) ([]Journal, error) {
+	return queryJournals("SELECT "+journalColumns+" FROM journals WHERE deleted_at IS NULL ORDER BY created_at DESC LIMIT ?", limit)
+}
+
+// JournalFilter restricts the journal entries listed by ListJournals. Empty
+// fields match all the entries.
+type JournalFilter struct {
+	Type string
+	Tag  string
+}
+
+// JournalCursor is the position of a journal entry in the list of entries,
+// ordered from the most recent one. Pages are fetched after a cursor rather
+// than at an offset, so that they stay consistent when entries are added and
+// do not get slower further down the list.
+type JournalCursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// IsZero reports whether the cursor is the start of the list
+func (c JournalCursor) IsZero() bool {
+	return c.ID == 0
+}
+
+// String encodes the cursor for URLs, e.g. "1729350000-42"
+func (c JournalCursor) String() string {
+	if c.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(c.CreatedAt.Unix(), 10) + "-" + strconv.FormatInt(c.ID, 10)
+}
+
+// ParseJournalCursor decodes a cursor encoded by String. An empty string
+// gives the start of the list.
+func ParseJournalCursor(s string) (JournalCursor, error) {
+	if s == "" {
+		return JournalCursor{}, nil
+	}
+	unixStr, idStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return JournalCursor{}, fmt.Errorf("invalid journal cursor %q", s)
+	}
+	unix, err := strconv.ParseInt(unixStr, 10, 64)
+	if err != nil {
+		return JournalCursor{}, fmt.Errorf("invalid journal cursor %q", s)
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || id <= 0 {
+		return JournalCursor{}, fmt.Errorf("invalid journal cursor %q", s)
+	}
+	return JournalCursor{CreatedAt: time.Unix(unix, 0).UTC(), ID: id}, nil
+}
+
+// ListJournals retrieves a page of at most limit journal entries matching
+// the filter, the most recent first, starting after the given cursor. It
+// also returns the cursor of the next page, which is zero on the last page.
+func ListJournals(filter JournalFilter, after JournalCursor, limit int) ([]Journal, JournalCursor, error) {
+	conditions := []string{"deleted_at IS NULL"}
+	var args []any
+	if filter.Type != "" {
+		conditions = append(conditions, "journal_type = ?")
+		args = append(args, filter.Type)
+	}
+	if filter.Tag != "" {
+		conditions = append(conditions, "id IN (SELECT journal_id FROM journal_tags WHERE tag = ?)")
+		args = append(args, NormalizeTag(filter.Tag))
+	}
+	if !after.IsZero() {
+		conditions = append(conditions, "(created_at < ? OR (created_at = ? AND id < ?))")
+		args = append(args, sqlTime(after.CreatedAt), sqlTime(after.CreatedAt), after.ID)
+	}
+
+	query := "SELECT " + journalColumns + " FROM journals WHERE " + strings.Join(conditions, " AND ")
+	// One more entry than needed tells whether there is a next page
+	query += " ORDER BY created_at DESC, id DESC LIMIT ?"
+	args = append(args, limit+1)
+
+	journals, err := queryJournals(query, args...)
+	if err != nil {
+		return nil, JournalCursor{}, err
+	}
+
+	var next JournalCursor
+	if len(journals) > limit {
+		journals = journals[:limit]
+		last := journals[limit-1]
+		next = JournalCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+	return journals, next, nil
+}
+
 // GetJournal retrieves a journal entry by ID
 func GetJournal(id int64) (Journal, error) {
 	db := database.DB
 	var j Journal
 	var content sql.NullString
-	err := db.QueryRow("SELECT id, title, content, journal_type, created_at, updated_at FROM journals WHERE id = ?", id).
+	err := db.QueryRow("SELECT "+journalColumns+" FROM journals WHERE id = ? AND deleted_at IS NULL", id).
 		Scan(&j.ID, &j.Title, &content, &j.JournalType, &j.CreatedAt, &j.UpdatedAt)
-	if err == nil {
-		j.Content = content.String
+	if err != nil {
+		return j, err
 	}
-	return j, err
+	j.Content = content.String
+	return j, loadJournalDetails(&j)
 }
 
-// CreateJournal inserts a new journal entry into the database
-func CreateJournal(title string, content string, journalType string) (int64, error) {
-	db := database.DB
-	result, err := db.Exec(
+// CreateJournal inserts a new journal entry with its links and attachments
+// in one transaction. The #tags and @aims written in its content are linked
+// in addition to the given links. The entry is published once complete.
+func CreateJournal(title, content, journalType string, links JournalLinks, files []NewAttachment) (int64, error) {
+	links, err := links.withInlineLinks(content)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
 		"INSERT INTO journals (title, content, journal_type) VALUES (?, ?, ?)",
 		title, content, journalType,
 	)
 	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := saveJournalLinks(tx, id, links); err != nil {
+		return 0, err
+	}
+	attachmentIDs, err := insertAttachments(tx, id, files)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	events.Publish(events.JournalCreated, map[string]any{"id": id, "title": title, "type": journalType})
+	publishAttachmentsCreated(id, files, attachmentIDs)
+	return id, nil
 }
 
 // UpdateJournal updates an existing journal entry
@@ -79,54 +234,95 @@ func UpdateJournal(id int64, title string, content string, journalType string) e
 		"UPDATE journals SET title = ?, content = ?, journal_type = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
 		title, content, journalType, id,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	events.Publish(events.JournalUpdated, map[string]any{"id": id, "title": title, "type": journalType})
+	return nil
 }
 
-// GetJournalsByType retrieves all journal entries of a specific type
-func GetJournalsByType(journalType string) ([]Journal, error) {
-	db := database.DB
-	rows, err := db.Query("SELECT id, title, content, journal_type, created_at, updated_at FROM journals WHERE journal_type = ? ORDER BY created_at DESC", journalType)
-	if err != nil {
-		return nil, err
+// DeleteJournal moves a journal entry to the trash by ID
+func DeleteJournal(id int64) error {
+	if err := trashRow("journals", id); err != nil {
+		return fmt.Errorf("failed to delete journal entry %d: %w", id, err)
 	}
-	defer rows.Close()
+	events.Publish(events.JournalDeleted, map[string]any{"id": id})
+	return nil
+}
 
-	var journals []Journal
-	for rows.Next() {
-		var j Journal
-		var content sql.NullString
-		err := rows.Scan(&j.ID, &j.Title, &content, &j.JournalType, &j.CreatedAt, &j.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-		j.Content = content.String
-		journals = append(journals, j)
+// RestoreJournal moves a journal entry out of the trash by ID
+func RestoreJournal(id int64) error {
+	if err := restoreRow("journals", id); err != nil {
+		return fmt.Errorf("failed to restore journal entry %d: %w", id, err)
 	}
+	events.Publish(events.JournalRestored, map[string]any{"id": id})
+	return nil
+}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+// PurgeJournal permanently deletes a journal entry in the trash, with its
+// tags, links and attachments, by ID. The files of the attachments are left
+// to the garbage collection.
+func PurgeJournal(id int64) error {
+	err := purgeRow("journals", id, "journal_tags.journal_id", "journal_aims.journal_id",
+		"journal_plans.journal_id", "journal_behaviours.journal_id", "attachments.journal_id")
+	if err != nil {
+		return fmt.Errorf("failed to purge journal entry %d: %w", id, err)
 	}
+	events.Publish(events.JournalPurged, map[string]any{"id": id})
+	return nil
+}
 
-	return journals, nil
+// CountJournals counts all the journal entries
+func CountJournals() (int, error) {
+	var count int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM journals WHERE deleted_at IS NULL").Scan(&count)
+	return count, err
 }
 
-// DeleteJournal deletes a journal entry by ID
-func DeleteJournal(id int64) error {
+// GetLastJournalTime retrieves the time the latest journal entry was
+// written, zero if there is none
+func GetLastJournalTime() (time.Time, error) {
+	var createdAt time.Time
+	err := database.DB.QueryRow("SELECT created_at FROM journals WHERE deleted_at IS NULL ORDER BY created_at DESC LIMIT 1").Scan(&createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return createdAt, err
+}
+
+// JournalTypeCount is the number of journal entries of a given type
+type JournalTypeCount struct {
+	JournalType string
+	Count       int
+}
+
+// CountJournalsByType counts the journal entries written in [start, end) for each type
+func CountJournalsByType(start, end time.Time) ([]JournalTypeCount, error) {
 	db := database.DB
-	query := "DELETE FROM journals WHERE id = ?"
-	result, err := db.Exec(query, id)
+	rows, err := db.Query(
+		`SELECT journal_type, COUNT(*) FROM journals
+		 WHERE created_at >= ? AND created_at < ? AND deleted_at IS NULL
+		 GROUP BY journal_type
+		 ORDER BY COUNT(*) DESC`,
+		sqlTime(start), sqlTime(end),
+	)
 	if err != nil {
-		return fmt.Errorf("failed to delete journal entry: %w", err)
+		return nil, err
 	}
+	defer rows.Close()
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to retrieve rows affected: %w", err)
+	var counts []JournalTypeCount
+	for rows.Next() {
+		var c JournalTypeCount
+		if err := rows.Scan(&c.JournalType, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("no journal entry found with ID %d", id)
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return counts, nil
 }
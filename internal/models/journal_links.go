@@ -0,0 +1,262 @@
+package models
+
+import (
+	"database/sql"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"pds/internal/database"
+)
+
+// inlineTagPattern and inlineMentionPattern find the #tag and @aim written
+// in the content of a journal entry. They must not be preceded by a word
+// character, so that e-mail addresses and URL fragments are ignored.
+var (
+	inlineTagPattern     = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_])#([\p{L}\p{N}_-]+)`)
+	inlineMentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_])@([\p{L}\p{N}_-]+)`)
+	tagPattern           = regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)
+)
+
+// TagCount is a tag with the number of journal entries carrying it
+type TagCount struct {
+	Tag   string
+	Count int
+}
+
+// NormalizeTag returns the stored form of a tag, lowercase and without its
+// leading #, or an empty string if the tag is not valid
+func NormalizeTag(tag string) string {
+	tag = strings.ToLower(strings.TrimLeft(strings.TrimSpace(tag), "#"))
+	if !tagPattern.MatchString(tag) {
+		return ""
+	}
+	return tag
+}
+
+// ParseTags reads a list of tags separated by commas or spaces, e.g.
+// "work, #health sleep"
+func ParseTags(text string) []string {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+
+	var tags []string
+	for _, field := range fields {
+		if tag := NormalizeTag(field); tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ExtractTags returns the #tags written in the content of a journal entry
+func ExtractTags(content string) []string {
+	var tags []string
+	for _, match := range inlineTagPattern.FindAllStringSubmatch(content, -1) {
+		if tag := NormalizeTag(match[1]); tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// MentionName returns how an aim is mentioned in a journal entry: its name
+// in lowercase with spaces replaced by dashes, e.g. @physical-health
+func MentionName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), "-"))
+}
+
+// ExtractMentionedAims returns the IDs of the aims mentioned as @aim in the
+// content of a journal entry. Unknown mentions are ignored.
+func ExtractMentionedAims(content string) ([]int64, error) {
+	matches := inlineMentionPattern.FindAllStringSubmatch(content, -1)
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	aims, err := GetAllValues()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	for _, match := range matches {
+		mention := strings.ToLower(match[1])
+		for _, aim := range aims {
+			if MentionName(aim.Name) == mention && !slices.Contains(ids, aim.ID) {
+				ids = append(ids, aim.ID)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// JournalLinks are the tags of a journal entry and the aims, plans and
+// behaviours it is linked to
+type JournalLinks struct {
+	Tags         []string
+	AimIDs       []int64
+	PlanIDs      []int64
+	BehaviourIDs []int64
+}
+
+// withInlineLinks adds the #tags and @aims written in the content of a
+// journal entry to its links
+func (l JournalLinks) withInlineLinks(content string) (JournalLinks, error) {
+	l.Tags = slices.Clone(l.Tags)
+	for _, tag := range ExtractTags(content) {
+		if !slices.Contains(l.Tags, tag) {
+			l.Tags = append(l.Tags, tag)
+		}
+	}
+
+	mentioned, err := ExtractMentionedAims(content)
+	if err != nil {
+		return l, err
+	}
+	l.AimIDs = slices.Clone(l.AimIDs)
+	for _, aimID := range mentioned {
+		if !slices.Contains(l.AimIDs, aimID) {
+			l.AimIDs = append(l.AimIDs, aimID)
+		}
+	}
+	return l, nil
+}
+
+// saveJournalLinks replaces the tags of a journal entry and what it is
+// linked to within a transaction
+func saveJournalLinks(tx *sql.Tx, journalID int64, links JournalLinks) error {
+	if err := setJournalTags(tx, journalID, links.Tags); err != nil {
+		return err
+	}
+	if err := replaceLinksTx(tx, "journal_aims", "journal_id", journalID, "aim_id", links.AimIDs); err != nil {
+		return err
+	}
+	if err := replaceLinksTx(tx, "journal_plans", "journal_id", journalID, "plan_id", links.PlanIDs); err != nil {
+		return err
+	}
+	return replaceLinksTx(tx, "journal_behaviours", "journal_id", journalID, "behaviour_id", links.BehaviourIDs)
+}
+
+// setJournalTags replaces the tags of a journal entry within a transaction
+func setJournalTags(tx *sql.Tx, journalID int64, tags []string) error {
+	if _, err := tx.Exec("DELETE FROM journal_tags WHERE journal_id = ?", journalID); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO journal_tags (journal_id, tag) VALUES (?, ?)", journalID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadJournalLinks reads the tags of a journal entry and what it is linked to
+func loadJournalLinks(j *Journal) error {
+	rows, err := database.DB.Query("SELECT tag FROM journal_tags WHERE journal_id = ? ORDER BY tag", j.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	j.Tags = nil
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return err
+		}
+		j.Tags = append(j.Tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	aimRows, err := database.DB.Query(
+		`SELECT a.id, a.name, a.description
+		 FROM aims a
+		 JOIN journal_aims ja ON a.id = ja.aim_id
+		 WHERE ja.journal_id = ? AND a.deleted_at IS NULL
+		 ORDER BY a.name`,
+		j.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if j.Aims, err = scanAims(aimRows); err != nil {
+		return err
+	}
+
+	j.Plans, err = queryPlans(
+		"SELECT "+planColumns+" FROM plans WHERE id IN (SELECT plan_id FROM journal_plans WHERE journal_id = ?) AND deleted_at IS NULL ORDER BY name",
+		j.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	behaviourRows, err := database.DB.Query(
+		`SELECT b.id, b.name, b.description, b.mark, b.conflicting_aim_id, COALESCE(a.name, '')
+		 FROM behaviours b
+		 LEFT JOIN aims a ON b.conflicting_aim_id = a.id AND a.deleted_at IS NULL
+		 WHERE b.id IN (SELECT behaviour_id FROM journal_behaviours WHERE journal_id = ?) AND b.deleted_at IS NULL
+		 ORDER BY b.name`,
+		j.ID,
+	)
+	if err != nil {
+		return err
+	}
+	j.Behaviours, err = scanBehaviours(behaviourRows)
+	return err
+}
+
+// GetAllTags retrieves the tags in use, the most used first
+func GetAllTags() ([]TagCount, error) {
+	rows, err := database.DB.Query(`SELECT tag, COUNT(*) FROM journal_tags
+		 WHERE journal_id IN (SELECT id FROM journals WHERE deleted_at IS NULL)
+		 GROUP BY tag ORDER BY COUNT(*) DESC, tag`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []TagCount
+	for rows.Next() {
+		var t TagCount
+		if err := rows.Scan(&t.Tag, &t.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// GetJournalsForAim retrieves the journal entries linked to an aim
+func GetJournalsForAim(aimID int64) ([]Journal, error) {
+	return queryJournals(
+		"SELECT "+journalColumns+" FROM journals WHERE id IN (SELECT journal_id FROM journal_aims WHERE aim_id = ?) AND deleted_at IS NULL ORDER BY created_at DESC",
+		aimID,
+	)
+}
+
+// GetJournalsForPlan retrieves the journal entries linked to a plan
+func GetJournalsForPlan(planID int64) ([]Journal, error) {
+	return queryJournals(
+		"SELECT "+journalColumns+" FROM journals WHERE id IN (SELECT journal_id FROM journal_plans WHERE plan_id = ?) AND deleted_at IS NULL ORDER BY created_at DESC",
+		planID,
+	)
+}
+
+// GetJournalsForBehaviour retrieves the journal entries linked to a behaviour
+func GetJournalsForBehaviour(behaviourID int64) ([]Journal, error) {
+	return queryJournals(
+		"SELECT "+journalColumns+" FROM journals WHERE id IN (SELECT journal_id FROM journal_behaviours WHERE behaviour_id = ?) AND deleted_at IS NULL ORDER BY created_at DESC",
+		behaviourID,
+	)
+}
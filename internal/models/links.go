@@ -0,0 +1,128 @@
+package models
+
+import (
+	"database/sql"
+
+	"pds/internal/database"
+	"pds/internal/events"
+)
+
+// replaceLinks replaces the rows of a join table belonging to an owner,
+// e.g. all the aims linked to a statement
+func replaceLinks(table, ownerColumn string, ownerID int64, otherColumn string, otherIDs []int64) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceLinksTx(tx, table, ownerColumn, ownerID, otherColumn, otherIDs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// replaceLinksTx is replaceLinks within a transaction
+func replaceLinksTx(tx *sql.Tx, table, ownerColumn string, ownerID int64, otherColumn string, otherIDs []int64) error {
+	if _, err := tx.Exec("DELETE FROM "+table+" WHERE "+ownerColumn+" = ?", ownerID); err != nil {
+		return err
+	}
+
+	for _, otherID := range otherIDs {
+		_, err := tx.Exec(
+			"INSERT OR IGNORE INTO "+table+" ("+ownerColumn+", "+otherColumn+") VALUES (?, ?)",
+			ownerID, otherID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetStatementAims replaces the aims supported by a statement
+func SetStatementAims(statementID int64, aimIDs []int64) error {
+	if err := replaceLinks("statement_aims", "statement_id", statementID, "aim_id", aimIDs); err != nil {
+		return err
+	}
+	events.Publish(events.StatementUpdated, map[string]any{"id": statementID, "aim_ids": aimIDs})
+	return nil
+}
+
+// SetStatementBehaviours replaces the behaviours countered by a statement
+func SetStatementBehaviours(statementID int64, behaviourIDs []int64) error {
+	if err := replaceLinks("statement_behaviours", "statement_id", statementID, "behaviour_id", behaviourIDs); err != nil {
+		return err
+	}
+	events.Publish(events.StatementUpdated, map[string]any{"id": statementID, "behaviour_ids": behaviourIDs})
+	return nil
+}
+
+// SetAimStatements replaces the statements supporting an aim
+func SetAimStatements(aimID int64, statementIDs []int64) error {
+	if err := replaceLinks("statement_aims", "aim_id", aimID, "statement_id", statementIDs); err != nil {
+		return err
+	}
+	events.Publish(events.AimUpdated, map[string]any{"id": aimID, "statement_ids": statementIDs})
+	return nil
+}
+
+// SetBehaviourStatements replaces the statements countering a behaviour
+func SetBehaviourStatements(behaviourID int64, statementIDs []int64) error {
+	if err := replaceLinks("statement_behaviours", "behaviour_id", behaviourID, "statement_id", statementIDs); err != nil {
+		return err
+	}
+	events.Publish(events.BehaviourUpdated, map[string]any{"id": behaviourID, "statement_ids": statementIDs})
+	return nil
+}
+
+// GetStatementsForAim retrieves the statements supporting an aim
+func GetStatementsForAim(aimID int64) ([]Statement, error) {
+	query := `
+		SELECT ` + statementColumns + ` FROM statements
+		WHERE id IN (SELECT statement_id FROM statement_aims WHERE aim_id = ?) AND deleted_at IS NULL
+		ORDER BY priority DESC, id
+	`
+	return queryStatements(query, aimID)
+}
+
+// GetStatementsForBehaviour retrieves the statements countering a behaviour
+func GetStatementsForBehaviour(behaviourID int64) ([]Statement, error) {
+	query := `
+		SELECT ` + statementColumns + ` FROM statements
+		WHERE id IN (SELECT statement_id FROM statement_behaviours WHERE behaviour_id = ?) AND deleted_at IS NULL
+		ORDER BY priority DESC, id
+	`
+	return queryStatements(query, behaviourID)
+}
+
+// GetAimsForStatement retrieves the aims supported by a statement
+func GetAimsForStatement(statementID int64) ([]Aim, error) {
+	rows, err := database.DB.Query(
+		`SELECT a.id, a.name, a.description
+		 FROM aims a
+		 JOIN statement_aims sa ON a.id = sa.aim_id
+		 WHERE sa.statement_id = ? AND a.deleted_at IS NULL`,
+		statementID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanAims(rows)
+}
+
+// GetBehavioursForStatement retrieves the behaviours countered by a statement
+func GetBehavioursForStatement(statementID int64) ([]Behaviour, error) {
+	query := `
+		SELECT b.id, b.name, b.description, b.mark, b.conflicting_aim_id, COALESCE(a.name, '')
+		FROM behaviours b
+		LEFT JOIN aims a ON b.conflicting_aim_id = a.id AND a.deleted_at IS NULL
+		JOIN statement_behaviours sb ON b.id = sb.behaviour_id
+		WHERE sb.statement_id = ? AND b.deleted_at IS NULL
+	`
+	rows, err := database.DB.Query(query, statementID)
+	if err != nil {
+		return nil, err
+	}
+	return scanBehaviours(rows)
+}
@@ -0,0 +1,282 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pds/internal/database"
+)
+
+// Kinds of mark scales
+const (
+	MarkScaleNumeric = "numeric" // Whole numbers in a range, the highest the most severe
+	MarkScaleLevels  = "levels"  // Named levels, from the least to the most severe
+)
+
+// maxMarkScaleSize is the largest number of marks a scale can have, so that
+// they can all be offered in a list
+const maxMarkScaleSize = 100
+
+// UnmarkedFilter selects the unmarked behaviours when filtering them by mark.
+// Marks are never blank, so no mark can be confused with it.
+const UnmarkedFilter = " "
+
+// DefaultMarkScale is the scale of the marks of behaviours until one is
+// configured
+var DefaultMarkScale = MarkScale{Kind: MarkScaleNumeric, Min: 1, Max: 5}
+
+// MarkLevel is a named level of a mark scale
+type MarkLevel struct {
+	Name   string
+	Colour string // CSS hex colour, e.g. #d9534f
+}
+
+// MarkScale defines the marks rating how severe a behaviour is. Behaviours
+// may be left unmarked.
+type MarkScale struct {
+	Kind   string
+	Min    int         // For numeric scales
+	Max    int         // For numeric scales
+	Levels []MarkLevel // For scales of levels, the least severe first
+}
+
+// MarkChange records the mark a behaviour was given at some time
+type MarkChange struct {
+	BehaviourID int64
+	Mark        string // Empty if the mark was removed
+	ChangedAt   time.Time
+}
+
+// colourPattern matches CSS hex colours
+var colourPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Validate checks that a scale is well defined
+func (s MarkScale) Validate() error {
+	switch s.Kind {
+	case MarkScaleNumeric:
+		if s.Min >= s.Max {
+			return errors.New("the lowest mark must be below the highest one")
+		}
+		if s.Max-s.Min+1 > maxMarkScaleSize {
+			return fmt.Errorf("a scale can have at most %d marks", maxMarkScaleSize)
+		}
+	case MarkScaleLevels:
+		if len(s.Levels) < 2 {
+			return errors.New("a scale needs at least two levels")
+		}
+		if len(s.Levels) > maxMarkScaleSize {
+			return fmt.Errorf("a scale can have at most %d marks", maxMarkScaleSize)
+		}
+		seen := make(map[string]bool)
+		for _, level := range s.Levels {
+			if level.Name == "" || strings.TrimSpace(level.Name) != level.Name {
+				return fmt.Errorf("level %q must have a name without surrounding spaces", level.Name)
+			}
+			key := strings.ToLower(level.Name)
+			if seen[key] {
+				return fmt.Errorf("level %q is defined twice", level.Name)
+			}
+			seen[key] = true
+			if !colourPattern.MatchString(level.Colour) {
+				return fmt.Errorf("level %q has an invalid colour %q", level.Name, level.Colour)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown kind of scale %q", s.Kind)
+	}
+	return nil
+}
+
+// Marks lists the marks of the scale, the least severe first
+func (s MarkScale) Marks() []string {
+	var marks []string
+	switch s.Kind {
+	case MarkScaleNumeric:
+		for n := s.Min; n <= s.Max; n++ {
+			marks = append(marks, strconv.Itoa(n))
+		}
+	case MarkScaleLevels:
+		for _, level := range s.Levels {
+			marks = append(marks, level.Name)
+		}
+	}
+	return marks
+}
+
+// Normalize returns the mark of the scale a user typed, e.g. "Severe" for
+// "severe ", or an error if it is not on the scale. An empty mark stays
+// empty.
+func (s MarkScale) Normalize(mark string) (string, error) {
+	mark = strings.TrimSpace(mark)
+	if mark == "" {
+		return "", nil
+	}
+	if rank, ok := s.Rank(mark); ok {
+		return s.Marks()[rank], nil
+	}
+	switch s.Kind {
+	case MarkScaleNumeric:
+		return "", fmt.Errorf("the mark must be a whole number between %d and %d", s.Min, s.Max)
+	default:
+		return "", fmt.Errorf("the mark must be one of %s", strings.Join(s.Marks(), ", "))
+	}
+}
+
+// Rank returns the position of a mark on the scale, the least severe being
+// 0, and false if the mark is not on the scale
+func (s MarkScale) Rank(mark string) (int, bool) {
+	mark = strings.TrimSpace(mark)
+	switch s.Kind {
+	case MarkScaleNumeric:
+		n, err := strconv.Atoi(mark)
+		if err != nil || n < s.Min || n > s.Max {
+			return 0, false
+		}
+		return n - s.Min, true
+	case MarkScaleLevels:
+		for i, level := range s.Levels {
+			if strings.EqualFold(level.Name, mark) {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Colour returns the colour of a mark, or "" if the mark is not on the
+// scale. Numeric marks go from green to red as they get more severe.
+func (s MarkScale) Colour(mark string) string {
+	rank, ok := s.Rank(mark)
+	if !ok {
+		return ""
+	}
+	if s.Kind == MarkScaleLevels {
+		return s.Levels[rank].Colour
+	}
+	hue := 120 - 120*rank/(s.Max-s.Min)
+	return fmt.Sprintf("hsl(%d, 70%%, 45%%)", hue)
+}
+
+// SortBehavioursByMark sorts behaviours from the most to the least severe
+// mark. Unmarked behaviours, and the ones whose mark is not on the scale,
+// come last.
+func (s MarkScale) SortBehavioursByMark(behaviours []Behaviour) {
+	sort.SliceStable(behaviours, func(i, j int) bool {
+		ri, oki := s.Rank(behaviours[i].Mark)
+		rj, okj := s.Rank(behaviours[j].Mark)
+		if oki != okj {
+			return oki
+		}
+		return ri > rj
+	})
+}
+
+// ParseMarkLevels parses levels written one per line as a name optionally
+// followed by a colour, e.g. "Severe #d9534f". Levels without a colour are
+// grey.
+func ParseMarkLevels(text string) []MarkLevel {
+	var levels []MarkLevel
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		level := MarkLevel{Name: line, Colour: "#999999"}
+		if i := strings.LastIndex(line, " "); i > 0 && strings.HasPrefix(line[i+1:], "#") {
+			level.Name, level.Colour = strings.TrimSpace(line[:i]), line[i+1:]
+		}
+		levels = append(levels, level)
+	}
+	return levels
+}
+
+// FormatMarkLevels writes levels one per line, as read by ParseMarkLevels
+func FormatMarkLevels(levels []MarkLevel) string {
+	lines := make([]string, len(levels))
+	for i, level := range levels {
+		lines[i] = level.Name + " " + level.Colour
+	}
+	return strings.Join(lines, "\n")
+}
+
+// markScaleFields maps the setting keys to the fields of a scale, as text
+type markScaleFields struct {
+	Kind, Min, Max, Levels string
+}
+
+func (f *markScaleFields) fields() map[string]*string {
+	return map[string]*string{
+		"mark_scale_kind":   &f.Kind,
+		"mark_scale_min":    &f.Min,
+		"mark_scale_max":    &f.Max,
+		"mark_scale_levels": &f.Levels,
+	}
+}
+
+// GetMarkScale retrieves the scale of the marks of behaviours
+func GetMarkScale() (MarkScale, error) {
+	var f markScaleFields
+	if err := getSettings(f.fields()); err != nil {
+		return DefaultMarkScale, err
+	}
+	if f.Kind == "" {
+		return DefaultMarkScale, nil
+	}
+
+	scale := MarkScale{Kind: f.Kind, Levels: ParseMarkLevels(f.Levels)}
+	if f.Kind == MarkScaleNumeric {
+		var err error
+		if scale.Min, err = strconv.Atoi(f.Min); err != nil {
+			return DefaultMarkScale, fmt.Errorf("invalid lowest mark %q: %w", f.Min, err)
+		}
+		if scale.Max, err = strconv.Atoi(f.Max); err != nil {
+			return DefaultMarkScale, fmt.Errorf("invalid highest mark %q: %w", f.Max, err)
+		}
+	}
+	if err := scale.Validate(); err != nil {
+		return DefaultMarkScale, fmt.Errorf("invalid mark scale: %w", err)
+	}
+	return scale, nil
+}
+
+// SaveMarkScale stores the scale of the marks of behaviours. The marks
+// already given are kept, even if they are not on the new scale.
+func SaveMarkScale(scale MarkScale) error {
+	if err := scale.Validate(); err != nil {
+		return err
+	}
+	f := markScaleFields{
+		Kind:   scale.Kind,
+		Min:    strconv.Itoa(scale.Min),
+		Max:    strconv.Itoa(scale.Max),
+		Levels: FormatMarkLevels(scale.Levels),
+	}
+	return saveSettings(f.fields())
+}
+
+// GetMarkHistory retrieves the marks a behaviour was given, the oldest first
+func GetMarkHistory(behaviourID int64) ([]MarkChange, error) {
+	rows, err := database.DB.Query(
+		"SELECT behaviour_id, mark, changed_at FROM behaviour_mark_history WHERE behaviour_id = ? ORDER BY changed_at, id",
+		behaviourID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []MarkChange
+	for rows.Next() {
+		var change MarkChange
+		if err := rows.Scan(&change.BehaviourID, &change.Mark, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
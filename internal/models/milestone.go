@@ -0,0 +1,139 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"pds/internal/database"
+	"pds/internal/events"
+)
+
+// Milestone is an intermediate step of a plan, due on a date
+type Milestone struct {
+	ID          int64
+	PlanID      int64
+	PlanName    string // For display purposes
+	Name        string
+	DueDate     time.Time
+	CompletedAt time.Time // Zero if the milestone is not reached yet
+}
+
+// IsOverdue reports whether the milestone was still not reached after its due
+// date
+func (m Milestone) IsOverdue(now time.Time) bool {
+	return m.CompletedAt.IsZero() && now.After(m.DueDate.AddDate(0, 0, 1))
+}
+
+// milestoneColumns selects a milestone with the name of its plan, from
+// plan_milestones m joined with plans p
+const milestoneColumns = "m.id, m.plan_id, p.name, m.name, m.due_date, m.completed_at"
+
+// CreateMilestone adds a milestone due on a day to a plan
+func CreateMilestone(planID int64, name string, dueDate time.Time) (int64, error) {
+	query := "INSERT INTO plan_milestones (plan_id, name, due_date) VALUES (?, ?, ?)"
+	result, err := database.DB.Exec(query, planID, name, sqlDate(dueDate))
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	events.Publish(events.MilestoneCreated, map[string]any{
+		"id": id, "plan_id": planID, "name": name, "due_date": sqlDate(dueDate),
+	})
+	return id, nil
+}
+
+// GetMilestone retrieves a milestone by ID
+func GetMilestone(id int64) (Milestone, error) {
+	query := "SELECT " + milestoneColumns + " FROM plan_milestones m JOIN plans p ON m.plan_id = p.id WHERE m.id = ? AND m.deleted_at IS NULL"
+	return scanMilestone(database.DB.QueryRow(query, id))
+}
+
+// GetMilestonesForPlan retrieves the milestones of a plan, the earliest due
+// first
+func GetMilestonesForPlan(planID int64) ([]Milestone, error) {
+	query := "SELECT " + milestoneColumns + " FROM plan_milestones m JOIN plans p ON m.plan_id = p.id WHERE m.plan_id = ? AND m.deleted_at IS NULL ORDER BY m.due_date, m.id"
+	return queryMilestones(query, planID)
+}
+
+// GetAllMilestones retrieves the milestones of all the plans, leaving out
+// those in the trash, the earliest due first
+func GetAllMilestones() ([]Milestone, error) {
+	query := "SELECT " + milestoneColumns + " FROM plan_milestones m JOIN plans p ON m.plan_id = p.id WHERE m.deleted_at IS NULL AND p.deleted_at IS NULL ORDER BY m.due_date, m.id"
+	return queryMilestones(query)
+}
+
+// queryMilestones runs a query selecting milestoneColumns
+func queryMilestones(query string, args ...any) ([]Milestone, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var milestones []Milestone
+	for rows.Next() {
+		milestone, err := scanMilestone(rows)
+		if err != nil {
+			return nil, err
+		}
+		milestones = append(milestones, milestone)
+	}
+	return milestones, rows.Err()
+}
+
+// scanMilestone reads a milestone selected with milestoneColumns
+func scanMilestone(row rowScanner) (Milestone, error) {
+	var milestone Milestone
+	var completedAt sql.NullTime
+	err := row.Scan(
+		&milestone.ID,
+		&milestone.PlanID,
+		&milestone.PlanName,
+		&milestone.Name,
+		&milestone.DueDate,
+		&completedAt,
+	)
+	milestone.CompletedAt = completedAt.Time
+	return milestone, err
+}
+
+// CompleteMilestone marks a milestone as reached
+func CompleteMilestone(id int64) error {
+	query := "UPDATE plan_milestones SET completed_at = CURRENT_TIMESTAMP WHERE id = ? AND completed_at IS NULL AND deleted_at IS NULL"
+	if err := execAffectingRow(query, id); err != nil {
+		return fmt.Errorf("failed to complete milestone %d: %w", id, err)
+	}
+	events.Publish(events.MilestoneCompleted, map[string]any{"id": id})
+	return nil
+}
+
+// DeleteMilestone moves a milestone to the trash by ID
+func DeleteMilestone(id int64) error {
+	if err := trashRow("plan_milestones", id); err != nil {
+		return fmt.Errorf("failed to delete milestone %d: %w", id, err)
+	}
+	events.Publish(events.MilestoneDeleted, map[string]any{"id": id})
+	return nil
+}
+
+// RestoreMilestone moves a milestone out of the trash by ID
+func RestoreMilestone(id int64) error {
+	if err := restoreRow("plan_milestones", id); err != nil {
+		return fmt.Errorf("failed to restore milestone %d: %w", id, err)
+	}
+	events.Publish(events.MilestoneRestored, map[string]any{"id": id})
+	return nil
+}
+
+// PurgeMilestone permanently deletes a milestone in the trash by ID
+func PurgeMilestone(id int64) error {
+	if err := purgeRow("plan_milestones", id); err != nil {
+		return fmt.Errorf("failed to purge milestone %d: %w", id, err)
+	}
+	events.Publish(events.MilestonePurged, map[string]any{"id": id})
+	return nil
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"pds/internal/database"
+	"pds/internal/events"
+)
+
+// Mood represents how the user felt at a given moment, on a scale from 1 to 5
+type Mood struct {
+	ID        int64
+	Score     int
+	Note      string
+	CreatedAt time.Time
+}
+
+// MoodPoint is the average mood of a single day
+type MoodPoint struct {
+	Day     time.Time
+	Average float64
+}
+
+// CreateMood records a new mood
+func CreateMood(score int, note string) (int64, error) {
+	query := "INSERT INTO moods (score, note) VALUES (?, ?)"
+	result, err := database.DB.Exec(query, score, note)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	events.Publish(events.MoodCreated, map[string]any{"id": id, "score": score, "note": note})
+	return id, nil
+}
+
+// GetLatestMood retrieves the most recently recorded mood
+func GetLatestMood() (Mood, error) {
+	query := "SELECT id, score, note, created_at FROM moods ORDER BY created_at DESC, id DESC LIMIT 1"
+	var mood Mood
+	var note sql.NullString
+	err := database.DB.QueryRow(query).Scan(&mood.ID, &mood.Score, &note, &mood.CreatedAt)
+	mood.Note = note.String
+	return mood, err
+}
+
+// GetDailyMoods retrieves the average mood of every day in [start, end)
+func GetDailyMoods(start, end time.Time) ([]MoodPoint, error) {
+	query := `
+		SELECT date(created_at, 'localtime'), AVG(score)
+		FROM moods
+		WHERE created_at >= ? AND created_at < ?
+		GROUP BY date(created_at, 'localtime')
+		ORDER BY date(created_at, 'localtime')
+	`
+	rows, err := database.DB.Query(query, sqlTime(start), sqlTime(end))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []MoodPoint
+	for rows.Next() {
+		var day string
+		var point MoodPoint
+		if err := rows.Scan(&day, &point.Average); err != nil {
+			return nil, err
+		}
+		point.Day, err = time.ParseInLocation(sqlDateFormat, day, time.Local)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return points, nil
+}
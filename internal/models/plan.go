@@ -1,7 +1,13 @@
 package models
 
 import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
 	"pds/internal/database"
+	"pds/internal/events"
 )
 
 // Plan represents a plan in the system
@@ -11,33 +17,378 @@ type Plan struct {
 	Description       string
 	ResourcesRequired string
 	ValueID           int64
+	CreatedAt         time.Time
+	StartedAt         time.Time // Zero if the plan has not been started
+	DueDate           time.Time // Zero if the plan has no deadline
+	CompletedAt       time.Time // Zero if the plan is not finished
+	Progress          int       // In percent
+	TemplateID        int64     // Zero unless the plan was instantiated from a template
+	Aims              []PlanAim // Only loaded by the functions that say so
+}
+
+// PlanAim is an aim served by a plan, with the weight of the contribution
+type PlanAim struct {
+	AimID   int64
+	AimName string
+	Weight  float64
+}
+
+// AimsLabel lists the aims served by the plan with their weights, for display
+func (p Plan) AimsLabel() string {
+	labels := make([]string, len(p.Aims))
+	for i, aim := range p.Aims {
+		labels[i] = fmt.Sprintf("%s (×%g)", aim.AimName, aim.Weight)
+	}
+	return strings.Join(labels, ", ")
+}
+
+// AimContribution is a plan serving an aim or one of its descendants
+type AimContribution struct {
+	Plan    Plan
+	AimID   int64 // The aim the plan is directly linked to
+	AimName string
+	Weight  float64
+	Share   float64 // Weight relative to the total weight of the plan's aims
+}
+
+// IsActive reports whether the plan has been started but not finished
+func (p Plan) IsActive() bool {
+	return !p.StartedAt.IsZero() && p.CompletedAt.IsZero()
+}
+
+// IsOverdue reports whether the plan was still unfinished after its due date
+func (p Plan) IsOverdue(now time.Time) bool {
+	if p.DueDate.IsZero() || !p.CompletedAt.IsZero() {
+		return false
+	}
+	return now.After(p.DueDate.AddDate(0, 0, 1))
+}
+
+// Status returns a human readable status for the plan
+func (p Plan) Status() string {
+	switch {
+	case !p.CompletedAt.IsZero():
+		return "Finished"
+	case p.IsOverdue(time.Now()):
+		return "Overdue"
+	case !p.StartedAt.IsZero():
+		return "In progress"
+	default:
+		return "Not started"
+	}
+}
+
+const planColumns = "id, name, description, resources_required, value_id, created_at, started_at, due_date, completed_at, progress, template_id"
+
+// prefixColumns qualifies a list of columns with a table alias
+func prefixColumns(alias, columns string) string {
+	return alias + "." + strings.ReplaceAll(columns, ", ", ", "+alias+".")
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanPlan reads a plan selected with planColumns
+func scanPlan(row rowScanner) (Plan, error) {
+	var plan Plan
+	var createdAt, startedAt, dueDate, completedAt sql.NullTime
+	var templateID sql.NullInt64
+	err := row.Scan(
+		&plan.ID,
+		&plan.Name,
+		&plan.Description,
+		&plan.ResourcesRequired,
+		&plan.ValueID,
+		&createdAt,
+		&startedAt,
+		&dueDate,
+		&completedAt,
+		&plan.Progress,
+		&templateID,
+	)
+	plan.CreatedAt = createdAt.Time
+	plan.StartedAt = startedAt.Time
+	plan.DueDate = dueDate.Time
+	plan.CompletedAt = completedAt.Time
+	plan.TemplateID = templateID.Int64
+	return plan, err
+}
+
+// nullDate converts a zero time to NULL for DATE columns
+func nullDate(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return sqlDate(t)
+}
+
+// primaryAim returns the aim with the highest weight, stored in plans.value_id
+func primaryAim(aims []PlanAim) (int64, error) {
+	if len(aims) == 0 {
+		return 0, fmt.Errorf("a plan must serve at least one aim")
+	}
+	primary := aims[0]
+	for _, aim := range aims[1:] {
+		if aim.Weight > primary.Weight {
+			primary = aim
+		}
+	}
+	return primary.AimID, nil
+}
+
+// CreatePlan inserts a new plan serving the given aims into the database
+func CreatePlan(name, description, resourcesRequired string, aims []PlanAim, dueDate time.Time) (int64, error) {
+	return createPlan(name, description, resourcesRequired, aims, dueDate, nil, nil)
+}
+
+// ImportedPlan is a plan read from elsewhere, e.g. a to-do of a calendar
+type ImportedPlan struct {
+	Name        string
+	Description string
+	DueDate     time.Time // Zero if the plan has no due date
 }
 
-// CreatePlan inserts a new plan into the database
-func CreatePlan(name, description, resourcesRequired string, valueID int64) (int64, error) {
-	query := "INSERT INTO plans (name, description, resources_required, value_id) VALUES (?, ?, ?, ?)"
-	result, err := database.DB.Exec(query, name, description, resourcesRequired, valueID)
+// ImportPlans inserts the imported plans serving the given aims in one
+// transaction, so that a failed import leaves no plan behind, and returns
+// their IDs
+func ImportPlans(plans []ImportedPlan, aims []PlanAim) ([]int64, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids := make([]int64, len(plans))
+	for i, plan := range plans {
+		ids[i], err = insertPlan(tx, plan.Name, plan.Description, "", aims, plan.DueDate, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import plan %q: %w", plan.Name, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	for i, plan := range plans {
+		publishPlanCreated(ids[i], plan.Name, aims, plan.DueDate, nil)
+	}
+	return ids, nil
+}
+
+// createPlan inserts a new plan, instantiated from a template for one of its
+// occurrences unless templateID is nil
+func createPlan(name, description, resourcesRequired string, aims []PlanAim, dueDate time.Time, templateID, occurrence any) (int64, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := insertPlan(tx, name, description, resourcesRequired, aims, dueDate, templateID, occurrence)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	publishPlanCreated(id, name, aims, dueDate, templateID)
+	return id, nil
+}
+
+// insertPlan inserts a plan and the aims it serves within a transaction, so
+// that a plan is never stored without its aims
+func insertPlan(tx *sql.Tx, name, description, resourcesRequired string, aims []PlanAim, dueDate time.Time, templateID, occurrence any) (int64, error) {
+	valueID, err := primaryAim(aims)
 	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+
+	query := `INSERT INTO plans (name, description, resources_required, value_id, due_date, template_id, template_occurrence, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
+	result, err := tx.Exec(query, name, description, resourcesRequired, valueID, nullDate(dueDate), templateID, occurrence)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := setPlanAims(tx, id, aims); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// publishPlanCreated publishes the creation of a plan once it is committed
+func publishPlanCreated(id int64, name string, aims []PlanAim, dueDate time.Time, templateID any) {
+	data := map[string]any{"id": id, "name": name, "aim_ids": planAimIDs(aims), "due_date": nullDate(dueDate)}
+	if templateID != nil {
+		data["template_id"] = templateID
+	}
+	events.Publish(events.PlanCreated, data)
+}
+
+// planAimIDs returns the IDs of the aims served by a plan
+func planAimIDs(aims []PlanAim) []int64 {
+	ids := make([]int64, len(aims))
+	for i, aim := range aims {
+		ids[i] = aim.AimID
+	}
+	return ids
+}
+
+// setPlanAims replaces the aims served by a plan within a transaction
+func setPlanAims(tx *sql.Tx, planID int64, aims []PlanAim) error {
+	if _, err := tx.Exec("DELETE FROM plan_aims WHERE plan_id = ?", planID); err != nil {
+		return err
+	}
+	for _, aim := range aims {
+		_, err := tx.Exec("INSERT INTO plan_aims (plan_id, aim_id, weight) VALUES (?, ?, ?)", planID, aim.AimID, aim.Weight)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// GetPlan retrieves a plan by ID
+// GetPlanAims retrieves the aims served by a plan, the highest weight first
+func GetPlanAims(planID int64) ([]PlanAim, error) {
+	query := `
+		SELECT pa.aim_id, a.name, pa.weight
+		FROM plan_aims pa
+		JOIN aims a ON pa.aim_id = a.id
+		WHERE pa.plan_id = ? AND a.deleted_at IS NULL
+		ORDER BY pa.weight DESC, a.name
+	`
+	rows, err := database.DB.Query(query, planID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var aims []PlanAim
+	for rows.Next() {
+		var aim PlanAim
+		if err := rows.Scan(&aim.AimID, &aim.AimName, &aim.Weight); err != nil {
+			return nil, err
+		}
+		aims = append(aims, aim)
+	}
+	return aims, rows.Err()
+}
+
+// loadPlanAims fills the Aims of every plan
+func loadPlanAims(plans []Plan) error {
+	for i := range plans {
+		aims, err := GetPlanAims(plans[i].ID)
+		if err != nil {
+			return err
+		}
+		plans[i].Aims = aims
+	}
+	return nil
+}
+
+// GetPlan retrieves a plan by ID, with its aims
 func GetPlan(id int64) (Plan, error) {
-	query := "SELECT id, name, description, resources_required, value_id FROM plans WHERE id = ?"
-	var plan Plan
-	row := database.DB.QueryRow(query, id)
-	if err := row.Scan(&plan.ID, &plan.Name, &plan.Description, &plan.ResourcesRequired, &plan.ValueID); err != nil {
+	query := "SELECT " + planColumns + " FROM plans WHERE id = ? AND deleted_at IS NULL"
+	plan, err := scanPlan(database.DB.QueryRow(query, id))
+	if err != nil {
 		return plan, err
 	}
-	return plan, nil
+	plan.Aims, err = GetPlanAims(id)
+	return plan, err
 }
 
-// GetAllPlans retrieves all plans from the database
+// GetAllPlans retrieves all plans from the database, with their aims
 func GetAllPlans() ([]Plan, error) {
-	query := "SELECT id, name, description, resources_required, value_id FROM plans"
-	rows, err := database.DB.Query(query)
+	query := "SELECT " + planColumns + " FROM plans WHERE deleted_at IS NULL"
+	plans, err := queryPlans(query)
+	if err != nil {
+		return nil, err
+	}
+	return plans, loadPlanAims(plans)
+}
+
+// GetPlansServingAim retrieves the plans serving an aim or any of its
+// descendants in the values hierarchy, the largest contributions first
+func GetPlansServingAim(aimID int64) ([]AimContribution, error) {
+	query := `
+		WITH RECURSIVE descendants(id) AS (
+			SELECT ?
+			UNION
+			SELECT vp.value_id FROM value_parents vp
+			JOIN descendants d ON vp.parent_value_id = d.id
+			JOIN aims child ON vp.value_id = child.id AND child.deleted_at IS NULL
+		)
+		SELECT ` + prefixColumns("p", planColumns) + `, pa.aim_id, a.name, pa.weight,
+			pa.weight / (SELECT SUM(weight) FROM plan_aims WHERE plan_id = p.id) AS share
+		FROM plan_aims pa
+		JOIN plans p ON pa.plan_id = p.id
+		JOIN aims a ON pa.aim_id = a.id
+		WHERE pa.aim_id IN (SELECT id FROM descendants) AND p.deleted_at IS NULL AND a.deleted_at IS NULL
+		ORDER BY share DESC, p.name
+	`
+	rows, err := database.DB.Query(query, aimID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contributions []AimContribution
+	for rows.Next() {
+		var c AimContribution
+		var createdAt, startedAt, dueDate, completedAt sql.NullTime
+		var templateID sql.NullInt64
+		err := rows.Scan(
+			&c.Plan.ID,
+			&c.Plan.Name,
+			&c.Plan.Description,
+			&c.Plan.ResourcesRequired,
+			&c.Plan.ValueID,
+			&createdAt,
+			&startedAt,
+			&dueDate,
+			&completedAt,
+			&c.Plan.Progress,
+			&templateID,
+			&c.AimID,
+			&c.AimName,
+			&c.Weight,
+			&c.Share,
+		)
+		if err != nil {
+			return nil, err
+		}
+		c.Plan.CreatedAt = createdAt.Time
+		c.Plan.StartedAt = startedAt.Time
+		c.Plan.DueDate = dueDate.Time
+		c.Plan.CompletedAt = completedAt.Time
+		c.Plan.TemplateID = templateID.Int64
+		contributions = append(contributions, c)
+	}
+	return contributions, rows.Err()
+}
+
+// WeightedProgress is the progress of the plans serving an aim, weighted by
+// their share of contribution. It returns zero when no plan serves the aim.
+func WeightedProgress(contributions []AimContribution) float64 {
+	var total, progress float64
+	for _, c := range contributions {
+		total += c.Share
+		progress += c.Share * float64(c.Plan.Progress)
+	}
+	if total == 0 {
+		return 0
+	}
+	return progress / total
+}
+
+// queryPlans runs a query selecting planColumns and collects the results
+func queryPlans(query string, args ...any) ([]Plan, error) {
+	rows, err := database.DB.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -45,25 +396,157 @@ func GetAllPlans() ([]Plan, error) {
 
 	var plans []Plan
 	for rows.Next() {
-		var plan Plan
-		if err := rows.Scan(&plan.ID, &plan.Name, &plan.Description, &plan.ResourcesRequired, &plan.ValueID); err != nil {
+		plan, err := scanPlan(rows)
+		if err != nil {
 			return nil, err
 		}
 		plans = append(plans, plan)
 	}
-	return plans, nil
+	return plans, rows.Err()
+}
+
+// UpdatePlan updates an existing plan and the aims it serves
+func UpdatePlan(id int64, name, description, resourcesRequired string, aims []PlanAim, dueDate time.Time) error {
+	valueID, err := primaryAim(aims)
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE plans SET name = ?, description = ?, resources_required = ?, value_id = ?, due_date = ? WHERE id = ?"
+	if _, err := tx.Exec(query, name, description, resourcesRequired, valueID, nullDate(dueDate), id); err != nil {
+		return err
+	}
+	if err := setPlanAims(tx, id, aims); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	events.Publish(events.PlanUpdated, map[string]any{"id": id, "name": name, "aim_ids": planAimIDs(aims), "due_date": nullDate(dueDate)})
+	return nil
+}
+
+// StartPlan marks a plan as started
+func StartPlan(id int64) error {
+	query := "UPDATE plans SET started_at = CURRENT_TIMESTAMP WHERE id = ? AND started_at IS NULL"
+	return execPlanEvent(events.PlanStarted, id, query, id)
+}
+
+// execPlanEvent runs a query updating a plan, and publishes the event if
+// the plan was changed
+func execPlanEvent(eventType string, id int64, query string, args ...any) error {
+	result, err := database.DB.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	events.Publish(eventType, map[string]any{"id": id})
+	return nil
 }
 
-// UpdatePlan updates an existing plan
-func UpdatePlan(id int64, name, description, resourcesRequired string, valueID int64) error {
-	query := "UPDATE plans SET name = ?, description = ?, resources_required = ?, value_id = ? WHERE id = ?"
-	_, err := database.DB.Exec(query, name, description, resourcesRequired, valueID, id)
-	return err
+// CompletePlan marks a plan as finished, starting it first if needed
+func CompletePlan(id int64) error {
+	query := `
+		UPDATE plans
+		SET started_at = COALESCE(started_at, CURRENT_TIMESTAMP), completed_at = CURRENT_TIMESTAMP, progress = 100
+		WHERE id = ? AND completed_at IS NULL
+	`
+	return execPlanEvent(events.PlanCompleted, id, query, id)
 }
 
-// DeletePlan deletes a plan by ID
+// SetPlanProgress updates the progress of a plan, clamped to [0, 100]
+func SetPlanProgress(id int64, progress int) error {
+	progress = max(0, min(progress, 100))
+	query := "UPDATE plans SET progress = ? WHERE id = ?"
+	if _, err := database.DB.Exec(query, progress, id); err != nil {
+		return err
+	}
+	events.Publish(events.PlanProgress, map[string]any{"id": id, "progress": progress})
+	return nil
+}
+
+// SetPlanDescription updates the description of a plan, e.g. after ticking
+// one of its checklist items
+func SetPlanDescription(id int64, description string) error {
+	query := "UPDATE plans SET description = ? WHERE id = ?"
+	if _, err := database.DB.Exec(query, description, id); err != nil {
+		return err
+	}
+	events.Publish(events.PlanUpdated, map[string]any{"id": id})
+	return nil
+}
+
+// GetActivePlans retrieves the plans that are started but not finished,
+// the closest deadlines first
+func GetActivePlans() ([]Plan, error) {
+	query := `
+		SELECT ` + planColumns + ` FROM plans
+		WHERE started_at IS NOT NULL AND completed_at IS NULL AND deleted_at IS NULL
+		ORDER BY due_date IS NULL, due_date, started_at
+	`
+	return queryPlans(query)
+}
+
+// GetPlansStartedBetween retrieves the plans started in [start, end)
+func GetPlansStartedBetween(start, end time.Time) ([]Plan, error) {
+	query := "SELECT " + planColumns + " FROM plans WHERE started_at >= ? AND started_at < ? AND deleted_at IS NULL ORDER BY started_at"
+	return queryPlans(query, sqlTime(start), sqlTime(end))
+}
+
+// GetPlansCompletedBetween retrieves the plans finished in [start, end)
+func GetPlansCompletedBetween(start, end time.Time) ([]Plan, error) {
+	query := "SELECT " + planColumns + " FROM plans WHERE completed_at >= ? AND completed_at < ? AND deleted_at IS NULL ORDER BY completed_at"
+	return queryPlans(query, sqlTime(start), sqlTime(end))
+}
+
+// GetPlansOverdueAt retrieves the plans whose due date had passed at the
+// given time without them being finished
+func GetPlansOverdueAt(at time.Time) ([]Plan, error) {
+	query := `
+		SELECT ` + planColumns + ` FROM plans
+		WHERE due_date < ? AND (completed_at IS NULL OR completed_at >= ?) AND deleted_at IS NULL
+		ORDER BY due_date
+	`
+	return queryPlans(query, sqlDate(at), sqlTime(at))
+}
+
+// DeletePlan moves a plan to the trash by ID
 func DeletePlan(id int64) error {
-	query := "DELETE FROM plans WHERE id = ?"
-	_, err := database.DB.Exec(query, id)
-	return err
+	if err := trashRow("plans", id); err != nil {
+		return fmt.Errorf("failed to delete plan %d: %w", id, err)
+	}
+	events.Publish(events.PlanDeleted, map[string]any{"id": id})
+	return nil
+}
+
+// RestorePlan moves a plan out of the trash by ID
+func RestorePlan(id int64) error {
+	if err := restoreRow("plans", id); err != nil {
+		return fmt.Errorf("failed to restore plan %d: %w", id, err)
+	}
+	events.Publish(events.PlanRestored, map[string]any{"id": id})
+	return nil
+}
+
+// PurgePlan permanently deletes a plan in the trash and its links by ID. The
+// intentions following it are kept.
+func PurgePlan(id int64) error {
+	detachIntentions := func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE intentions SET plan_id = NULL WHERE plan_id = ?", id)
+		return err
+	}
+	err := purgeRowWith("plans", id, detachIntentions, "plan_aims.plan_id", "journal_plans.plan_id", "plan_milestones.plan_id")
+	if err != nil {
+		return fmt.Errorf("failed to purge plan %d: %w", id, err)
+	}
+	events.Publish(events.PlanPurged, map[string]any{"id": id})
+	return nil
 }
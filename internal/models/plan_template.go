@@ -0,0 +1,285 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"pds/internal/database"
+	"pds/internal/events"
+	"pds/internal/recurrence"
+)
+
+// PlanTemplate is a plan that repeats: a new plan is instantiated from it at
+// every occurrence of its recurrence rule
+type PlanTemplate struct {
+	ID                int64
+	Name              string
+	Description       string // Markdown, usually a checklist of tasks
+	ResourcesRequired string
+	Recurrence        string    // RFC 5545 RRULE, e.g. FREQ=WEEKLY;BYDAY=SU
+	StartsAt          time.Time // First possible occurrence
+	DurationDays      int       // Days from an occurrence to the due date of its plan, zero for none
+	NextRunAt         time.Time // Zero once the rule has no more occurrences
+	CreatedAt         time.Time
+	Aims              []PlanAim
+}
+
+// Rule returns the parsed recurrence rule of the template
+func (t PlanTemplate) Rule() (recurrence.Rule, error) {
+	return recurrence.Parse(t.Recurrence)
+}
+
+// RecurrenceText describes when plans are instantiated from the template
+func (t PlanTemplate) RecurrenceText() string {
+	rule, err := t.Rule()
+	if err != nil {
+		return t.Recurrence
+	}
+	return rule.Describe()
+}
+
+// CreatePlanTemplate inserts a new plan template serving the given aims.
+// Its first plan is instantiated at the first occurrence from startsAt.
+func CreatePlanTemplate(name, description, resourcesRequired string, rule recurrence.Rule, startsAt time.Time, durationDays int, aims []PlanAim) (int64, error) {
+	var nextRun any
+	if next, ok := rule.Next(startsAt, startsAt.Add(-time.Second)); ok {
+		nextRun = sqlTime(next)
+	}
+
+	// The template and its aims are created together, so that the scheduler
+	// never generates plans from a template without aims
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`INSERT INTO plan_templates (name, description, resources_required, recurrence, starts_at, duration_days, next_run_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		name, description, resourcesRequired, rule.String(), sqlTime(startsAt), durationDays, nextRun,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, aim := range aims {
+		_, err := tx.Exec("INSERT INTO plan_template_aims (template_id, aim_id, weight) VALUES (?, ?, ?)", id, aim.AimID, aim.Weight)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	events.Publish(events.PlanTemplateCreated, map[string]any{"id": id, "name": name, "recurrence": rule.String(), "aim_ids": planAimIDs(aims)})
+	return id, nil
+}
+
+const planTemplateColumns = "id, name, description, resources_required, recurrence, starts_at, duration_days, next_run_at, created_at"
+
+// GetAllPlanTemplates retrieves all plan templates, the next to run first
+func GetAllPlanTemplates() ([]PlanTemplate, error) {
+	return queryPlanTemplates("SELECT " + planTemplateColumns + " FROM plan_templates WHERE deleted_at IS NULL ORDER BY next_run_at IS NULL, next_run_at, name")
+}
+
+// GetPlanTemplate retrieves a plan template by ID
+func GetPlanTemplate(id int64) (PlanTemplate, error) {
+	templates, err := queryPlanTemplates("SELECT "+planTemplateColumns+" FROM plan_templates WHERE id = ? AND deleted_at IS NULL", id)
+	if err != nil {
+		return PlanTemplate{}, err
+	}
+	if len(templates) == 0 {
+		return PlanTemplate{}, sql.ErrNoRows
+	}
+	return templates[0], nil
+}
+
+// queryPlanTemplates runs a query selecting planTemplateColumns and loads
+// the aims of the templates
+func queryPlanTemplates(query string, args ...any) ([]PlanTemplate, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []PlanTemplate
+	for rows.Next() {
+		var t PlanTemplate
+		var nextRunAt sql.NullTime
+		err := rows.Scan(&t.ID, &t.Name, &t.Description, &t.ResourcesRequired, &t.Recurrence,
+			&t.StartsAt, &t.DurationDays, &nextRunAt, &t.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		// Occurrences follow the local calendar
+		t.StartsAt = t.StartsAt.Local()
+		t.NextRunAt = nextRunAt.Time
+		templates = append(templates, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range templates {
+		if templates[i].Aims, err = getPlanTemplateAims(templates[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+// getPlanTemplateAims retrieves the aims served by the plans of a template
+func getPlanTemplateAims(templateID int64) ([]PlanAim, error) {
+	rows, err := database.DB.Query(
+		`SELECT ta.aim_id, a.name, ta.weight
+		 FROM plan_template_aims ta
+		 JOIN aims a ON ta.aim_id = a.id
+		 WHERE ta.template_id = ? AND a.deleted_at IS NULL
+		 ORDER BY ta.weight DESC, a.name`,
+		templateID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var aims []PlanAim
+	for rows.Next() {
+		var aim PlanAim
+		if err := rows.Scan(&aim.AimID, &aim.AimName, &aim.Weight); err != nil {
+			return nil, err
+		}
+		aims = append(aims, aim)
+	}
+	return aims, rows.Err()
+}
+
+// GetTemplatePlans retrieves the plans instantiated from a template, the
+// most recent first
+func GetTemplatePlans(templateID int64) ([]Plan, error) {
+	return queryPlans(
+		"SELECT "+planColumns+" FROM plans WHERE template_id = ? AND deleted_at IS NULL ORDER BY template_occurrence DESC, id DESC",
+		templateID,
+	)
+}
+
+// InstantiatePlanTemplate creates the plan of a template for one of its
+// occurrences. Its due date is DurationDays after the occurrence.
+func InstantiatePlanTemplate(t PlanTemplate, occurrence time.Time) (int64, error) {
+	var dueDate time.Time
+	if t.DurationDays > 0 {
+		day := occurrence.Local()
+		dueDate = time.Date(day.Year(), day.Month(), day.Day()+t.DurationDays, 0, 0, 0, 0, time.Local)
+	}
+	name := t.Name + " (" + occurrence.Local().Format("Jan 02, 2006") + ")"
+	return createPlan(name, t.Description, t.ResourcesRequired, t.Aims, dueDate, t.ID, sqlTime(occurrence))
+}
+
+// InstantiateDuePlanTemplates creates the plans of the templates whose next
+// occurrence has come, and schedules their following one. When occurrences
+// were missed, e.g. while the server was stopped, only the latest one is
+// instantiated. It returns the number of plans created; a template that
+// fails does not prevent the others from running.
+func InstantiateDuePlanTemplates(now time.Time) (int, error) {
+	templates, err := queryPlanTemplates(
+		"SELECT "+planTemplateColumns+" FROM plan_templates WHERE next_run_at IS NOT NULL AND next_run_at <= ? AND deleted_at IS NULL",
+		sqlTime(now),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	created := 0
+	var errs []error
+	for _, t := range templates {
+		ok, err := runPlanTemplate(t, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("plan template %d: %w", t.ID, err))
+		}
+		if ok {
+			created++
+		}
+	}
+	return created, errors.Join(errs...)
+}
+
+// runPlanTemplate instantiates the latest due occurrence of a template,
+// unless it already was, and schedules the next one
+func runPlanTemplate(t PlanTemplate, now time.Time) (bool, error) {
+	rule, err := t.Rule()
+	if err != nil {
+		return false, err
+	}
+
+	occurrence := t.NextRunAt
+	for {
+		next, ok := rule.Next(t.StartsAt, occurrence)
+		if !ok || next.After(now) {
+			break
+		}
+		occurrence = next
+	}
+
+	var exists bool
+	err = database.DB.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM plans WHERE template_id = ? AND template_occurrence = ?)",
+		t.ID, sqlTime(occurrence),
+	).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		if _, err := InstantiatePlanTemplate(t, occurrence); err != nil {
+			return false, err
+		}
+	}
+
+	var nextRun any
+	if next, ok := rule.Next(t.StartsAt, occurrence); ok {
+		nextRun = sqlTime(next)
+	}
+	_, err = database.DB.Exec("UPDATE plan_templates SET next_run_at = ? WHERE id = ?", nextRun, t.ID)
+	return !exists, err
+}
+
+// DeletePlanTemplate moves a plan template to the trash by ID. No plan is
+// instantiated from it while it is there.
+func DeletePlanTemplate(id int64) error {
+	if err := trashRow("plan_templates", id); err != nil {
+		return fmt.Errorf("failed to delete plan template %d: %w", id, err)
+	}
+	events.Publish(events.PlanTemplateDeleted, map[string]any{"id": id})
+	return nil
+}
+
+// RestorePlanTemplate moves a plan template out of the trash by ID
+func RestorePlanTemplate(id int64) error {
+	if err := restoreRow("plan_templates", id); err != nil {
+		return fmt.Errorf("failed to restore plan template %d: %w", id, err)
+	}
+	events.Publish(events.PlanTemplateRestored, map[string]any{"id": id})
+	return nil
+}
+
+// PurgePlanTemplate permanently deletes a plan template in the trash and its
+// aims by ID. The plans instantiated from it are kept as standalone plans.
+func PurgePlanTemplate(id int64) error {
+	detachPlans := func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE plans SET template_id = NULL, template_occurrence = NULL WHERE template_id = ?", id)
+		return err
+	}
+	if err := purgeRowWith("plan_templates", id, detachPlans, "plan_template_aims.template_id"); err != nil {
+		return fmt.Errorf("failed to purge plan template %d: %w", id, err)
+	}
+	events.Publish(events.PlanTemplatePurged, map[string]any{"id": id})
+	return nil
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"pds/internal/database"
+)
+
+// PushSubscription is a browser subscribed to Web Push notifications
+type PushSubscription struct {
+	ID       int64
+	Endpoint string
+	P256dh   string
+	Auth     string
+}
+
+// SavePushSubscription stores the subscription of a browser, replacing its
+// keys if it was already subscribed
+func SavePushSubscription(endpoint, p256dh, auth string) error {
+	_, err := database.DB.Exec(
+		`INSERT INTO push_subscriptions (endpoint, p256dh, auth) VALUES (?, ?, ?)
+		 ON CONFLICT (endpoint) DO UPDATE SET p256dh = excluded.p256dh, auth = excluded.auth`,
+		endpoint, p256dh, auth,
+	)
+	return err
+}
+
+// GetAllPushSubscriptions retrieves the browsers subscribed to notifications
+func GetAllPushSubscriptions() ([]PushSubscription, error) {
+	rows, err := database.DB.Query("SELECT id, endpoint, p256dh, auth FROM push_subscriptions ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []PushSubscription
+	for rows.Next() {
+		var s PushSubscription
+		if err := rows.Scan(&s.ID, &s.Endpoint, &s.P256dh, &s.Auth); err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, s)
+	}
+	return subscriptions, rows.Err()
+}
+
+// DeletePushSubscription deletes the subscription of a browser
+func DeletePushSubscription(endpoint string) error {
+	_, err := database.DB.Exec("DELETE FROM push_subscriptions WHERE endpoint = ?", endpoint)
+	return err
+}
@@ -0,0 +1,256 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"pds/internal/database"
+)
+
+// Reminder kinds
+const (
+	ReminderDailyReview  = "daily_review"  // Write the journal of the day
+	ReminderHabits       = "habits"        // Check in the habits left to do today
+	ReminderOverduePlans = "overdue_plans" // Finish the plans past their due date
+	ReminderStatement    = "statement"     // Rehearse the statement of the day
+)
+
+// ReminderKinds lists the reminder kinds with their labels, in display order
+var ReminderKinds = []struct{ Kind, Label string }{
+	{ReminderDailyReview, "Daily review"},
+	{ReminderHabits, "Habit check-ins"},
+	{ReminderOverduePlans, "Overdue plans"},
+	{ReminderStatement, "Statement of the day"},
+}
+
+// Notification channels
+const (
+	ChannelEmail   = "email"
+	ChannelPush    = "push"
+	ChannelWebhook = "webhook"
+)
+
+// Delivery statuses
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+)
+
+// MaxDeliveryAttempts is the number of attempts after which a delivery is
+// given up
+const MaxDeliveryAttempts = 5
+
+// deliveryRetryDelays are the delays after which failed attempts are
+// retried, the last one repeating
+var deliveryRetryDelays = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour}
+
+// Reminder is a notification sent every day at a time of day
+type Reminder struct {
+	ID          int64
+	Kind        string
+	TimeOfDay   string // Local time, formatted as 15:04
+	Channel     string
+	LastFiredOn time.Time // Zero if the reminder was never sent
+	CreatedAt   time.Time
+}
+
+// KindLabel returns the label of the kind of the reminder
+func (r Reminder) KindLabel() string {
+	for _, kind := range ReminderKinds {
+		if kind.Kind == r.Kind {
+			return kind.Label
+		}
+	}
+	return r.Kind
+}
+
+// Delivery is an attempt, possibly repeated, to send a notification
+type Delivery struct {
+	ID            int64
+	ReminderID    int64 // Zero for notifications not sent by a reminder
+	Channel       string
+	Title         string
+	Body          string
+	URL           string
+	Status        string
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	SentAt        time.Time // Zero until sent
+	CreatedAt     time.Time
+}
+
+// CreateReminder inserts a new reminder. If its time of day has already
+// passed, it is first sent tomorrow.
+func CreateReminder(kind, timeOfDay, channel string, now time.Time) (int64, error) {
+	var lastFiredOn any
+	if now.Local().Format("15:04") >= timeOfDay {
+		lastFiredOn = sqlDate(now.Local())
+	}
+	result, err := database.DB.Exec(
+		"INSERT INTO reminders (kind, time_of_day, channel, last_fired_on) VALUES (?, ?, ?, ?)",
+		kind, timeOfDay, channel, lastFiredOn,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+const reminderColumns = "id, kind, time_of_day, channel, last_fired_on, created_at"
+
+// GetAllReminders retrieves all reminders by time of day
+func GetAllReminders() ([]Reminder, error) {
+	return queryReminders("SELECT " + reminderColumns + " FROM reminders WHERE deleted_at IS NULL ORDER BY time_of_day, id")
+}
+
+// GetDueReminders retrieves the reminders whose time of day has come today
+// and which were not sent yet today
+func GetDueReminders(now time.Time) ([]Reminder, error) {
+	now = now.Local()
+	return queryReminders(
+		"SELECT "+reminderColumns+" FROM reminders WHERE deleted_at IS NULL AND time_of_day <= ? AND (last_fired_on IS NULL OR last_fired_on < ?) ORDER BY time_of_day, id",
+		now.Format("15:04"), sqlDate(now),
+	)
+}
+
+// queryReminders runs a query selecting reminderColumns
+func queryReminders(query string, args ...any) ([]Reminder, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []Reminder
+	for rows.Next() {
+		var r Reminder
+		var lastFiredOn sql.NullTime
+		if err := rows.Scan(&r.ID, &r.Kind, &r.TimeOfDay, &r.Channel, &lastFiredOn, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.LastFiredOn = lastFiredOn.Time
+		reminders = append(reminders, r)
+	}
+	return reminders, rows.Err()
+}
+
+// MarkReminderFired records that a reminder was sent on a day
+func MarkReminderFired(id int64, day time.Time) error {
+	_, err := database.DB.Exec("UPDATE reminders SET last_fired_on = ? WHERE id = ?", sqlDate(day), id)
+	return err
+}
+
+// DeleteReminder moves a reminder to the trash by ID. It is not sent while
+// it is there.
+func DeleteReminder(id int64) error {
+	if err := trashRow("reminders", id); err != nil {
+		return fmt.Errorf("failed to delete reminder %d: %w", id, err)
+	}
+	return nil
+}
+
+// RestoreReminder moves a reminder out of the trash by ID
+func RestoreReminder(id int64) error {
+	if err := restoreRow("reminders", id); err != nil {
+		return fmt.Errorf("failed to restore reminder %d: %w", id, err)
+	}
+	return nil
+}
+
+// PurgeReminder permanently deletes a reminder in the trash by ID. Its past
+// deliveries are kept.
+func PurgeReminder(id int64) error {
+	detachDeliveries := func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE notification_deliveries SET reminder_id = NULL WHERE reminder_id = ?", id)
+		return err
+	}
+	if err := purgeRowWith("reminders", id, detachDeliveries); err != nil {
+		return fmt.Errorf("failed to purge reminder %d: %w", id, err)
+	}
+	return nil
+}
+
+// EnqueueDelivery queues a notification to be sent through a channel as
+// soon as possible. reminderID is zero for notifications not sent by a
+// reminder.
+func EnqueueDelivery(reminderID int64, channel, title, body, url string) (int64, error) {
+	var reminder any
+	if reminderID != 0 {
+		reminder = reminderID
+	}
+	result, err := database.DB.Exec(
+		"INSERT INTO notification_deliveries (reminder_id, channel, title, body, url) VALUES (?, ?, ?, ?, ?)",
+		reminder, channel, title, body, url,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+const deliveryColumns = "id, COALESCE(reminder_id, 0), channel, title, body, url, status, attempts, last_error, next_attempt_at, sent_at, created_at"
+
+// GetPendingDeliveries retrieves the deliveries to attempt at the given time
+func GetPendingDeliveries(now time.Time) ([]Delivery, error) {
+	return queryDeliveries(
+		"SELECT "+deliveryColumns+" FROM notification_deliveries WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, id",
+		DeliveryPending, sqlTime(now),
+	)
+}
+
+// GetRecentDeliveries retrieves the latest deliveries, the most recent first
+func GetRecentDeliveries(limit int) ([]Delivery, error) {
+	return queryDeliveries("SELECT "+deliveryColumns+" FROM notification_deliveries ORDER BY created_at DESC, id DESC LIMIT ?", limit)
+}
+
+// queryDeliveries runs a query selecting deliveryColumns
+func queryDeliveries(query string, args ...any) ([]Delivery, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []Delivery
+	for rows.Next() {
+		var d Delivery
+		var nextAttemptAt, sentAt sql.NullTime
+		err := rows.Scan(&d.ID, &d.ReminderID, &d.Channel, &d.Title, &d.Body, &d.URL, &d.Status,
+			&d.Attempts, &d.LastError, &nextAttemptAt, &sentAt, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		d.NextAttemptAt = nextAttemptAt.Time
+		d.SentAt = sentAt.Time
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RecordDeliveryAttempt records the outcome of an attempt to send a
+// notification. Failed attempts are retried after increasing delays until
+// MaxDeliveryAttempts is reached.
+func RecordDeliveryAttempt(d Delivery, sendErr error, now time.Time) error {
+	attempts := d.Attempts + 1
+	if sendErr == nil {
+		_, err := database.DB.Exec(
+			"UPDATE notification_deliveries SET status = ?, attempts = ?, last_error = '', sent_at = ? WHERE id = ?",
+			DeliverySent, attempts, sqlTime(now), d.ID,
+		)
+		return err
+	}
+
+	status := DeliveryPending
+	if attempts >= MaxDeliveryAttempts {
+		status = DeliveryFailed
+	}
+	delay := deliveryRetryDelays[min(attempts, len(deliveryRetryDelays))-1]
+	_, err := database.DB.Exec(
+		"UPDATE notification_deliveries SET status = ?, attempts = ?, last_error = ?, next_attempt_at = ? WHERE id = ?",
+		status, attempts, sendErr.Error(), sqlTime(now.Add(delay)), d.ID,
+	)
+	return err
+}
@@ -0,0 +1,238 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"pds/internal/database"
+	"pds/internal/events"
+)
+
+// Report periods
+const (
+	ReportWeek  = "week"
+	ReportMonth = "month"
+)
+
+// AimAttention measures how much attention an aim received during a period
+type AimAttention struct {
+	AimID        int64
+	AimName      string
+	PlanActivity int // Plans serving the aim that were started or finished
+	Occurrences  int // Occurrences of behaviours conflicting with the aim
+}
+
+// Total is the overall amount of attention the aim received
+func (a AimAttention) Total() int {
+	return a.PlanActivity + a.Occurrences
+}
+
+// Report summarises what happened during a week or a month
+type Report struct {
+	Period               string
+	Start                time.Time // Inclusive
+	End                  time.Time // Exclusive
+	JournalCounts        []JournalTypeCount
+	TotalJournals        int
+	BehaviourOccurrences []AimOccurrences
+	PlansStarted         []Plan
+	PlansFinished        []Plan
+	PlansOverdue         []Plan
+	MostAttention        []AimAttention
+	LeastAttention       []AimAttention
+	Moods                []MoodPoint
+	MoodAverage          float64 // Zero if no mood was recorded
+	PreviousMoodAverage  float64 // Average over the previous period, zero if unknown
+	Reflection           string
+}
+
+// MoodTrend is the change of the average mood compared to the previous period
+func (r Report) MoodTrend() float64 {
+	if r.MoodAverage == 0 || r.PreviousMoodAverage == 0 {
+		return 0
+	}
+	return r.MoodAverage - r.PreviousMoodAverage
+}
+
+// Previous returns the start of the previous period
+func (r Report) Previous() time.Time {
+	if r.Period == ReportMonth {
+		return r.Start.AddDate(0, -1, 0)
+	}
+	return r.Start.AddDate(0, 0, -7)
+}
+
+// Next returns the start of the next period
+func (r Report) Next() time.Time {
+	return r.End
+}
+
+// ReportRange returns the bounds of the week (starting on Monday) or month containing date
+func ReportRange(period string, date time.Time) (time.Time, time.Time, error) {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+	switch period {
+	case ReportWeek:
+		offset := (int(day.Weekday()) + 6) % 7
+		start := day.AddDate(0, 0, -offset)
+		return start, start.AddDate(0, 0, 7), nil
+	case ReportMonth:
+		start := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.Local)
+		return start, start.AddDate(0, 1, 0), nil
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf("unknown report period %q", period)
+	}
+}
+
+// attentionReportSize is the number of aims listed as most and least attended
+const attentionReportSize = 3
+
+// BuildReport computes the report of the period containing date
+func BuildReport(period string, date time.Time) (Report, error) {
+	start, end, err := ReportRange(period, date)
+	if err != nil {
+		return Report{}, err
+	}
+	report := Report{Period: period, Start: start, End: end}
+
+	if report.JournalCounts, err = CountJournalsByType(start, end); err != nil {
+		return report, fmt.Errorf("failed to count journals: %w", err)
+	}
+	for _, count := range report.JournalCounts {
+		report.TotalJournals += count.Count
+	}
+
+	if report.BehaviourOccurrences, err = GetOccurrencesByAim(start, end); err != nil {
+		return report, fmt.Errorf("failed to count behaviour occurrences: %w", err)
+	}
+
+	if report.PlansStarted, err = GetPlansStartedBetween(start, end); err != nil {
+		return report, fmt.Errorf("failed to retrieve started plans: %w", err)
+	}
+	if report.PlansFinished, err = GetPlansCompletedBetween(start, end); err != nil {
+		return report, fmt.Errorf("failed to retrieve finished plans: %w", err)
+	}
+	if report.PlansOverdue, err = GetPlansOverdueAt(minTime(end, time.Now())); err != nil {
+		return report, fmt.Errorf("failed to retrieve overdue plans: %w", err)
+	}
+
+	attention, err := getAimAttention(start, end)
+	if err != nil {
+		return report, fmt.Errorf("failed to compute aim attention: %w", err)
+	}
+	report.MostAttention, report.LeastAttention = splitAttention(attention)
+
+	if report.Moods, err = GetDailyMoods(start, end); err != nil {
+		return report, fmt.Errorf("failed to retrieve moods: %w", err)
+	}
+	if report.MoodAverage, err = averageMood(start, end); err != nil {
+		return report, fmt.Errorf("failed to compute mood average: %w", err)
+	}
+	if report.PreviousMoodAverage, err = averageMood(report.Previous(), start); err != nil {
+		return report, fmt.Errorf("failed to compute previous mood average: %w", err)
+	}
+
+	if report.Reflection, err = GetReportReflection(period, start); err != nil {
+		return report, fmt.Errorf("failed to retrieve reflection: %w", err)
+	}
+
+	return report, nil
+}
+
+// getAimAttention measures the attention every aim received in [start, end)
+func getAimAttention(start, end time.Time) ([]AimAttention, error) {
+	query := `
+		SELECT a.id, a.name,
+			(SELECT COUNT(*) FROM plans p
+			 JOIN plan_aims pa ON pa.plan_id = p.id
+			 WHERE pa.aim_id = a.id AND p.deleted_at IS NULL
+			 AND ((p.started_at >= ?1 AND p.started_at < ?2) OR (p.completed_at >= ?1 AND p.completed_at < ?2))),
+			(SELECT COUNT(*) FROM behaviour_occurrences o
+			 JOIN behaviours b ON o.behaviour_id = b.id AND b.deleted_at IS NULL
+			 WHERE b.conflicting_aim_id = a.id AND o.occurred_at >= ?1 AND o.occurred_at < ?2)
+		FROM aims a
+		WHERE a.deleted_at IS NULL
+	`
+	rows, err := database.DB.Query(query, sqlTime(start), sqlTime(end))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attention []AimAttention
+	for rows.Next() {
+		var a AimAttention
+		if err := rows.Scan(&a.AimID, &a.AimName, &a.PlanActivity, &a.Occurrences); err != nil {
+			return nil, err
+		}
+		attention = append(attention, a)
+	}
+	return attention, rows.Err()
+}
+
+// splitAttention returns the most and least attended aims, without listing
+// an aim in both when there are only a few of them
+func splitAttention(attention []AimAttention) ([]AimAttention, []AimAttention) {
+	sort.SliceStable(attention, func(i, j int) bool {
+		return attention[i].Total() > attention[j].Total()
+	})
+
+	var most []AimAttention
+	for _, a := range attention {
+		if len(most) == attentionReportSize || a.Total() == 0 {
+			break
+		}
+		most = append(most, a)
+	}
+
+	var least []AimAttention
+	for i := len(attention) - 1; i >= len(most) && len(least) < attentionReportSize; i-- {
+		least = append(least, attention[i])
+	}
+	return most, least
+}
+
+// averageMood computes the average mood in [start, end), zero if there is none
+func averageMood(start, end time.Time) (float64, error) {
+	var average sql.NullFloat64
+	err := database.DB.QueryRow(
+		"SELECT AVG(score) FROM moods WHERE created_at >= ? AND created_at < ?",
+		sqlTime(start), sqlTime(end),
+	).Scan(&average)
+	return average.Float64, err
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// GetReportReflection retrieves the reflection written about a report, if any
+func GetReportReflection(period string, start time.Time) (string, error) {
+	var content string
+	err := database.DB.QueryRow(
+		"SELECT content FROM report_reflections WHERE period = ? AND start_date = ?",
+		period, sqlDate(start),
+	).Scan(&content)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return content, err
+}
+
+// SaveReportReflection creates or replaces the reflection written about a report
+func SaveReportReflection(period string, start time.Time, content string) error {
+	_, err := database.DB.Exec(
+		`INSERT INTO report_reflections (period, start_date, content) VALUES (?, ?, ?)
+		 ON CONFLICT (period, start_date) DO UPDATE SET content = excluded.content, updated_at = CURRENT_TIMESTAMP`,
+		period, sqlDate(start), content,
+	)
+	if err != nil {
+		return err
+	}
+	events.Publish(events.ReflectionSaved, map[string]any{"period": period, "start_date": sqlDate(start)})
+	return nil
+}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+
+	"pds/internal/database"
+)
+
+// calendarFeedTokenKey is the setting holding the token of the calendar feed
+const calendarFeedTokenKey = "calendar_feed_token"
+
+// GetSetting retrieves the value of a setting, or "" if it is not set
+func GetSetting(key string) (string, error) {
+	var value string
+	err := database.DB.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return value, err
+}
+
+// SetSetting sets the value of a setting
+func SetSetting(key, value string) error {
+	_, err := database.DB.Exec(
+		"INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value",
+		key, value,
+	)
+	return err
+}
+
+// CalendarFeedToken returns the secret token giving access to the calendar
+// feed, generating it on first use. Concurrent first uses get the same token.
+func CalendarFeedToken() (string, error) {
+	token, err := GetSetting(calendarFeedTokenKey)
+	if err != nil || token != "" {
+		return token, err
+	}
+	if token, err = randomToken(); err != nil {
+		return "", err
+	}
+	_, err = database.DB.Exec(
+		"INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT (key) DO NOTHING",
+		calendarFeedTokenKey, token,
+	)
+	if err != nil {
+		return "", err
+	}
+	return GetSetting(calendarFeedTokenKey)
+}
+
+// RegenerateCalendarFeedToken replaces the token of the calendar feed, so
+// that the previous feed URL stops working
+func RegenerateCalendarFeedToken() (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	return token, SetSetting(calendarFeedTokenKey, token)
+}
+
+// randomToken returns a random secret, hex encoded
+func randomToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NotificationSettings configure the channels notifications are sent through
+type NotificationSettings struct {
+	AppURL       string // Base URL of the app, for the links of notifications
+	SMTPAddr     string // Host and port of the SMTP server
+	SMTPUsername string
+	SMTPPassword string
+	EmailFrom    string
+	EmailTo      string
+	WebhookURL   string
+}
+
+// fields maps the setting keys to the fields of the
+// notification settings
+func (s *NotificationSettings) fields() map[string]*string {
+	return map[string]*string{
+		"app_url":       &s.AppURL,
+		"smtp_addr":     &s.SMTPAddr,
+		"smtp_username": &s.SMTPUsername,
+		"smtp_password": &s.SMTPPassword,
+		"email_from":    &s.EmailFrom,
+		"email_to":      &s.EmailTo,
+		"webhook_url":   &s.WebhookURL,
+	}
+}
+
+// GetNotificationSettings retrieves the settings of the notification channels
+func GetNotificationSettings() (NotificationSettings, error) {
+	var settings NotificationSettings
+	err := getSettings(settings.fields())
+	return settings, err
+}
+
+// SaveNotificationSettings stores the settings of the notification channels
+func SaveNotificationSettings(settings NotificationSettings) error {
+	return saveSettings(settings.fields())
+}
+
+// EmailSettings configure the journal entries created from emails
+type EmailSettings struct {
+	Maildir        string // Maildir the emails are delivered to, empty to turn ingestion off
+	AllowedSenders string // Addresses whose emails are accepted, separated by commas or spaces
+	DefaultType    string // Type of the entries sent to an address without a +type suffix
+}
+
+// fields maps the setting keys to the fields of the email settings
+func (s *EmailSettings) fields() map[string]*string {
+	return map[string]*string{
+		"email_maildir":         &s.Maildir,
+		"email_allowed_senders": &s.AllowedSenders,
+		"email_default_type":    &s.DefaultType,
+	}
+}
+
+// GetEmailSettings retrieves the settings of the email ingestion
+func GetEmailSettings() (EmailSettings, error) {
+	var settings EmailSettings
+	err := getSettings(settings.fields())
+	return settings, err
+}
+
+// SaveEmailSettings stores the settings of the email ingestion
+func SaveEmailSettings(settings EmailSettings) error {
+	return saveSettings(settings.fields())
+}
+
+// getSettings reads settings into the fields their keys map to
+func getSettings(fields map[string]*string) error {
+	for key, field := range fields {
+		value, err := GetSetting(key)
+		if err != nil {
+			return err
+		}
+		*field = value
+	}
+	return nil
+}
+
+// saveSettings stores the fields of settings under their keys at once
+func saveSettings(fields map[string]*string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for key, field := range fields {
+		_, err := tx.Exec(
+			"INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value",
+			key, *field,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
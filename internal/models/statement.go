@@ -1,7 +1,15 @@
 package models
 
 import (
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"time"
+
 	"pds/internal/database"
+	"pds/internal/events"
 )
 
 // Statement represents a statement in the system
@@ -9,6 +17,71 @@ type Statement struct {
 	ID       int64
 	Content  string
 	Priority int
+
+	// Spaced repetition state
+	Ease         float64
+	IntervalDays int
+	Repetitions  int
+	DueAt        time.Time // Zero if the statement was never rehearsed
+}
+
+// IsDue reports whether the statement should be rehearsed
+func (s Statement) IsDue(now time.Time) bool {
+	return s.DueAt.IsZero() || !s.DueAt.After(now)
+}
+
+// Rehearsal records how strongly a statement resonated when rehearsed
+type Rehearsal struct {
+	ID          int64
+	StatementID int64
+	Resonance   int
+	RehearsedAt time.Time
+}
+
+// Resonance bounds: below minRecalledResonance the schedule starts over
+const (
+	MinResonance         = 0
+	MaxResonance         = 5
+	minRecalledResonance = 3
+	minEase              = 1.3
+)
+
+const statementColumns = "id, content, priority, ease, interval_days, repetitions, due_at"
+
+// scanStatement reads a statement selected with statementColumns
+func scanStatement(row rowScanner) (Statement, error) {
+	var statement Statement
+	var dueAt sql.NullTime
+	err := row.Scan(
+		&statement.ID,
+		&statement.Content,
+		&statement.Priority,
+		&statement.Ease,
+		&statement.IntervalDays,
+		&statement.Repetitions,
+		&dueAt,
+	)
+	statement.DueAt = dueAt.Time
+	return statement, err
+}
+
+// queryStatements runs a query selecting statementColumns and collects the results
+func queryStatements(query string, args ...any) ([]Statement, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statements []Statement
+	for rows.Next() {
+		statement, err := scanStatement(rows)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, statement)
+	}
+	return statements, rows.Err()
 }
 
 // CreateStatement inserts a new statement into the database
@@ -18,32 +91,212 @@ func CreateStatement(content string, priority int) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	events.Publish(events.StatementCreated, map[string]any{"id": id, "content": content, "priority": priority})
+	return id, nil
 }
 
-// GetAllStatements retrieves all statements from the database
+// GetStatement retrieves a statement by ID
+func GetStatement(id int64) (Statement, error) {
+	query := "SELECT " + statementColumns + " FROM statements WHERE id = ? AND deleted_at IS NULL"
+	return scanStatement(database.DB.QueryRow(query, id))
+}
+
+// GetAllStatements retrieves all statements from the database, the highest priority first
 func GetAllStatements() ([]Statement, error) {
-	query := "SELECT id, content, priority FROM statements"
-	rows, err := database.DB.Query(query)
+	query := "SELECT " + statementColumns + " FROM statements WHERE deleted_at IS NULL ORDER BY priority DESC, id"
+	return queryStatements(query)
+}
+
+// GetTopStatements retrieves the statements with the highest priority
+func GetTopStatements(limit int) ([]Statement, error) {
+	query := "SELECT " + statementColumns + " FROM statements WHERE deleted_at IS NULL ORDER BY priority DESC, id LIMIT ?"
+	return queryStatements(query, limit)
+}
+
+// DeleteStatement moves a statement to the trash by ID
+func DeleteStatement(id int64) error {
+	if err := trashRow("statements", id); err != nil {
+		return fmt.Errorf("failed to delete statement %d: %w", id, err)
+	}
+	events.Publish(events.StatementDeleted, map[string]any{"id": id})
+	return nil
+}
+
+// RestoreStatement moves a statement out of the trash by ID
+func RestoreStatement(id int64) error {
+	if err := restoreRow("statements", id); err != nil {
+		return fmt.Errorf("failed to restore statement %d: %w", id, err)
+	}
+	events.Publish(events.StatementRestored, map[string]any{"id": id})
+	return nil
+}
+
+// PurgeStatement permanently deletes a statement in the trash, with its
+// rehearsals and links, by ID. The intentions following it are kept.
+func PurgeStatement(id int64) error {
+	detachIntentions := func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE intentions SET statement_id = NULL WHERE statement_id = ?", id)
+		return err
+	}
+	err := purgeRowWith("statements", id, detachIntentions, "statement_rehearsals.statement_id",
+		"statement_aims.statement_id", "statement_behaviours.statement_id")
+	if err != nil {
+		return fmt.Errorf("failed to purge statement %d: %w", id, err)
+	}
+	events.Publish(events.StatementPurged, map[string]any{"id": id})
+	return nil
+}
+
+// NextStatementToRehearse picks the next statement to rehearse among the due
+// ones, favouring high priorities. When none is due, any statement can be
+// picked so that the user can keep rehearsing. It returns sql.ErrNoRows if
+// there is no statement at all.
+func NextStatementToRehearse(now time.Time) (Statement, error) {
+	statements, err := GetAllStatements()
+	if err != nil {
+		return Statement{}, err
+	}
+	if len(statements) == 0 {
+		return Statement{}, sql.ErrNoRows
+	}
+
+	var due []Statement
+	for _, statement := range statements {
+		if statement.IsDue(now) {
+			due = append(due, statement)
+		}
+	}
+	if len(due) == 0 {
+		due = statements
+	}
+
+	return pickByPriority(due, rand.New(rand.NewSource(now.UnixNano()))), nil
+}
+
+// GetStatementOfTheDay picks a statement for the given day, favouring high
+// priorities. The pick is stable for the whole day. It returns sql.ErrNoRows
+// if there is no statement at all.
+func GetStatementOfTheDay(day time.Time) (Statement, error) {
+	statements, err := GetAllStatements()
+	if err != nil {
+		return Statement{}, err
+	}
+	if len(statements) == 0 {
+		return Statement{}, sql.ErrNoRows
+	}
+
+	seed := fnv.New64a()
+	seed.Write([]byte(day.Format(sqlDateFormat)))
+	return pickByPriority(statements, rand.New(rand.NewSource(int64(seed.Sum64())))), nil
+}
+
+// pickByPriority picks a statement at random, with a probability proportional
+// to its priority plus one so that priority 0 statements still come up
+func pickByPriority(statements []Statement, rng *rand.Rand) Statement {
+	total := 0
+	for _, statement := range statements {
+		total += pickWeight(statement)
+	}
+
+	n := rng.Intn(total)
+	for _, statement := range statements {
+		n -= pickWeight(statement)
+		if n < 0 {
+			return statement
+		}
+	}
+	return statements[len(statements)-1]
+}
+
+// pickWeight returns the weight of a statement in pickByPriority, at least
+// one since statements saved before priorities were validated may have a
+// negative one
+func pickWeight(statement Statement) int {
+	return max(statement.Priority+1, 1)
+}
+
+// RehearseStatement logs a rehearsal and schedules the next one with the
+// SM-2 algorithm, using the resonance as the quality of the response
+func RehearseStatement(id int64, resonance int, now time.Time) (Statement, error) {
+	statement, err := GetStatement(id)
+	if err != nil {
+		return statement, err
+	}
+
+	statement = scheduleStatement(statement, resonance, now)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return statement, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"INSERT INTO statement_rehearsals (statement_id, resonance, rehearsed_at) VALUES (?, ?, ?)",
+		id, resonance, sqlTime(now),
+	)
+	if err != nil {
+		return statement, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE statements SET ease = ?, interval_days = ?, repetitions = ?, due_at = ? WHERE id = ?",
+		statement.Ease, statement.IntervalDays, statement.Repetitions, sqlTime(statement.DueAt), id,
+	)
+	if err != nil {
+		return statement, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return statement, err
+	}
+	events.Publish(events.StatementRehearsed, map[string]any{"id": id, "resonance": resonance, "due_at": statement.DueAt.UTC()})
+	return statement, nil
+}
+
+// scheduleStatement computes the next rehearsal of a statement
+func scheduleStatement(statement Statement, resonance int, now time.Time) Statement {
+	if resonance < minRecalledResonance {
+		statement.Repetitions = 0
+		statement.IntervalDays = 1
+	} else {
+		switch statement.Repetitions {
+		case 0:
+			statement.IntervalDays = 1
+		case 1:
+			statement.IntervalDays = 6
+		default:
+			statement.IntervalDays = int(math.Round(float64(statement.IntervalDays) * statement.Ease))
+		}
+		statement.Repetitions++
+	}
+
+	q := float64(MaxResonance - resonance)
+	statement.Ease = math.Max(minEase, statement.Ease+0.1-q*(0.08+q*0.02))
+	statement.DueAt = now.AddDate(0, 0, statement.IntervalDays)
+	return statement
+}
+
+// GetRehearsals retrieves the rehearsals of a statement, the most recent first
+func GetRehearsals(statementID int64) ([]Rehearsal, error) {
+	query := "SELECT id, statement_id, resonance, rehearsed_at FROM statement_rehearsals WHERE statement_id = ? ORDER BY rehearsed_at DESC, id DESC"
+	rows, err := database.DB.Query(query, statementID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var statements []Statement
+	var rehearsals []Rehearsal
 	for rows.Next() {
-		var statement Statement
-		if err := rows.Scan(&statement.ID, &statement.Content, &statement.Priority); err != nil {
+		var rehearsal Rehearsal
+		if err := rows.Scan(&rehearsal.ID, &rehearsal.StatementID, &rehearsal.Resonance, &rehearsal.RehearsedAt); err != nil {
 			return nil, err
 		}
-		statements = append(statements, statement)
+		rehearsals = append(rehearsals, rehearsal)
 	}
-	return statements, nil
-}
-
-// DeleteStatement deletes a statement by ID
-func DeleteStatement(id int64) error {
-	query := "DELETE FROM statements WHERE id = ?"
-	_, err := database.DB.Exec(query, id)
-	return err
+	return rehearsals, rows.Err()
 }
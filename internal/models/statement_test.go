@@ -0,0 +1,19 @@
+package models
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestPickByPriorityNegative(t *testing.T) {
+	// Statements saved before priorities were validated may have negative ones
+	statements := []Statement{{ID: 1, Priority: -3}, {ID: 2, Priority: -1}}
+	rng := rand.New(rand.NewSource(1))
+	picked := map[int64]bool{}
+	for range 20 {
+		picked[pickByPriority(statements, rng).ID] = true
+	}
+	if !picked[1] || !picked[2] {
+		t.Errorf("picked %v, want both statements", picked)
+	}
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// sqlTimeFormat matches the format SQLite uses for CURRENT_TIMESTAMP, so that
+// bound parameters compare correctly with the stored values
+const sqlTimeFormat = "2006-01-02 15:04:05"
+
+// sqlDateFormat is the format used for DATE columns
+const sqlDateFormat = "2006-01-02"
+
+// sqlTime formats a time for comparison with a DATETIME column
+func sqlTime(t time.Time) string {
+	return t.UTC().Format(sqlTimeFormat)
+}
+
+// sqlDate formats a time for comparison with a DATE column
+func sqlDate(t time.Time) string {
+	return t.Format(sqlDateFormat)
+}
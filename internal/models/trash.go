@@ -0,0 +1,286 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"pds/internal/database"
+)
+
+// Types of the items that can be in the trash
+const (
+	TrashJournal      = "journal"
+	TrashPlan         = "plan"
+	TrashValue        = "value"
+	TrashStatement    = "statement"
+	TrashBehaviour    = "behaviour"
+	TrashIntention    = "intention"
+	TrashHabit        = "habit"
+	TrashPlanTemplate = "plan_template"
+	TrashMilestone    = "milestone"
+	TrashReminder     = "reminder"
+	TrashWebhook      = "webhook"
+)
+
+// TrashTypes lists the types of the items that can be in the trash
+var TrashTypes = []string{
+	TrashJournal, TrashPlan, TrashValue, TrashStatement, TrashBehaviour, TrashIntention,
+	TrashHabit, TrashPlanTemplate, TrashMilestone, TrashReminder, TrashWebhook,
+}
+
+// DefaultTrashRetentionDays is the number of days deleted items stay in the
+// trash until the retention is configured
+const DefaultTrashRetentionDays = 30
+
+// trashRetentionKey is the setting holding the number of days deleted items
+// stay in the trash
+const trashRetentionKey = "trash_retention_days"
+
+// TrashItem is a deleted item, which can be restored until it is purged
+type TrashItem struct {
+	Type      string // One of TrashTypes
+	ID        int64
+	Label     string // Title, name or content of the item
+	DeletedAt time.Time
+}
+
+// GetTrash retrieves the deleted items, the most recently deleted first
+func GetTrash() ([]TrashItem, error) {
+	rows, err := database.DB.Query(`
+		SELECT 'journal', id, title, deleted_at FROM journals WHERE deleted_at IS NOT NULL
+		UNION ALL
+		SELECT 'plan', id, name, deleted_at FROM plans WHERE deleted_at IS NOT NULL
+		UNION ALL
+		SELECT 'value', id, name, deleted_at FROM aims WHERE deleted_at IS NOT NULL
+		UNION ALL
+		SELECT 'statement', id, content, deleted_at FROM statements WHERE deleted_at IS NOT NULL
+		UNION ALL
+		SELECT 'behaviour', id, name, deleted_at FROM behaviours WHERE deleted_at IS NOT NULL
+		UNION ALL
+		SELECT 'intention', id, 'When ' || cue || ', I will ' || response, deleted_at FROM intentions WHERE deleted_at IS NOT NULL
+		UNION ALL
+		SELECT 'habit', id, name, deleted_at FROM habits WHERE deleted_at IS NOT NULL
+		UNION ALL
+		SELECT 'plan_template', id, name, deleted_at FROM plan_templates WHERE deleted_at IS NOT NULL
+		UNION ALL
+		SELECT 'milestone', id, name, deleted_at FROM plan_milestones WHERE deleted_at IS NOT NULL
+		UNION ALL
+		SELECT 'reminder', id, kind || ' ' || time_of_day, deleted_at FROM reminders WHERE deleted_at IS NOT NULL
+		UNION ALL
+		SELECT 'webhook', id, url, deleted_at FROM webhooks WHERE deleted_at IS NOT NULL
+		ORDER BY 4 DESC, 2 DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []TrashItem
+	for rows.Next() {
+		var item TrashItem
+		var deletedAt string
+		if err := rows.Scan(&item.Type, &item.ID, &item.Label, &deletedAt); err != nil {
+			return nil, err
+		}
+		// The deletion times of a union have no declared type, so they are
+		// not parsed by the driver
+		if item.DeletedAt, err = parseSQLTime(deletedAt); err != nil {
+			return nil, err
+		}
+		// Reminders are labelled by the identifier of their kind
+		if item.Type == TrashReminder {
+			kind, timeOfDay, _ := strings.Cut(item.Label, " ")
+			item.Label = Reminder{Kind: kind}.KindLabel() + " at " + timeOfDay
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// parseSQLTime parses a UTC time stored by SQLite
+func parseSQLTime(s string) (time.Time, error) {
+	for _, layout := range []string{sqlTimeFormat, time.RFC3339Nano} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// RestoreTrashItem moves an item out of the trash
+func RestoreTrashItem(itemType string, id int64) error {
+	switch itemType {
+	case TrashJournal:
+		return RestoreJournal(id)
+	case TrashPlan:
+		return RestorePlan(id)
+	case TrashValue:
+		return RestoreValue(id)
+	case TrashStatement:
+		return RestoreStatement(id)
+	case TrashBehaviour:
+		return RestoreBehaviour(id)
+	case TrashIntention:
+		return RestoreIntention(id)
+	case TrashHabit:
+		return RestoreHabit(id)
+	case TrashPlanTemplate:
+		return RestorePlanTemplate(id)
+	case TrashMilestone:
+		return RestoreMilestone(id)
+	case TrashReminder:
+		return RestoreReminder(id)
+	case TrashWebhook:
+		return RestoreWebhook(id)
+	}
+	return fmt.Errorf("unknown trash item type %q", itemType)
+}
+
+// PurgeTrashItem permanently deletes an item in the trash
+func PurgeTrashItem(itemType string, id int64) error {
+	switch itemType {
+	case TrashJournal:
+		return PurgeJournal(id)
+	case TrashPlan:
+		return PurgePlan(id)
+	case TrashValue:
+		return PurgeValue(id)
+	case TrashStatement:
+		return PurgeStatement(id)
+	case TrashBehaviour:
+		return PurgeBehaviour(id)
+	case TrashIntention:
+		return PurgeIntention(id)
+	case TrashHabit:
+		return PurgeHabit(id)
+	case TrashPlanTemplate:
+		return PurgePlanTemplate(id)
+	case TrashMilestone:
+		return PurgeMilestone(id)
+	case TrashReminder:
+		return PurgeReminder(id)
+	case TrashWebhook:
+		return PurgeWebhook(id)
+	}
+	return fmt.Errorf("unknown trash item type %q", itemType)
+}
+
+// PurgeTrash permanently deletes the items deleted before the given time,
+// and returns how many there were
+func PurgeTrash(before time.Time) (int, error) {
+	items, err := GetTrash()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, item := range items {
+		if !item.DeletedAt.Before(before) {
+			continue
+		}
+		// Items are purged with their parent, e.g. a milestone with its
+		// plan, which may come first
+		err := PurgeTrashItem(item.Type, item.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// GetTrashRetentionDays returns the number of days deleted items stay in the
+// trash before they are purged
+func GetTrashRetentionDays() (int, error) {
+	value, err := GetSetting(trashRetentionKey)
+	if err != nil || value == "" {
+		return DefaultTrashRetentionDays, err
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil {
+		return DefaultTrashRetentionDays, fmt.Errorf("invalid trash retention %q: %w", value, err)
+	}
+	return days, nil
+}
+
+// SetTrashRetentionDays sets the number of days deleted items stay in the
+// trash before they are purged
+func SetTrashRetentionDays(days int) error {
+	return SetSetting(trashRetentionKey, strconv.Itoa(days))
+}
+
+// trashRow moves a row of a table to the trash, failing with sql.ErrNoRows
+// if there is no such row outside of the trash
+func trashRow(table string, id int64) error {
+	return execAffectingRow(
+		"UPDATE "+table+" SET deleted_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL", id)
+}
+
+// restoreRow moves a row of a table out of the trash, failing with
+// sql.ErrNoRows if there is no such row in the trash
+func restoreRow(table string, id int64) error {
+	return execAffectingRow("UPDATE "+table+" SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL", id)
+}
+
+// purgeRow permanently deletes a row of a table in the trash within a
+// transaction, along with the rows referencing it, given as "table.column".
+// It fails with sql.ErrNoRows if there is no such row in the trash.
+func purgeRow(table string, id int64, references ...string) error {
+	return purgeRowWith(table, id, nil, references...)
+}
+
+// purgeRowWith is purgeRow running detach within the same transaction before
+// the referencing rows are deleted, e.g. to delete the rows referencing them
+// in turn, or to keep rows that must outlive the purged one
+func purgeRowWith(table string, id int64, detach func(tx *sql.Tx) error, references ...string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM "+table+" WHERE id = ? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	if detach != nil {
+		if err := detach(tx); err != nil {
+			return err
+		}
+	}
+	for _, reference := range references {
+		refTable, column, _ := strings.Cut(reference, ".")
+		if _, err := tx.Exec("DELETE FROM "+refTable+" WHERE "+column+" = ?", id); err != nil {
+			return fmt.Errorf("failed to delete from %s: %w", refTable, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// execAffectingRow runs a statement that must affect a row, failing with
+// sql.ErrNoRows otherwise
+func execAffectingRow(query string, args ...any) error {
+	result, err := database.DB.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"pds/internal/database"
+)
+
+// Webhook is a URL receiving some types of domain events
+type Webhook struct {
+	ID         int64
+	URL        string
+	Secret     string // Key of the HMAC signature of the deliveries
+	EventTypes []string
+	CreatedAt  time.Time
+}
+
+// WebhookDelivery is the delivery, possibly retried, of an event to a webhook
+type WebhookDelivery struct {
+	ID             int64
+	WebhookID      int64
+	WebhookURL     string // For display purposes
+	EventID        string
+	EventType      string
+	Payload        string // JSON of the event
+	Status         string // DeliveryPending, DeliverySent or DeliveryFailed
+	Attempts       int
+	ResponseStatus int // HTTP status of the last response, zero if none
+	LastError      string
+	NextAttemptAt  time.Time
+	SentAt         time.Time // Zero until sent
+	CreatedAt      time.Time
+}
+
+// CreateWebhook registers a URL receiving the given event types, with a new
+// random secret
+func CreateWebhook(url string, eventTypes []string) (int64, error) {
+	secret, err := randomToken()
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO webhooks (url, secret) VALUES (?, ?)", url, secret)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, eventType := range eventTypes {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO webhook_events (webhook_id, event_type) VALUES (?, ?)", id, eventType); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// GetAllWebhooks retrieves all webhooks with their event types
+func GetAllWebhooks() ([]Webhook, error) {
+	return queryWebhooks("SELECT id, url, secret, created_at FROM webhooks WHERE deleted_at IS NULL ORDER BY id")
+}
+
+// GetWebhook retrieves a webhook with its event types by ID
+func GetWebhook(id int64) (Webhook, error) {
+	webhooks, err := queryWebhooks("SELECT id, url, secret, created_at FROM webhooks WHERE id = ? AND deleted_at IS NULL", id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if len(webhooks) == 0 {
+		return Webhook{}, sql.ErrNoRows
+	}
+	return webhooks[0], nil
+}
+
+// GetWebhooksForEvent retrieves the webhooks receiving an event type
+func GetWebhooksForEvent(eventType string) ([]Webhook, error) {
+	return queryWebhooks(
+		`SELECT id, url, secret, created_at FROM webhooks
+		 WHERE id IN (SELECT webhook_id FROM webhook_events WHERE event_type = ?) AND deleted_at IS NULL
+		 ORDER BY id`,
+		eventType,
+	)
+}
+
+// queryWebhooks runs a query selecting webhooks and loads their event types
+func queryWebhooks(query string, args ...any) ([]Webhook, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []Webhook
+	for rows.Next() {
+		var w Webhook
+		if err := rows.Scan(&w.ID, &w.URL, &w.Secret, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range webhooks {
+		if webhooks[i].EventTypes, err = getWebhookEventTypes(webhooks[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return webhooks, nil
+}
+
+// getWebhookEventTypes retrieves the event types a webhook receives
+func getWebhookEventTypes(webhookID int64) ([]string, error) {
+	rows, err := database.DB.Query("SELECT event_type FROM webhook_events WHERE webhook_id = ? ORDER BY event_type", webhookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var eventTypes []string
+	for rows.Next() {
+		var eventType string
+		if err := rows.Scan(&eventType); err != nil {
+			return nil, err
+		}
+		eventTypes = append(eventTypes, eventType)
+	}
+	return eventTypes, rows.Err()
+}
+
+// DeleteWebhook moves a webhook to the trash by ID. Its pending deliveries
+// are held back while it is there.
+func DeleteWebhook(id int64) error {
+	if err := trashRow("webhooks", id); err != nil {
+		return fmt.Errorf("failed to delete webhook %d: %w", id, err)
+	}
+	return nil
+}
+
+// RestoreWebhook moves a webhook out of the trash by ID
+func RestoreWebhook(id int64) error {
+	if err := restoreRow("webhooks", id); err != nil {
+		return fmt.Errorf("failed to restore webhook %d: %w", id, err)
+	}
+	return nil
+}
+
+// PurgeWebhook permanently deletes a webhook in the trash, its event types
+// and its deliveries by ID
+func PurgeWebhook(id int64) error {
+	if err := purgeRow("webhooks", id, "webhook_events.webhook_id", "webhook_deliveries.webhook_id"); err != nil {
+		return fmt.Errorf("failed to purge webhook %d: %w", id, err)
+	}
+	return nil
+}
+
+// EnqueueWebhookDelivery queues the delivery of an event to a webhook
+func EnqueueWebhookDelivery(webhookID int64, eventID, eventType, payload string) (int64, error) {
+	result, err := database.DB.Exec(
+		"INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload) VALUES (?, ?, ?, ?)",
+		webhookID, eventID, eventType, payload,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// webhookDeliveryQuery selects webhook deliveries with the URL of their
+// webhook, leaving out those of the webhooks in the trash
+const webhookDeliveryQuery = `
+	SELECT d.id, d.webhook_id, w.url, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+		d.response_status, d.last_error, d.next_attempt_at, d.sent_at, d.created_at
+	FROM webhook_deliveries d
+	JOIN webhooks w ON d.webhook_id = w.id AND w.deleted_at IS NULL
+`
+
+// GetPendingWebhookDeliveries retrieves the deliveries to attempt at the
+// given time, in the order the events happened
+func GetPendingWebhookDeliveries(now time.Time) ([]WebhookDelivery, error) {
+	return queryWebhookDeliveries(
+		webhookDeliveryQuery+" WHERE d.status = ? AND d.next_attempt_at <= ? ORDER BY d.id",
+		DeliveryPending, sqlTime(now),
+	)
+}
+
+// GetRecentWebhookDeliveries retrieves the latest deliveries, the most
+// recent first
+func GetRecentWebhookDeliveries(limit int) ([]WebhookDelivery, error) {
+	return queryWebhookDeliveries(webhookDeliveryQuery+" ORDER BY d.id DESC LIMIT ?", limit)
+}
+
+// queryWebhookDeliveries runs a query selecting webhook deliveries
+func queryWebhookDeliveries(query string, args ...any) ([]WebhookDelivery, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		var nextAttemptAt, sentAt sql.NullTime
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.WebhookURL, &d.EventID, &d.EventType, &d.Payload, &d.Status,
+			&d.Attempts, &d.ResponseStatus, &d.LastError, &nextAttemptAt, &sentAt, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		d.NextAttemptAt = nextAttemptAt.Time
+		d.SentAt = sentAt.Time
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RecordWebhookDeliveryAttempt records the outcome of an attempt to deliver
+// an event, with the HTTP status of the response if any. Failed attempts
+// are retried like notifications, until MaxDeliveryAttempts is reached.
+func RecordWebhookDeliveryAttempt(d WebhookDelivery, responseStatus int, sendErr error, now time.Time) error {
+	attempts := d.Attempts + 1
+	if sendErr == nil {
+		_, err := database.DB.Exec(
+			"UPDATE webhook_deliveries SET status = ?, attempts = ?, response_status = ?, last_error = '', sent_at = ? WHERE id = ?",
+			DeliverySent, attempts, responseStatus, sqlTime(now), d.ID,
+		)
+		return err
+	}
+
+	status := DeliveryPending
+	if attempts >= MaxDeliveryAttempts {
+		status = DeliveryFailed
+	}
+	delay := deliveryRetryDelays[min(attempts, len(deliveryRetryDelays))-1]
+	_, err := database.DB.Exec(
+		"UPDATE webhook_deliveries SET status = ?, attempts = ?, response_status = ?, last_error = ?, next_attempt_at = ? WHERE id = ?",
+		status, attempts, responseStatus, sendErr.Error(), sqlTime(now.Add(delay)), d.ID,
+	)
+	return err
+}
+
+// RetryWebhookDelivery queues a delivery again, e.g. after it failed
+func RetryWebhookDelivery(id int64) error {
+	_, err := database.DB.Exec(
+		"UPDATE webhook_deliveries SET status = ?, attempts = 0, next_attempt_at = CURRENT_TIMESTAMP WHERE id = ?",
+		DeliveryPending, id,
+	)
+	return err
+}
@@ -0,0 +1,24 @@
+// Package notify delivers notifications to the user through email, Web Push
+// or an outgoing webhook.
+package notify
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Notification is a message reaching out to the user
+type Notification struct {
+	Title string
+	Body  string
+	URL   string // Page of the app the notification is about, optional
+}
+
+// Notifier delivers notifications through a channel
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// httpClient sends the requests of the Web Push and webhook notifiers
+var httpClient = &http.Client{Timeout: 30 * time.Second}
@@ -0,0 +1,193 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSession is what a fake SMTP server received from a client
+type smtpSession struct {
+	auth string // Decoded AUTH PLAIN response
+	from string
+	to   []string
+	data string
+}
+
+// startSMTPServer runs a fake SMTP server on localhost accepting a single
+// session, without STARTTLS. The session is sent once the client quits.
+func startSMTPServer(t *testing.T) (string, <-chan smtpSession) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		text := textproto.NewConn(conn)
+		var session smtpSession
+		reply := func(format string, args ...any) { text.PrintfLine(format, args...) }
+
+		reply("220 localhost ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			command, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(command) {
+			case "EHLO", "HELO":
+				reply("250-localhost")
+				reply("250-8BITMIME")
+				reply("250 AUTH PLAIN")
+			case "AUTH":
+				_, response, _ := strings.Cut(arg, " ")
+				decoded, _ := base64.StdEncoding.DecodeString(response)
+				session.auth = string(decoded)
+				reply("235 Authenticated")
+			case "MAIL":
+				session.from = smtpPath(arg)
+				reply("250 OK")
+			case "RCPT":
+				session.to = append(session.to, smtpPath(arg))
+				reply("250 OK")
+			case "DATA":
+				reply("354 Go ahead")
+				data, err := io.ReadAll(text.DotReader())
+				if err != nil {
+					return
+				}
+				session.data = string(data)
+				reply("250 Queued")
+			case "QUIT":
+				reply("221 Bye")
+				sessions <- session
+				return
+			default:
+				reply("502 Unknown command")
+			}
+		}
+	}()
+	return listener.Addr().String(), sessions
+}
+
+// smtpPath returns the address between angle brackets of a MAIL or RCPT
+// command, e.g. FROM:<app@example.com> BODY=8BITMIME
+func smtpPath(arg string) string {
+	_, path, _ := strings.Cut(arg, "<")
+	path, _, _ = strings.Cut(path, ">")
+	return path
+}
+
+func TestSMTPNotify(t *testing.T) {
+	addr, sessions := startSMTPServer(t)
+	sender := SMTP{Addr: addr, Username: "me", Password: "secret", From: "app@example.com", To: "me@example.com"}
+	n := Notification{Title: "Rappel: réviser", Body: "Time for your review.\nIt takes ten minutes.", URL: "http://localhost:8080/reports"}
+
+	if err := sender.Notify(context.Background(), n); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	session := <-sessions
+
+	if session.auth != "\x00me\x00secret" {
+		t.Errorf("authenticated with %q", session.auth)
+	}
+	if session.from != sender.From {
+		t.Errorf("sent from %q, want %q", session.from, sender.From)
+	}
+	if len(session.to) != 1 || session.to[0] != sender.To {
+		t.Errorf("sent to %q, want %q", session.to, sender.To)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(session.data))
+	if err != nil {
+		t.Fatalf("reading the email: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != n.Title {
+		t.Errorf("subject %q (%v), want %q", subject, err, n.Title)
+	}
+	if got := msg.Header.Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("content type %q", got)
+	}
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The dot reader of the server turns the CRLF line endings into LF
+	want := "Time for your review.\nIt takes ten minutes.\n\nhttp://localhost:8080/reports\n"
+	if string(body) != want {
+		t.Errorf("body %q, want %q", body, want)
+	}
+}
+
+func TestSMTPNotifyUnconfigured(t *testing.T) {
+	if err := (SMTP{Addr: "localhost:25"}).Notify(context.Background(), Notification{Title: "Hi"}); err == nil {
+		t.Error("Notify succeeded without sender and recipient")
+	}
+}
+
+func TestSMTPNotifyRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("554 No service\r\n"))
+	}()
+	defer listener.Close()
+
+	sender := SMTP{Addr: listener.Addr().String(), From: "app@example.com", To: "me@example.com"}
+	if err := sender.Notify(context.Background(), Notification{Title: "Hi"}); err == nil {
+		t.Error("Notify succeeded although the server refused the connection")
+	}
+}
+
+func TestSMTPNotifyStalled(t *testing.T) {
+	// The server accepts the connection but never greets the client
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(io.Discard, conn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	sender := SMTP{Addr: listener.Addr().String(), From: "app@example.com", To: "me@example.com"}
+	start := time.Now()
+	err = sender.Notify(ctx, Notification{Title: "Hi"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Notify = %v, want the deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Notify returned after %v", elapsed)
+	}
+}
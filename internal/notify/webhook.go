@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Webhook posts notifications as JSON to a URL, e.g. a chat integration
+type Webhook struct {
+	URL string
+}
+
+// webhookPayload is the JSON body posted by the webhook notifier
+type webhookPayload struct {
+	Title  string    `json:"title"`
+	Body   string    `json:"body"`
+	URL    string    `json:"url,omitempty"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// Notify posts the notification. Any response other than 2xx is an error.
+func (h Webhook) Notify(ctx context.Context, n Notification) error {
+	if h.URL == "" {
+		return errors.New("the webhook is not configured")
+	}
+
+	body, err := json.Marshal(webhookPayload{Title: n.Title, Body: n.Body, URL: n.URL, SentAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the webhook answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// pushTTL is how long push services keep a notification for an offline
+// browser, in seconds
+const pushTTL = 24 * 60 * 60
+
+// pushRecordSize is the record size announced in the encrypted payload. The
+// payload is sent as a single record, so it must be smaller.
+const pushRecordSize = 4096
+
+// PushSubscription is a browser subscribed to Web Push notifications, as
+// returned by PushManager.subscribe()
+type PushSubscription struct {
+	Endpoint string
+	P256dh   string // Public key of the browser, base64url encoded
+	Auth     string // Authentication secret, base64url encoded
+}
+
+// VAPIDKeys identify the application to push services (RFC 8292)
+type VAPIDKeys struct {
+	private *ecdsa.PrivateKey
+}
+
+// GenerateVAPIDKeys generates a new key pair
+func GenerateVAPIDKeys() (VAPIDKeys, error) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return VAPIDKeys{}, err
+	}
+	return VAPIDKeys{private: private}, nil
+}
+
+// ParseVAPIDKeys reads keys encoded with VAPIDKeys.String
+func ParseVAPIDKeys(s string) (VAPIDKeys, error) {
+	d, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return VAPIDKeys{}, err
+	}
+	key, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return VAPIDKeys{}, err
+	}
+	public := key.PublicKey().Bytes()
+	private := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(public[1:33]),
+			Y:     new(big.Int).SetBytes(public[33:]),
+		},
+		D: new(big.Int).SetBytes(d),
+	}
+	return VAPIDKeys{private: private}, nil
+}
+
+// String encodes the private key, to be stored
+func (k VAPIDKeys) String() string {
+	return base64.RawURLEncoding.EncodeToString(k.private.D.FillBytes(make([]byte, 32)))
+}
+
+// PublicKey returns the public key, base64url encoded, which browsers need
+// as the applicationServerKey to subscribe
+func (k VAPIDKeys) PublicKey() string {
+	key, err := k.private.ECDH()
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes())
+}
+
+// WebPush sends notifications to the browsers subscribed to them
+type WebPush struct {
+	Keys          VAPIDKeys
+	Subject       string // Contact of the sender for push services, a mailto: or https: URL
+	Subscriptions []PushSubscription
+	// Expired is called with the subscriptions the push service no longer
+	// knows, e.g. after the user revoked the permission
+	Expired func(PushSubscription)
+}
+
+// ErrNoSubscription is returned when no browser subscribed to notifications
+var ErrNoSubscription = errors.New("no browser is subscribed to push notifications")
+
+// Notify sends the notification to every subscription. Expired ones are
+// reported rather than failing the delivery.
+func (p WebPush) Notify(ctx context.Context, n Notification) error {
+	if len(p.Subscriptions) == 0 {
+		return ErrNoSubscription
+	}
+	payload, err := json.Marshal(map[string]string{"title": n.Title, "body": n.Body, "url": n.URL})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, subscription := range p.Subscriptions {
+		gone, err := p.send(ctx, subscription, payload)
+		if gone && p.Expired != nil {
+			p.Expired(subscription)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// send pushes an encrypted payload to a subscription. It reports whether
+// the subscription has expired.
+func (p WebPush) send(ctx context.Context, subscription PushSubscription, payload []byte) (bool, error) {
+	body, err := encryptPushPayload(subscription, payload)
+	if err != nil {
+		return false, err
+	}
+	authorization, err := p.authorization(subscription.Endpoint, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", fmt.Sprint(pushTTL))
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return true, nil
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return false, fmt.Errorf("the push service answered %s", resp.Status)
+	}
+	return false, nil
+}
+
+// authorization returns the VAPID Authorization header for a push service:
+// a JWT signed with ES256, valid for 12 hours
+func (p WebPush) authorization(endpoint string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(12 * time.Hour).Unix(),
+		"sub": p.Subject,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	encode := base64.RawURLEncoding.EncodeToString
+	unsigned := encode([]byte(`{"typ":"JWT","alg":"ES256"}`)) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, p.Keys.private, digest[:])
+	if err != nil {
+		return "", err
+	}
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return fmt.Sprintf("vapid t=%s.%s, k=%s", unsigned, encode(signature), p.Keys.PublicKey()), nil
+}
+
+// encryptPushPayload encrypts a payload for a subscription with the
+// aes128gcm content encoding of Web Push (RFC 8291)
+func encryptPushPayload(subscription PushSubscription, payload []byte) ([]byte, error) {
+	decode := func(s string) ([]byte, error) {
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	}
+	browserKeyBytes, err := decode(subscription.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription key: %w", err)
+	}
+	authSecret, err := decode(subscription.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription secret: %w", err)
+	}
+	browserKey, err := ecdh.P256().NewPublicKey(browserKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription key: %w", err)
+	}
+	if len(payload)+17+16 > pushRecordSize {
+		return nil, errors.New("the notification is too long")
+	}
+
+	// An ephemeral key pair is used for each message
+	serverKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := serverKey.ECDH(browserKey)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	serverPublic := serverKey.PublicKey().Bytes()
+	keyInfo := append(append([]byte("WebPush: info\x00"), browserKeyBytes...), serverPublic...)
+	ikm := hkdf(authSecret, sharedSecret, keyInfo, 32)
+	contentKey := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// The payload is a single record, ended by the 0x02 delimiter
+	record := gcm.Seal(nil, nonce, append(payload, 0x02), nil)
+
+	header := make([]byte, 0, 16+4+1+len(serverPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, pushRecordSize)
+	header = append(header, byte(len(serverPublic)))
+	header = append(header, serverPublic...)
+	return append(header, record...), nil
+}
+
+// hkdf derives a key of at most 32 bytes with HKDF-SHA256 (RFC 5869)
+func hkdf(salt, secret, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write(info)
+	expand.Write([]byte{1})
+	return expand.Sum(nil)[:length]
+}
@@ -0,0 +1,289 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pushRequest is what a fake push service received
+type pushRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// startPushService runs a fake push service answering with the given status
+func startPushService(t *testing.T, status int) (*httptest.Server, <-chan pushRequest) {
+	t.Helper()
+	requests := make(chan pushRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- pushRequest{header: r.Header, body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+// browser is the receiving end of a push subscription
+type browser struct {
+	key        *ecdh.PrivateKey
+	authSecret []byte
+}
+
+func newBrowser(t *testing.T) browser {
+	t.Helper()
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authSecret := make([]byte, 16)
+	rand.Read(authSecret)
+	return browser{key: key, authSecret: authSecret}
+}
+
+func (b browser) subscription(endpoint string) PushSubscription {
+	encode := base64.RawURLEncoding.EncodeToString
+	return PushSubscription{Endpoint: endpoint, P256dh: encode(b.key.PublicKey().Bytes()), Auth: encode(b.authSecret)}
+}
+
+// decrypt decrypts a payload as a browser does (RFC 8291, section 3.4)
+func (b browser) decrypt(t *testing.T, body []byte) []byte {
+	t.Helper()
+	if len(body) < 21 {
+		t.Fatalf("payload of %d bytes is too short", len(body))
+	}
+	salt, recordSize, keyLength := body[:16], binary.BigEndian.Uint32(body[16:20]), int(body[20])
+	if recordSize != pushRecordSize {
+		t.Errorf("record size %d, want %d", recordSize, pushRecordSize)
+	}
+	serverPublic, record := body[21:21+keyLength], body[21+keyLength:]
+
+	serverKey, err := ecdh.P256().NewPublicKey(serverPublic)
+	if err != nil {
+		t.Fatalf("invalid server key: %v", err)
+	}
+	sharedSecret, err := b.key.ECDH(serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyInfo := append(append([]byte("WebPush: info\x00"), b.key.PublicKey().Bytes()...), serverPublic...)
+	ikm := hkdf(b.authSecret, sharedSecret, keyInfo, 32)
+	contentKey := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := gcm.Open(nil, nonce, record, nil)
+	if err != nil {
+		t.Fatalf("decrypting the payload: %v", err)
+	}
+	// The last record ends with the 0x02 delimiter, with no padding here
+	if len(plaintext) == 0 || plaintext[len(plaintext)-1] != 0x02 {
+		t.Fatalf("payload %q does not end with the last record delimiter", plaintext)
+	}
+	return plaintext[:len(plaintext)-1]
+}
+
+// checkVAPID verifies the VAPID Authorization header of a push request
+// (RFC 8292) and returns its claims
+func checkVAPID(t *testing.T, authorization string, keys VAPIDKeys) map[string]any {
+	t.Helper()
+	params, ok := strings.CutPrefix(authorization, "vapid ")
+	if !ok {
+		t.Fatalf("authorization %q is not VAPID", authorization)
+	}
+	var token, publicKey string
+	for _, param := range strings.Split(params, ", ") {
+		name, value, _ := strings.Cut(param, "=")
+		switch name {
+		case "t":
+			token = value
+		case "k":
+			publicKey = value
+		}
+	}
+	if publicKey != keys.PublicKey() {
+		t.Errorf("public key %q, want %q", publicKey, keys.PublicKey())
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token %q is not a JWT", token)
+	}
+	decode := base64.RawURLEncoding.DecodeString
+	header, err := decode(parts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jwtHeader map[string]string
+	if err := json.Unmarshal(header, &jwtHeader); err != nil || jwtHeader["alg"] != "ES256" {
+		t.Errorf("JWT header %s (%v), want ES256", header, err)
+	}
+
+	public, err := decode(publicKey)
+	if err != nil || len(public) != 65 {
+		t.Fatalf("invalid public key %q: %v", publicKey, err)
+	}
+	verifier := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(public[1:33]),
+		Y:     new(big.Int).SetBytes(public[33:]),
+	}
+	signature, err := decode(parts[2])
+	if err != nil || len(signature) != 64 {
+		t.Fatalf("invalid signature %q: %v", parts[2], err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(verifier, digest[:], r, s) {
+		t.Error("the JWT signature does not verify with the public key")
+	}
+
+	payload, err := decode(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestWebPushNotify(t *testing.T) {
+	server, requests := startPushService(t, http.StatusCreated)
+	keys, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newBrowser(t)
+	push := WebPush{Keys: keys, Subject: "mailto:me@example.com", Subscriptions: []PushSubscription{b.subscription(server.URL + "/push/abc")}}
+	n := Notification{Title: "Weekly review", Body: "Time to look back on the week", URL: "http://localhost:8080/reports"}
+
+	if err := push.Notify(context.Background(), n); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	req := <-requests
+
+	if got := req.header.Get("Content-Encoding"); got != "aes128gcm" {
+		t.Errorf("content encoding %q", got)
+	}
+	if got := req.header.Get("TTL"); got != "86400" {
+		t.Errorf("TTL %q", got)
+	}
+
+	var payload map[string]string
+	if err := json.Unmarshal(b.decrypt(t, req.body), &payload); err != nil {
+		t.Fatalf("decrypted payload is not JSON: %v", err)
+	}
+	if payload["title"] != n.Title || payload["body"] != n.Body || payload["url"] != n.URL {
+		t.Errorf("payload %v, want %+v", payload, n)
+	}
+
+	claims := checkVAPID(t, req.header.Get("Authorization"), keys)
+	if claims["aud"] != server.URL {
+		t.Errorf("audience %v, want %s", claims["aud"], server.URL)
+	}
+	if claims["sub"] != push.Subject {
+		t.Errorf("subject %v, want %s", claims["sub"], push.Subject)
+	}
+	exp, _ := claims["exp"].(float64)
+	if expires := time.Unix(int64(exp), 0); expires.Before(time.Now()) || expires.After(time.Now().Add(24*time.Hour)) {
+		t.Errorf("the token expires at %v", expires)
+	}
+}
+
+func TestWebPushNotifyExpired(t *testing.T) {
+	server, _ := startPushService(t, http.StatusGone)
+	keys, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscription := newBrowser(t).subscription(server.URL)
+	var expired []PushSubscription
+	push := WebPush{
+		Keys:          keys,
+		Subscriptions: []PushSubscription{subscription},
+		Expired:       func(s PushSubscription) { expired = append(expired, s) },
+	}
+
+	if err := push.Notify(context.Background(), Notification{Title: "Hi"}); err != nil {
+		t.Errorf("Notify: %v", err)
+	}
+	if len(expired) != 1 || expired[0] != subscription {
+		t.Errorf("expired %v, want the subscription", expired)
+	}
+}
+
+func TestWebPushNotifyFailed(t *testing.T) {
+	server, _ := startPushService(t, http.StatusInternalServerError)
+	keys, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	push := WebPush{Keys: keys, Subscriptions: []PushSubscription{newBrowser(t).subscription(server.URL)}}
+
+	if err := push.Notify(context.Background(), Notification{Title: "Hi"}); err == nil {
+		t.Error("Notify succeeded although the push service failed")
+	}
+	if err := (WebPush{Keys: keys}).Notify(context.Background(), Notification{Title: "Hi"}); !errors.Is(err, ErrNoSubscription) {
+		t.Errorf("Notify without subscription: %v, want ErrNoSubscription", err)
+	}
+}
+
+func TestEncryptPushPayloadTooLong(t *testing.T) {
+	subscription := newBrowser(t).subscription("https://push.example.com")
+	if _, err := encryptPushPayload(subscription, bytes.Repeat([]byte("x"), pushRecordSize)); err == nil {
+		t.Error("a payload larger than a record was encrypted")
+	}
+}
+
+func TestParseVAPIDKeys(t *testing.T) {
+	keys, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseVAPIDKeys(keys.String())
+	if err != nil {
+		t.Fatalf("ParseVAPIDKeys: %v", err)
+	}
+	if parsed.PublicKey() != keys.PublicKey() {
+		t.Errorf("public key %q after parsing, want %q", parsed.PublicKey(), keys.PublicKey())
+	}
+}
+
+func TestHKDF(t *testing.T) {
+	// Test case 1 of RFC 5869, truncated to 32 bytes
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	secret := bytes.Repeat([]byte{0x0b}, 22)
+	want := "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf"
+	if got := hex.EncodeToString(hkdf(salt, secret, info, 32)); got != want {
+		t.Errorf("hkdf = %s, want %s", got, want)
+	}
+}
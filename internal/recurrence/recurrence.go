@@ -0,0 +1,260 @@
+// Package recurrence implements the subset of the RFC 5545 recurrence rules
+// (RRULE) used to repeat plans: FREQ (DAILY, WEEKLY, MONTHLY or YEARLY),
+// INTERVAL, BYDAY (plain weekdays, with WEEKLY), BYMONTHDAY (with MONTHLY),
+// COUNT and UNTIL. For example "FREQ=MONTHLY;INTERVAL=3;BYMONTHDAY=1" is the
+// first day of every quarter.
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequencies
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	Yearly  = "YEARLY"
+)
+
+// maxPeriods bounds the number of periods walked to find an occurrence, so
+// that a rule whose occurrences are all skipped cannot loop forever
+const maxPeriods = 100_000
+
+var dayNames = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// Rule is a parsed recurrence rule
+type Rule struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int // Negative days count from the end of the month
+	Count      int   // Zero for no limit
+	Until      time.Time
+}
+
+// Parse reads a recurrence rule such as "FREQ=WEEKLY;BYDAY=MO,TH". A
+// leading "RRULE:" is accepted.
+func Parse(s string) (Rule, error) {
+	rule := Rule{Interval: 1}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return rule, errors.New("empty recurrence rule")
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return rule, fmt.Errorf("invalid rule part %q", part)
+		}
+		var err error
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(value)
+			if !slices.Contains([]string{Daily, Weekly, Monthly, Yearly}, rule.Freq) {
+				return rule, fmt.Errorf("unsupported frequency %q", value)
+			}
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(value)
+			if err != nil || rule.Interval < 1 {
+				return rule, fmt.Errorf("invalid interval %q", value)
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(strings.ToUpper(value), ",") {
+				weekday, ok := dayNames[day]
+				if !ok {
+					return rule, fmt.Errorf("unsupported day %q", day)
+				}
+				rule.ByDay = append(rule.ByDay, weekday)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return rule, fmt.Errorf("invalid month day %q", day)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, n)
+			}
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(value)
+			if err != nil || rule.Count < 1 {
+				return rule, fmt.Errorf("invalid count %q", value)
+			}
+		case "UNTIL":
+			rule.Until, err = parseUntil(value)
+			if err != nil {
+				return rule, fmt.Errorf("invalid until %q", value)
+			}
+		default:
+			return rule, fmt.Errorf("unsupported rule part %q", name)
+		}
+	}
+
+	switch {
+	case rule.Freq == "":
+		return rule, errors.New("the rule has no FREQ")
+	case len(rule.ByDay) > 0 && rule.Freq != Weekly:
+		return rule, errors.New("BYDAY is only supported with FREQ=WEEKLY")
+	case len(rule.ByMonthDay) > 0 && rule.Freq != Monthly:
+		return rule, errors.New("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	case rule.Count > 0 && !rule.Until.IsZero():
+		return rule, errors.New("COUNT and UNTIL cannot be both set")
+	}
+	return rule, nil
+}
+
+// parseUntil reads an UNTIL date, either a day or a UTC date-time
+func parseUntil(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("20060102", value, time.Local); err == nil {
+		// The whole day is included
+		return t.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return time.Parse("20060102T150405Z", value)
+}
+
+// String formats the rule in its canonical form
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, weekday := range r.ByDay {
+			days[i] = strings.ToUpper(weekday.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Describe explains the rule in plain English, e.g. "every 3 months"
+func (r Rule) Describe() string {
+	unit := map[string]string{Daily: "day", Weekly: "week", Monthly: "month", Yearly: "year"}[r.Freq]
+	text := "every " + unit
+	if r.Interval > 1 {
+		text = fmt.Sprintf("every %d %ss", r.Interval, unit)
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, weekday := range r.ByDay {
+			days[i] = weekday.String()
+		}
+		text += " on " + strings.Join(days, ", ")
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		text += " on day " + strings.Join(days, ", ")
+	}
+	if r.Count > 0 {
+		text += fmt.Sprintf(", %d times", r.Count)
+	}
+	if !r.Until.IsZero() {
+		text += ", until " + r.Until.Local().Format("Jan 02, 2006")
+	}
+	return text
+}
+
+// Next returns the first occurrence of the rule starting at start which is
+// strictly after the given time, or false if there is none
+func (r Rule) Next(start, after time.Time) (time.Time, bool) {
+	n := 0
+	for period := 0; period < maxPeriods; period++ {
+		for _, occurrence := range r.occurrences(start, period) {
+			if occurrence.Before(start) {
+				continue
+			}
+			n++
+			if (r.Count > 0 && n > r.Count) || (!r.Until.IsZero() && occurrence.After(r.Until)) {
+				return time.Time{}, false
+			}
+			if occurrence.After(after) {
+				return occurrence, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// occurrences returns the candidate occurrences of the given period after
+// start, in order. Occurrences before start are filtered by the caller.
+func (r Rule) occurrences(start time.Time, period int) []time.Time {
+	step := period * r.Interval
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+	}
+
+	switch r.Freq {
+	case Daily:
+		return []time.Time{start.AddDate(0, 0, step)}
+	case Weekly:
+		if len(r.ByDay) == 0 {
+			return []time.Time{start.AddDate(0, 0, 7*step)}
+		}
+		monday := start.AddDate(0, 0, 7*step-(int(start.Weekday())+6)%7)
+		var days []time.Time
+		for i := 0; i < 7; i++ {
+			day := monday.AddDate(0, 0, i)
+			if slices.Contains(r.ByDay, day.Weekday()) {
+				days = append(days, day)
+			}
+		}
+		return days
+	case Monthly:
+		first := time.Date(start.Year(), start.Month()+time.Month(step), 1, 0, 0, 0, 0, start.Location())
+		length := first.AddDate(0, 1, -1).Day()
+		monthDays := r.ByMonthDay
+		if len(monthDays) == 0 {
+			monthDays = []int{start.Day()}
+		}
+		var days []int
+		for _, day := range monthDays {
+			if day < 0 {
+				day = length + day + 1
+			}
+			// Days the month does not have are skipped, as in RFC 5545
+			if day >= 1 && day <= length && !slices.Contains(days, day) {
+				days = append(days, day)
+			}
+		}
+		slices.Sort(days)
+		occurrences := make([]time.Time, len(days))
+		for i, day := range days {
+			occurrences[i] = at(first.Year(), first.Month(), day)
+		}
+		return occurrences
+	case Yearly:
+		year := start.Year() + step
+		occurrence := at(year, start.Month(), start.Day())
+		if occurrence.Month() != start.Month() {
+			// February 29 in a non-leap year
+			return nil
+		}
+		return []time.Time{occurrence}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Package scheduler runs background jobs periodically inside the server
+// process.
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"pds/internal/metrics"
+)
+
+// Outcomes of the runs of jobs
+const (
+	outcomeOK    = "ok"
+	outcomeError = "error"
+	outcomePanic = "panic"
+)
+
+var (
+	jobRuns = metrics.NewCounter("pds_job_runs_total",
+		"Number of runs of the background jobs, by job and outcome: ok, error or panic.", "job", "outcome")
+	jobDuration = metrics.NewHistogram("pds_job_duration_seconds",
+		"Time taken by the runs of the background jobs.", metrics.DefaultBuckets, "job")
+	jobLastSuccess = metrics.NewGauge("pds_job_last_success_timestamp_seconds",
+		"Unix time of the last successful run of the background jobs.", "job")
+)
+
+// job is a function run every interval
+type job struct {
+	name     string
+	interval time.Duration
+	run      func() error
+}
+
+// Scheduler runs jobs in the background, each in its own goroutine so that
+// a slow job does not delay the others
+type Scheduler struct {
+	jobs []job
+	wg   sync.WaitGroup
+}
+
+// New returns a scheduler without jobs
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+// Every adds a job run every interval, the first time when the scheduler
+// starts. Jobs return an error when a run fails as a whole; they log the
+// failures of the single items they process, which are retried later.
+func (s *Scheduler) Every(name string, interval time.Duration, run func() error) {
+	s.jobs = append(s.jobs, job{name: name, interval: interval, run: run})
+}
+
+// Start runs the jobs until the context is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			ticker := time.NewTicker(j.interval)
+			defer ticker.Stop()
+			for {
+				runJob(j)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+	slog.Info("Scheduler started", "jobs", len(s.jobs))
+}
+
+// Wait waits for the jobs to return once the context is cancelled
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// runJob runs a job once, and records its outcome. A panicking job is logged
+// and run again at the next interval rather than stopping the server.
+func runJob(j job) {
+	start := time.Now()
+	outcome := outcomePanic
+	defer func() {
+		if err := recover(); err != nil {
+			slog.Error("Job panicked", "job", j.name, "err", err)
+		}
+		jobRuns.Inc(j.name, outcome)
+		jobDuration.ObserveDuration(start, j.name)
+	}()
+
+	if err := j.run(); err != nil {
+		slog.Error("Job failed", "job", j.name, "err", err)
+		outcome = outcomeError
+		return
+	}
+	outcome = outcomeOK
+	jobLastSuccess.Set(float64(time.Now().Unix()), j.name)
+}
@@ -0,0 +1,177 @@
+// Package sse streams server-sent events to the open pages, so that they are
+// updated live when the data changes in another tab or device.
+package sse
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeartbeatInterval is the interval of the comments keeping idle streams
+// open through proxies, and detecting disconnected clients
+const HeartbeatInterval = 30 * time.Second
+
+// retryDelay is how long browsers wait before reconnecting, in milliseconds
+const retryDelay = 5000
+
+// clientBuffer is the number of messages a slow client may lag behind before
+// messages are dropped for it
+const clientBuffer = 16
+
+// Message is an event sent to the clients of a topic
+type Message struct {
+	Event string // Name of the event, which HTMX's sse-swap attribute selects
+	Data  string
+}
+
+// client is an open stream
+type client struct {
+	topic    string
+	messages chan Message
+}
+
+// Broker dispatches messages to the streams open on their topic. The app
+// has a single user, so every stream belongs to them and topics only select
+// the pages that are interested.
+type Broker struct {
+	mu      sync.Mutex
+	clients map[*client]struct{}
+	closed  bool
+	done    chan struct{}
+}
+
+// NewBroker creates a broker with no client
+func NewBroker() *Broker {
+	return &Broker{clients: make(map[*client]struct{}), done: make(chan struct{})}
+}
+
+// Publish sends a message to the clients of a topic. Clients too slow to
+// keep up miss it rather than block the publisher.
+func (b *Broker) Publish(topic string, msg Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.clients {
+		if c.topic != topic {
+			continue
+		}
+		select {
+		case c.messages <- msg:
+		default:
+			slog.Warn("Dropping event for a slow client", "event", msg.Event, "topic", topic)
+		}
+	}
+}
+
+// Clients returns the number of open streams
+func (b *Broker) Clients() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.clients)
+}
+
+// Close ends all the streams, e.g. when the server shuts down, and refuses
+// new ones
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		close(b.done)
+	}
+}
+
+// subscribe registers a client of a topic, unless the broker is closed
+func (b *Broker) subscribe(topic string) (*client, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, false
+	}
+	c := &client{topic: topic, messages: make(chan Message, clientBuffer)}
+	b.clients[c] = struct{}{}
+	return c, true
+}
+
+// unsubscribe removes a client
+func (b *Broker) unsubscribe(c *client) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.clients, c)
+}
+
+// ServeHTTP streams the messages of the topic given in the query string,
+// e.g. /events?topic=journals, until the client disconnects or the broker
+// is closed
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	topic := r.URL.Query().Get("topic")
+	if topic == "" {
+		http.Error(w, "Missing topic", http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Streams outlive the write timeout of the server
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		slog.WarnContext(r.Context(), "Error clearing write deadline of stream", "err", err)
+	}
+
+	c, ok := b.subscribe(topic)
+	if !ok {
+		http.Error(w, "The server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer b.unsubscribe(c)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprintf(w, "retry: %d\n\n", retryDelay)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(HeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-b.done:
+			return
+		case msg := <-c.messages:
+			if err := writeMessage(w, msg); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeMessage writes a message in the event stream format, each line of
+// its data in a data field
+func writeMessage(w http.ResponseWriter, msg Message) error {
+	var sb strings.Builder
+	if msg.Event != "" {
+		sb.WriteString("event: " + msg.Event + "\n")
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(msg.Data, "\r\n", "\n"), "\n") {
+		sb.WriteString("data: " + line + "\n")
+	}
+	sb.WriteString("\n")
+	_, err := fmt.Fprint(w, sb.String())
+	return err
+}
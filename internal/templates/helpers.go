@@ -0,0 +1,355 @@
+package templates
+
+import (
+	"fmt"
+	"github.com/a-h/templ"
+	"pds/internal/forms"
+	"pds/internal/markdown"
+	"pds/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReportTitle returns the title of a report, e.g. "Week of Oct 19, 2026"
+func ReportTitle(report models.Report) string {
+	if report.Period == models.ReportMonth {
+		return report.Start.Format("January 2006")
+	}
+	return "Week of " + report.Start.Format("Jan 02, 2006")
+}
+
+// FormatTrend describes the change of a value with an arrow
+func FormatTrend(delta float64) string {
+	switch {
+	case delta > 0.05:
+		return fmt.Sprintf("↑ +%.1f", delta)
+	case delta < -0.05:
+		return fmt.Sprintf("↓ %.1f", delta)
+	default:
+		return "→ stable"
+	}
+}
+
+// reportURL returns the URL of the report of the given period starting at the given date
+func reportURL(period string, start time.Time) string {
+	return "/reports/" + period + "/" + start.Format("2006-01-02")
+}
+
+// moodSparkline returns the points of an SVG polyline drawing the daily moods
+// of the given period, in a width x height box
+func moodSparkline(moods []models.MoodPoint, start time.Time, days int, width, height float64) string {
+	var b strings.Builder
+	for _, mood := range moods {
+		x := mood.Day.Sub(start).Hours() / 24 / float64(days) * width
+		y := height - (mood.Average-1)/4*height
+		fmt.Fprintf(&b, "%.1f,%.1f ", x, y)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// hasAim reports whether an aim with the given ID is in the list
+func hasAim(aims []models.Aim, id int64) bool {
+	for _, aim := range aims {
+		if aim.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// hasBehaviour reports whether a behaviour with the given ID is in the list
+func hasBehaviour(behaviours []models.Behaviour, id int64) bool {
+	for _, behaviour := range behaviours {
+		if behaviour.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// hasStatement reports whether a statement with the given ID is in the list
+func hasStatement(statements []models.Statement, id int64) bool {
+	for _, statement := range statements {
+		if statement.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// planAimWeight returns the contribution weight to an aim entered in a plan
+// form, defaulting to 1
+func planAimWeight(form *forms.Form, id int64) string {
+	return formValueOr(form, "weight-"+strconv.FormatInt(id, 10), "1")
+}
+
+// formValueOr returns the value entered in a form field, or def if it is blank
+func formValueOr(form *forms.Form, field, def string) string {
+	if value := form.Get(field); value != "" {
+		return value
+	}
+	return def
+}
+
+// selectedAims returns the aims selected in the "aims" field of a form
+func selectedAims(aims []models.Aim, form *forms.Form) []models.Aim {
+	var selected []models.Aim
+	for _, aim := range aims {
+		if form.Has("aims", strconv.FormatInt(aim.ID, 10)) {
+			selected = append(selected, aim)
+		}
+	}
+	return selected
+}
+
+// selectedBehaviours returns the behaviours selected in the "behaviours" field of a form
+func selectedBehaviours(behaviours []models.Behaviour, form *forms.Form) []models.Behaviour {
+	var selected []models.Behaviour
+	for _, behaviour := range behaviours {
+		if form.Has("behaviours", strconv.FormatInt(behaviour.ID, 10)) {
+			selected = append(selected, behaviour)
+		}
+	}
+	return selected
+}
+
+// formatWeight formats a contribution weight without useless decimals
+func formatWeight(weight float64) string {
+	return strconv.FormatFloat(weight, 'g', -1, 64)
+}
+
+// markdownHTML renders Markdown content as sanitized HTML
+func markdownHTML(source string) templ.Component {
+	return templ.Raw(markdown.Render(source))
+}
+
+// checklistHTML renders Markdown content as sanitized HTML, with checklist
+// items that can be ticked
+func checklistHTML(source string) templ.Component {
+	return templ.Raw(markdown.RenderChecklist(source))
+}
+
+// formatFileSize formats a size in bytes for humans, e.g. "1.2 MB"
+func formatFileSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.0f KB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
+
+// calendarWeeks splits consecutive days into weeks starting on Monday. The
+// days before the first one and after the last one in their week are nil.
+func calendarWeeks(days []models.CalendarDay) [][]*models.CalendarDay {
+	var weeks [][]*models.CalendarDay
+	var week []*models.CalendarDay
+	for i := range days {
+		if week == nil {
+			week = make([]*models.CalendarDay, (int(days[i].Day.Weekday())+6)%7, 7)
+		}
+		week = append(week, &days[i])
+		if len(week) == 7 {
+			weeks = append(weeks, week)
+			week = nil
+		}
+	}
+	if week != nil {
+		weeks = append(weeks, append(week, make([]*models.CalendarDay, 7-len(week))...))
+	}
+	return weeks
+}
+
+// weekLabel returns the name of the month starting during a week, if any
+func weekLabel(week []*models.CalendarDay) string {
+	for _, day := range week {
+		if day != nil && day.Day.Day() == 1 {
+			return day.Day.Format("Jan")
+		}
+	}
+	return ""
+}
+
+// calendarDayURL returns the URL of the entries of a day
+func calendarDayURL(day time.Time) string {
+	return "/calendar/day/" + day.Format("2006-01-02")
+}
+
+// moodClass returns the CSS class colouring a day by its average mood
+func moodClass(mood float64) string {
+	if mood == 0 {
+		return ""
+	}
+	return fmt.Sprintf("mood-%.0f", mood)
+}
+
+// heatClass returns the CSS class colouring a day of the heatmap by the
+// number of journal entries written on it
+func heatClass(day models.CalendarDay) string {
+	return "heat-" + strconv.Itoa(min(day.Journals(), 4))
+}
+
+// calendarDayTitle describes the activity of a day, shown when hovering it
+func calendarDayTitle(day models.CalendarDay) string {
+	parts := []string{day.Day.Format("Mon Jan 02, 2006"), fmt.Sprintf("%d journal entries", day.Journals())}
+	if day.Mood != 0 {
+		parts = append(parts, fmt.Sprintf("mood %.1f", day.Mood))
+	}
+	if day.Occurrences > 0 {
+		parts = append(parts, fmt.Sprintf("%d behaviour occurrences", day.Occurrences))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// habitRateDays is the number of days the completion rate of habits covers
+const habitRateDays = 30
+
+// habitRateText shows the completion rate of a habit over the last days
+func habitRateText(habit models.Habit, now time.Time) string {
+	return rateText(habit.CompletionRate(now, habitRateDays))
+}
+
+// lastDays returns the local midnights of the last n days, ending today
+func lastDays(now time.Time, n int) []time.Time {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	days := make([]time.Time, n)
+	for i := range days {
+		days[i] = today.AddDate(0, 0, i-n+1)
+	}
+	return days
+}
+
+// weekdays returns the days of the week, starting on Monday
+func weekdays() []time.Weekday {
+	return []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
+}
+
+// formatNextRun tells when the next plan of a template will be created
+func formatNextRun(planTemplate models.PlanTemplate) string {
+	if planTemplate.NextRunAt.IsZero() {
+		return "none, the template has ended"
+	}
+	return planTemplate.NextRunAt.Local().Format("Jan 02, 2006 15:04")
+}
+
+// trashTypeName returns the name of a type of item in the trash, e.g.
+// "Journal entry"
+func trashTypeName(itemType string) string {
+	switch itemType {
+	case models.TrashJournal:
+		return "Journal entry"
+	case models.TrashPlanTemplate:
+		return "Plan template"
+	}
+	return strings.ToUpper(itemType[:1]) + itemType[1:]
+}
+
+// trashItemURL returns the URL of an action on an item in the trash, e.g.
+// /trash/plan/12/restore
+func trashItemURL(itemType string, id int64, action string) string {
+	return "/trash/" + itemType + "/" + strconv.FormatInt(id, 10) + "/" + action
+}
+
+// rateText shows a rate as a percentage, or a dash when there is none
+func rateText(rate float64, ok bool) string {
+	if !ok {
+		return "–"
+	}
+	return fmt.Sprintf("%.0f%%", rate*100)
+}
+
+// intentionOutcome is an answer to whether an intention was applied when its
+// behaviour occurred
+type intentionOutcome struct {
+	value string
+	label string
+}
+
+// intentionOutcomes are the answers offered after logging an occurrence
+var intentionOutcomes = []intentionOutcome{
+	{"worked", "Applied, it worked"},
+	{"failed", "Applied, it did not work"},
+	{"skipped", "Not applied"},
+}
+
+// onScale reports whether a mark is on the scale
+func onScale(scale models.MarkScale, mark string) bool {
+	_, ok := scale.Rank(mark)
+	return ok
+}
+
+// markStyle colours the badge of a mark on the scale
+func markStyle(scale models.MarkScale, mark string) templ.SafeCSS {
+	return templ.SafeCSS("background-color: " + scale.Colour(mark) + ";")
+}
+
+// markEqual reports whether two marks are the same, levels being compared
+// regardless of case
+func markEqual(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), b)
+}
+
+// markTrend tells whether a mark is more or less severe than the previous
+// one, e.g. "better"
+func markTrend(scale models.MarkScale, previous, current string) string {
+	p, okPrevious := scale.Rank(previous)
+	c, okCurrent := scale.Rank(current)
+	switch {
+	case !okPrevious || !okCurrent:
+		return ""
+	case c < p:
+		return "better"
+	case c > p:
+		return "worse"
+	}
+	return ""
+}
+
+// healthStyle colours the badge of a health score, from red for 0 to green
+// for 100
+func healthStyle(score float64) templ.SafeCSS {
+	return templ.SafeCSS(fmt.Sprintf("background-color: hsl(%.0f, 70%%, 40%%);", 1.2*score))
+}
+
+// trendArrow shows the trend of a health score as an arrow
+func trendArrow(trend string) string {
+	switch trend {
+	case "up":
+		return "↑"
+	case "down":
+		return "↓"
+	case "steady":
+		return "→"
+	}
+	return ""
+}
+
+// trendClass colours the arrow of the trend of a health score
+func trendClass(trend string) string {
+	switch trend {
+	case "up":
+		return "trend-better"
+	case "down":
+		return "trend-worse"
+	}
+	return "meta"
+}
+
+// formatScore formats a health score, or a factor of it, out of 100
+func formatScore(score float64) string {
+	return fmt.Sprintf("%.0f", score)
+}
+
+// healthFactor returns the factor of a health score with the given name,
+// and false if it does not apply to the aim
+func healthFactor(health models.AimHealth, name string) (models.HealthFactor, bool) {
+	for _, factor := range health.Factors {
+		if factor.Name == name {
+			return factor, true
+		}
+	}
+	return models.HealthFactor{}, false
+}
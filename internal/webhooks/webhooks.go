@@ -0,0 +1,94 @@
+// Package webhooks posts domain events to the URLs registered by the user,
+// signed with HMAC-SHA256 so that receivers can check they come from the app.
+//
+// Each request carries the headers:
+//
+//	X-PDS-Event: the event type, e.g. plan.completed
+//	X-PDS-Delivery: the ID of the delivery, the same across retries
+//	X-PDS-Timestamp: the Unix time of the request
+//	X-PDS-Signature: sha256=<hex HMAC of "<timestamp>.<body>" keyed by the secret>
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers of the requests
+const (
+	HeaderEvent     = "X-PDS-Event"
+	HeaderDelivery  = "X-PDS-Delivery"
+	HeaderTimestamp = "X-PDS-Timestamp"
+	HeaderSignature = "X-PDS-Signature"
+)
+
+// signaturePrefix names the algorithm of the signature
+const signaturePrefix = "sha256="
+
+// MaxSkew is how old a request may be before Verify rejects it as replayed
+const MaxSkew = 5 * time.Minute
+
+// httpClient sends the requests
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// Sign returns the signature of a body sent at a Unix time
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a received request, whose body was read,
+// and that it was sent recently
+func Verify(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid timestamp")
+	}
+	if skew := now.Sub(time.Unix(timestamp, 0)); skew > MaxSkew || skew < -MaxSkew {
+		return errors.New("the timestamp is too old or in the future")
+	}
+	expected := Sign(secret, timestamp, body)
+	if !hmac.Equal([]byte(header.Get(HeaderSignature)), []byte(expected)) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// Send posts a JSON body to a URL, signed with the secret. It returns the
+// status of the response, if any. Any response other than 2xx is an error.
+func Send(ctx context.Context, url, secret, deliveryID, eventType string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "pds-webhooks")
+	req.Header.Set(HeaderEvent, eventType)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("the webhook answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
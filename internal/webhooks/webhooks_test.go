@@ -0,0 +1,118 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"pds/internal/webhooks/webhookstest"
+)
+
+func TestSendSigned(t *testing.T) {
+	server, requests := webhookstest.NewReceiver(t, http.StatusNoContent)
+	body := []byte(`{"type":"plan.completed","data":{"id":1}}`)
+
+	status, err := Send(context.Background(), server.URL, "s3cret", "42", "plan.completed", body)
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("Send = %d, %v", status, err)
+	}
+	req := <-requests
+
+	if got := req.Header.Get(HeaderEvent); got != "plan.completed" {
+		t.Errorf("event %q", got)
+	}
+	if got := req.Header.Get(HeaderDelivery); got != "42" {
+		t.Errorf("delivery %q", got)
+	}
+	if string(req.Body) != string(body) {
+		t.Errorf("body %s, want %s", req.Body, body)
+	}
+	timestamp, err := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid timestamp: %v", err)
+	}
+	if want := Sign("s3cret", timestamp, body); req.Header.Get(HeaderSignature) != want {
+		t.Errorf("signature %q, want %q", req.Header.Get(HeaderSignature), want)
+	}
+	if err := Verify("s3cret", req.Header, req.Body, time.Now()); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	// HMAC-SHA256 of "1700000000.{}" keyed by "key"
+	want := "sha256=9d713ed406bb7076d4123f0dc2c39d2df5c654ed4b0cd56b52c8b4c940bd63ae"
+	if got := Sign("key", 1700000000, []byte("{}")); got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":1}`)
+	signed := func(secret string, sentAt time.Time, body []byte) http.Header {
+		header := http.Header{}
+		header.Set(HeaderTimestamp, strconv.FormatInt(sentAt.Unix(), 10))
+		header.Set(HeaderSignature, Sign(secret, sentAt.Unix(), body))
+		return header
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+	}{
+		{"other secret", signed("other", now, body)},
+		{"other body", signed("s3cret", now, []byte(`{"id":2}`))},
+		{"replayed", signed("s3cret", now.Add(-MaxSkew-time.Second), body)},
+		{"from the future", signed("s3cret", now.Add(MaxSkew+time.Second), body)},
+		{"unsigned", http.Header{HeaderTimestamp: {strconv.FormatInt(now.Unix(), 10)}}},
+		{"no timestamp", http.Header{}},
+	}
+	for _, test := range tests {
+		if err := Verify("s3cret", test.header, body, now); err == nil {
+			t.Errorf("%s: Verify accepted the request", test.name)
+		}
+	}
+	if err := Verify("s3cret", signed("s3cret", now.Add(-time.Minute), body), body, now); err != nil {
+		t.Errorf("Verify rejected a valid request: %v", err)
+	}
+}
+
+func TestSendRetried(t *testing.T) {
+	server, requests := webhookstest.NewReceiver(t, http.StatusServiceUnavailable, http.StatusOK)
+	body := []byte(`{"id":1}`)
+
+	status, err := Send(context.Background(), server.URL, "s3cret", "7", "plan.created", body)
+	if err == nil || status != http.StatusServiceUnavailable {
+		t.Errorf("first attempt = %d, %v, want a 503 error", status, err)
+	}
+	first := <-requests
+
+	status, err = Send(context.Background(), server.URL, "s3cret", "7", "plan.created", body)
+	if err != nil || status != http.StatusOK {
+		t.Errorf("retry = %d, %v, want 200", status, err)
+	}
+	retry := <-requests
+
+	// Receivers tell retries apart from new deliveries by their ID
+	if first.Header.Get(HeaderDelivery) != retry.Header.Get(HeaderDelivery) {
+		t.Errorf("the retry has the delivery ID %q, want %q", retry.Header.Get(HeaderDelivery), first.Header.Get(HeaderDelivery))
+	}
+	if err := Verify("s3cret", retry.Header, retry.Body, time.Now()); err != nil {
+		t.Errorf("Verify of the retry: %v", err)
+	}
+}
+
+func TestSendUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	status, err := Send(context.Background(), url, "s3cret", "1", "plan.created", []byte("{}"))
+	if err == nil || status != 0 {
+		t.Errorf("Send = %d, %v, want an error without status", status, err)
+	}
+}
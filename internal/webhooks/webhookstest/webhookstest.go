@@ -0,0 +1,33 @@
+// Package webhookstest provides a server receiving webhooks, for the tests
+// of their delivery.
+package webhookstest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Request is a request received by a test server
+type Request struct {
+	Header http.Header
+	Body   []byte
+}
+
+// NewReceiver runs a server answering each request with the next status of
+// a list, the last one repeating, until the test ends. The requests received
+// are sent on the returned channel.
+func NewReceiver(t testing.TB, statuses ...int) (*httptest.Server, <-chan Request) {
+	t.Helper()
+	requests := make(chan Request, 10)
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- Request{Header: r.Header, Body: body}
+		w.WriteHeader(statuses[min(count, len(statuses)-1)])
+		count++
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
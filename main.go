@@ -1,16 +1,38 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
+	"pds/internal/attachments"
 	"pds/internal/database"
+	"pds/internal/events"
 	"pds/internal/handlers"
+	"pds/internal/logging"
+	"pds/internal/metrics"
+	"pds/internal/scheduler"
 )
 
+// shutdownTimeout bounds the time given to the requests in flight and the
+// running jobs to finish on shutdown
+const shutdownTimeout = 30 * time.Second
+
 func main() {
+	// Log structured records, at the level set by PDS_LOG_LEVEL, e.g. debug
+	logging.Setup(os.Stderr, logging.ParseLevel(os.Getenv("PDS_LOG_LEVEL")))
+
+	// Shut down gracefully on Ctrl-C or when the service is stopped
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Set up database
 	dbDir := "data"
 	if err := os.MkdirAll(dbDir, 0755); err != nil {
@@ -23,13 +45,44 @@ func main() {
 	}
 	defer database.Close()
 
+	// Set up the storage of attachments, and clean up files left over by
+	// deleted entries or interrupted uploads
+	if err := attachments.Initialize(filepath.Join(dbDir, "attachments")); err != nil {
+		log.Fatalf("Failed to initialize attachments: %v", err)
+	}
+	handlers.CollectAttachmentGarbage()
+
+	// Record the changes to the data in the audit log, queue them for the
+	// webhooks receiving them, and stream them to the open pages
+	events.Subscribe(handlers.RecordAudit)
+	events.Subscribe(handlers.QueueWebhookDeliveries)
+	events.Subscribe(handlers.BroadcastLiveUpdate)
+
+	// Run the background jobs: plans of recurring templates are created as
+	// they come due, reminders are queued and delivered, and so are the
+	// events posted to webhooks. Emails are turned into journal entries.
+	jobs := scheduler.New()
+	jobs.Every("plan templates", time.Minute, handlers.RunPlanTemplates)
+	jobs.Every("reminders", time.Minute, handlers.RunReminders)
+	jobs.Every("notifications", time.Minute, handlers.DeliverNotifications)
+	jobs.Every("webhooks", 10*time.Second, handlers.DeliverWebhooks)
+	jobs.Every("emails", time.Minute, handlers.RunEmailIngestion)
+	jobs.Every("trash", time.Hour, handlers.RunTrashPurge)
+	jobs.Every("aim health", time.Hour, handlers.RunAimHealthRecording)
+	jobs.Start(ctx)
+
 	// Define the file server for static assets
 	staticDir := "web/static"
 	fs := http.FileServer(http.Dir(staticDir))
 	http.Handle("/static/", http.StripPrefix("/static/", fs))
 
 	// Define the routes
+	http.HandleFunc("/healthz", handlers.HealthzHandler)
+	http.HandleFunc("/readyz", handlers.ReadyzHandler)
+	http.Handle("/metrics", metrics.Handler(os.Getenv("PDS_METRICS_TOKEN")))
 	http.HandleFunc("/", handlers.HomeHandler)
+	http.HandleFunc("/dashboard/widgets/", handlers.DashboardWidgetHandler)
+	http.HandleFunc("/dashboard/settings", handlers.DashboardSettingsHandler)
 	http.HandleFunc("/journals", handlers.JournalsHandler)
 	http.HandleFunc("/plans", handlers.PlansHandler)
 	http.HandleFunc("/plans/create", handlers.HandleCreatePlan)
@@ -37,24 +90,105 @@ func main() {
 	http.HandleFunc("/plans/cancel-edit/", handlers.CancelEditHandler)
 	http.HandleFunc("/plans/update/", handlers.UpdatePlanHandler)
 	http.HandleFunc("/plans/delete/", handlers.HandleDeletePlan)
+	http.HandleFunc("/plans/start/", handlers.StartPlanHandler)
+	http.HandleFunc("/plans/complete/", handlers.CompletePlanHandler)
+	http.HandleFunc("/plans/progress/", handlers.UpdatePlanProgressHandler)
+	http.HandleFunc("/plans/import", handlers.ImportPlansHandler)
+	http.HandleFunc("/plans/templates", handlers.PlanTemplatesHandler)
+	http.HandleFunc("/plans/templates/", handlers.PlanTemplateDetailHandler)
+	http.HandleFunc("/plans/", handlers.PlanDetailHandler)
+	http.HandleFunc("/milestones/", handlers.MilestoneDetailHandler)
 	http.HandleFunc("/statements", handlers.StatementsHandler)
 	http.HandleFunc("/statements/create", handlers.CreateStatementHandler)
 	http.HandleFunc("/statements/delete", handlers.DeleteStatementHandler)
+	http.HandleFunc("/statements/rehearse", handlers.RehearseHandler)
+	http.HandleFunc("/statements/", handlers.StatementDetailHandler)
+	http.HandleFunc("/api/statements/today", handlers.StatementOfTheDayAPIHandler)
+	http.HandleFunc("/api/journals", handlers.JournalsAPIHandler)
 	http.HandleFunc("/behaviours", handlers.BehavioursHandler)
 	http.HandleFunc("/behaviours/create", handlers.CreateBehaviourHandler)
 	http.HandleFunc("/behaviours/delete", handlers.DeleteBehaviourHandler)
+	http.HandleFunc("/behaviours/occurrences", handlers.LogOccurrenceHandler)
+	http.HandleFunc("/behaviours/scale", handlers.MarkScaleHandler)
+	http.HandleFunc("/behaviours/", handlers.BehaviourDetailHandler)
+	http.HandleFunc("/intentions/", handlers.IntentionDetailHandler)
+	http.HandleFunc("/habits", handlers.HabitsHandler)
+	http.HandleFunc("/habits/create", handlers.CreateHabitHandler)
+	http.HandleFunc("/habits/", handlers.HabitDetailHandler)
+	http.HandleFunc("/reminders", handlers.RemindersHandler)
+	http.HandleFunc("/reminders/settings", handlers.ReminderSettingsHandler)
+	http.HandleFunc("/reminders/test", handlers.ReminderTestHandler)
+	http.HandleFunc("/reminders/push-subscriptions", handlers.PushSubscriptionsHandler)
+	http.HandleFunc("/reminders/", handlers.ReminderDetailHandler)
+	http.HandleFunc("/webhooks", handlers.WebhooksHandler)
+	http.HandleFunc("/webhooks/deliveries/", handlers.WebhookDeliveryHandler)
+	http.HandleFunc("/webhooks/", handlers.WebhookDetailHandler)
+	http.HandleFunc("/moods", handlers.CreateMoodHandler)
+	http.HandleFunc("/markdown/preview", handlers.MarkdownPreviewHandler)
+	http.Handle("/events", handlers.LiveUpdates)
+	http.HandleFunc("/reports", handlers.ReportsHandler)
+	http.HandleFunc("/reports/", handlers.ReportsHandler)
+	http.HandleFunc("/calendar", handlers.CalendarHandler)
+	http.HandleFunc("/calendar/", handlers.CalendarHandler)
+	http.HandleFunc("/calendar/feed-token", handlers.CalendarFeedTokenHandler)
+	http.HandleFunc("/calendar.ics", handlers.CalendarFeedHandler)
 	http.HandleFunc("/values", handlers.ValuesHandler)
 	http.HandleFunc("/values/delete", handlers.DeleteValueHandler)
 	http.HandleFunc("/values/children", handlers.ValuesHandler)
 	http.HandleFunc("/values/parents", handlers.ValuesHandler)
+	http.HandleFunc("/values/health", handlers.AimHealthHandler)
+	http.HandleFunc("/values/", handlers.ValueDetailHandler)
 	http.HandleFunc("/journals/type/", handlers.JournalsHandler)
+	http.HandleFunc("/journals/tag/", handlers.JournalsHandler)
 	http.HandleFunc("/journals/delete", handlers.HandleDeleteJournal)
+	http.HandleFunc("/journals/email", handlers.EmailSettingsHandler)
+	http.HandleFunc("/attachments/", handlers.AttachmentHandler)
+	http.HandleFunc("/export", handlers.ExportHandler)
+	http.HandleFunc("/trash", handlers.TrashHandler)
+	http.HandleFunc("/trash/", handlers.TrashItemHandler)
+	http.HandleFunc("/admin/audit", handlers.AuditHandler)
 	http.HandleFunc("/journals/", handlers.JournalDetailHandler)
 
-	// Start the server
+	// Start the server. The write timeout leaves time for exports and is
+	// lifted for the streams of live updates.
 	port := ":8888"
-	log.Printf("Starting server on http://localhost%s", port)
-	if err := http.ListenAndServe(port, nil); err != nil {
-		log.Fatalf("Error starting server: %v", err)
+	server := &http.Server{
+		Addr:              port,
+		Handler:           logging.Middleware(metrics.Middleware(http.DefaultServeMux)),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+		WriteTimeout:      2 * time.Minute,
+		IdleTimeout:       2 * time.Minute,
+	}
+	server.RegisterOnShutdown(handlers.LiveUpdates.Close)
+	go func() {
+		slog.Info("Starting server", "url", "http://localhost"+port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Error starting server: %v", err)
+		}
+	}()
+
+	// On a signal, stop accepting requests, then wait for the requests in
+	// flight and the running jobs to finish before the database is closed.
+	// A second signal stops the server at once.
+	<-ctx.Done()
+	stop()
+	slog.Info("Shutting down server")
+	handlers.StartDraining()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error shutting down server", "err", err)
+	}
+	jobsDone := make(chan struct{})
+	go func() {
+		jobs.Wait()
+		close(jobsDone)
+	}()
+	select {
+	case <-jobsDone:
+	case <-shutdownCtx.Done():
+		slog.Error("Error waiting for the jobs to finish", "err", shutdownCtx.Err())
 	}
+	slog.Info("Server stopped")
 }
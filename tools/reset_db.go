@@ -43,6 +43,8 @@ func ResetDBMain() {
 		"Grateful for Nature",
 		"Today I took a walk in the park and felt truly grateful for the beauty of nature. The trees were especially vibrant.",
 		"gratitude",
+		models.JournalLinks{},
+		nil,
 	)
 	if err != nil {
 		log.Fatalf("Failed to create gratitude journal entry: %v", err)
@@ -54,6 +56,8 @@ func ResetDBMain() {
 		"Difficult Day at Work",
 		"Today was challenging with tight deadlines and technical issues. I felt frustrated when my code wouldn't compile correctly.",
 		"frustrations",
+		models.JournalLinks{},
+		nil,
 	)
 	if err != nil {
 		log.Fatalf("Failed to create frustrations journal entry: %v", err)
@@ -65,6 +69,8 @@ func ResetDBMain() {
 		"Family Dinner",
 		"I'm grateful for the wonderful dinner with my family tonight. These moments of connection are precious.",
 		"gratitude",
+		models.JournalLinks{},
+		nil,
 	)
 	if err != nil {
 		log.Fatalf("Failed to create gratitude journal entry: %v", err)
@@ -76,6 +82,8 @@ func ResetDBMain() {
 		"Traffic Jam",
 		"Was stuck in traffic for over an hour today. It was frustrating to waste so much time just sitting in my car.",
 		"frustrations",
+		models.JournalLinks{},
+		nil,
 	)
 	if err != nil {
 		log.Fatalf("Failed to create frustrations journal entry: %v", err)
@@ -25,13 +25,13 @@ func TestDBMain() {
 
 	// Insert test journal entries
 	fmt.Println("Creating test journal entries...")
-	id1, err := models.CreateJournal("First Journal Entry", "This is the content of my first journal entry.", "gratitude")
+	id1, err := models.CreateJournal("First Journal Entry", "This is the content of my first journal entry.", "gratitude", models.JournalLinks{}, nil)
 	if err != nil {
 		log.Fatalf("Failed to create journal entry: %v", err)
 	}
 	fmt.Printf("Created journal entry with ID: %d\n", id1)
 
-	id2, err := models.CreateJournal("Second Journal Entry", "This is the content of my second journal entry.", "frustrations")
+	id2, err := models.CreateJournal("Second Journal Entry", "This is the content of my second journal entry.", "frustrations", models.JournalLinks{}, nil)
 	if err != nil {
 		log.Fatalf("Failed to create journal entry: %v", err)
 	}
@@ -0,0 +1,47 @@
+// Subscribes this browser to the push notifications of the app: the service
+// worker shows them, and the subscription is sent to the server
+(function () {
+    const button = document.getElementById("push-subscribe");
+    const status = document.getElementById("push-status");
+    if (!button) {
+        return;
+    }
+    if (!("serviceWorker" in navigator) || !("PushManager" in window)) {
+        button.disabled = true;
+        status.textContent = "This browser does not support push notifications.";
+        return;
+    }
+
+    // The VAPID key is base64url encoded, PushManager wants the raw bytes
+    function decodeKey(key) {
+        const base64 = (key + "=".repeat((4 - key.length % 4) % 4)).replace(/-/g, "+").replace(/_/g, "/");
+        return Uint8Array.from(atob(base64), function (c) { return c.charCodeAt(0); });
+    }
+
+    button.addEventListener("click", async function () {
+        try {
+            const permission = await Notification.requestPermission();
+            if (permission !== "granted") {
+                status.textContent = "Notifications are blocked in this browser.";
+                return;
+            }
+            const registration = await navigator.serviceWorker.register("/static/js/sw.js");
+            await navigator.serviceWorker.ready;
+            const subscription = await registration.pushManager.subscribe({
+                userVisibleOnly: true,
+                applicationServerKey: decodeKey(button.dataset.vapidKey),
+            });
+            const response = await fetch("/reminders/push-subscriptions", {
+                method: "POST",
+                headers: {"Content-Type": "application/json"},
+                body: JSON.stringify(subscription),
+            });
+            if (!response.ok) {
+                throw new Error(await response.text());
+            }
+            status.textContent = "Push notifications are enabled in this browser.";
+        } catch (err) {
+            status.textContent = "Could not enable push notifications: " + err.message;
+        }
+    });
+})();
@@ -0,0 +1,17 @@
+// Service worker showing the push notifications of the app, and opening the
+// page they are about when clicked
+self.addEventListener("push", function (event) {
+    const data = event.data ? event.data.json() : {};
+    event.waitUntil(self.registration.showNotification(data.title || "Journal App", {
+        body: data.body,
+        data: {url: data.url},
+    }));
+});
+
+self.addEventListener("notificationclick", function (event) {
+    event.notification.close();
+    const url = event.notification.data && event.notification.data.url;
+    if (url) {
+        event.waitUntil(clients.openWindow(url));
+    }
+});